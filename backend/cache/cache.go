@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxEntries 内存层默认容量
+const defaultMaxEntries = 1000
+
+// defaultMaxDiskBytes 磁盘层默认容量
+const defaultMaxDiskBytes = 512 << 20
+
+// staleTempAge 临时文件超过该时间未被重命名时视为中断的写入，清理时删除；更新的临时文件可能正在写入
+const staleTempAge = time.Hour
+
+// 命中的缓存层
+const (
+	TierMemory = "memory"
+	TierDisk   = "disk"
+)
+
+// Entry 一条缓存的响应
+type Entry struct {
+	Response  json.RawMessage `json:"response"` // OpenAI 格式的完整响应
+	CreatedAt time.Time       `json:"createdAt"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+}
+
+// Expired 缓存是否已过期
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Options 缓存配置
+type Options struct {
+	MaxEntries   int    // 内存层最大条目数
+	Dir          string // 磁盘层目录，为空时只使用内存
+	MaxDiskBytes int64  // 磁盘层最大字节数，超出时按最近使用时间淘汰
+}
+
+// item 内存层 LRU 链表中的元素
+type item struct {
+	key   string
+	entry *Entry
+}
+
+// Cache 内存 LRU 加可选磁盘层的响应缓存
+// 磁盘层保存未过期条目直到超出容量，内存层未命中时回源磁盘并提升到内存
+// 磁盘层以文件修改时间作为最近使用时间，命中时更新
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	dir        string
+
+	maxDiskBytes int64
+	diskBytes    atomic.Int64 // 磁盘层占用的估计值，覆盖写入时会偏大，Prune 时校正
+	pruning      atomic.Bool
+}
+
+func New(opts Options) (*Cache, error) {
+	c := &Cache{
+		maxEntries:   opts.MaxEntries,
+		ll:           list.New(),
+		items:        make(map[string]*list.Element),
+		dir:          opts.Dir,
+		maxDiskBytes: opts.MaxDiskBytes,
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = defaultMaxEntries
+	}
+	if c.maxDiskBytes <= 0 {
+		c.maxDiskBytes = defaultMaxDiskBytes
+	}
+	if c.dir != "" {
+		if err := os.MkdirAll(c.dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Key 计算缓存键（各部分依次参与 SHA-256）
+func Key(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get 查找未过期的缓存，返回命中的缓存层
+func (c *Cache) Get(key string, now time.Time) (*Entry, string, bool) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*item).entry
+		if !entry.Expired(now) {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			return entry, TierMemory, true
+		}
+		c.removeElement(el)
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil, "", false
+	}
+
+	path := c.diskPath(key)
+	entry, err := readEntry(path)
+	if err != nil {
+		return nil, "", false
+	}
+	if entry.Expired(now) {
+		os.Remove(path)
+		return nil, "", false
+	}
+	os.Chtimes(path, now, now)
+
+	c.mu.Lock()
+	c.add(key, entry)
+	c.mu.Unlock()
+	return entry, TierDisk, true
+}
+
+// Set 写入缓存，磁盘层写入失败时返回错误（内存层仍然有效）
+// 磁盘层超出容量时在后台执行 Prune
+func (c *Cache) Set(key string, entry *Entry) error {
+	c.mu.Lock()
+	c.add(key, entry)
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil
+	}
+	size, err := c.writeDisk(key, entry)
+	if err != nil {
+		return err
+	}
+	if c.diskBytes.Add(size) > c.maxDiskBytes && c.pruning.CompareAndSwap(false, true) {
+		go func() {
+			defer c.pruning.Store(false)
+			c.Prune(time.Now())
+		}()
+	}
+	return nil
+}
+
+// add 加入内存层并按 LRU 淘汰，调用方需持有锁
+func (c *Cache) add(key string, entry *Entry) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*item).entry = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&item{key: key, entry: entry})
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*item).key)
+}
+
+// Len 内存层条目数
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// diskPath 按键的前两位分目录，避免单个目录下文件过多
+func (c *Cache) diskPath(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func readEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// writeDisk 先写临时文件再重命名，避免读到写了一半的条目，返回写入的字节数
+func (c *Cache) writeDisk(key string, entry *Entry) (int64, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	path := c.diskPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return int64(len(data)), os.Rename(tmp.Name(), path)
+}
+
+// diskFile 磁盘层的一个条目文件
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// Prune 删除磁盘层中已过期或无法读取的条目以及中断写入留下的临时文件，超出容量时再按最近使用时间从旧到新淘汰，返回删除的数量
+func (c *Cache) Prune(now time.Time) (int, error) {
+	if c.dir == "" {
+		return 0, nil
+	}
+
+	removed := 0
+	var files []diskFile
+	var total int64
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			if info, err := d.Info(); err == nil && now.Sub(info.ModTime()) > staleTempAge {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+
+		entry, err := readEntry(path)
+		if err != nil || entry.Expired(now) {
+			if os.Remove(path) == nil {
+				removed++
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, diskFile{path: path, size: info.Size(), modTime: info.ModTime()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	if total > c.maxDiskBytes {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		for _, file := range files {
+			if total <= c.maxDiskBytes {
+				break
+			}
+			if os.Remove(file.path) == nil {
+				removed++
+				total -= file.size
+			}
+		}
+	}
+	c.diskBytes.Store(total)
+	return removed, nil
+}
@@ -3,10 +3,15 @@ package config
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/elysia-api/backend/transform"
 )
 
 type Config struct {
@@ -17,8 +22,15 @@ type Config struct {
 	HTTPTimeout      int                `json:"httpTimeout,omitempty"`      // HTTP 请求超时时间（秒），0 为不限制
 	DebugMode        bool               `json:"debugMode,omitempty"`        // 调试模式
 	VerboseLog       bool               `json:"verboseLog,omitempty"`       // 详细日志模式
+	Timeouts         TimeoutConfig      `json:"timeouts"`                   // 上游分阶段超时（全局默认）
+	LogLevel         string             `json:"logLevel,omitempty"`         // 日志级别：debug | info | warn | error
+	LogFormat        string             `json:"logFormat,omitempty"`        // 日志格式：text | json
+	Redaction        RedactionConfig    `json:"redaction"`                  // 日志脱敏
+	RequestLog       RequestLogConfig   `json:"requestLog"`                 // 请求记录持久化
+	Cache            CacheConfig        `json:"cache"`                      // 响应缓存存储（各模型组单独启用）
 	mu               sync.RWMutex
 	path             string
+	reloadHooks      []func(*Config)
 }
 
 type ServerConfig struct {
@@ -30,6 +42,88 @@ type AccessToken struct {
 	Token   string `json:"token"`
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
+	Admin   bool   `json:"admin,omitempty"` // 允许访问 /__admin 管理接口
+
+	// 以下限制为 0 或空时不限制
+	RPM           int      `json:"rpm,omitempty"`           // 每分钟请求数
+	TPM           int      `json:"tpm,omitempty"`           // 每分钟 token 数
+	DailyTokens   int64    `json:"dailyTokens,omitempty"`   // 每日 token 预算（按本地时区自然日）
+	MonthlyTokens int64    `json:"monthlyTokens,omitempty"` // 每月 token 预算（按本地时区自然月）
+	AllowedGroups []string `json:"allowedGroups,omitempty"` // 允许使用的模型组，支持 * 和 ? 通配符，为空时允许全部
+	DeniedGroups  []string `json:"deniedGroups,omitempty"`  // 禁止使用的模型组，支持通配符，优先于 allowedGroups
+	DailyBudget   float64  `json:"dailyBudget,omitempty"`   // 每日费用预算（美元）
+	MonthlyBudget float64  `json:"monthlyBudget,omitempty"` // 每月费用预算（美元）
+	ExpiresAt     string   `json:"expiresAt,omitempty"`     // 过期时间：RFC3339，或 YYYY-MM-DD（当天结束时过期）
+}
+
+// ExpiryTime 解析过期时间，未配置时返回零值
+func (t *AccessToken) ExpiryTime() (time.Time, error) {
+	if t.ExpiresAt == "" {
+		return time.Time{}, nil
+	}
+	if expiry, err := time.Parse(time.RFC3339, t.ExpiresAt); err == nil {
+		return expiry, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", t.ExpiresAt, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("token '%s': invalid expiresAt '%s', expected RFC3339 or YYYY-MM-DD", t.Name, t.ExpiresAt)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// Expired 令牌是否已过期，过期时间无法解析时视为已过期
+func (t *AccessToken) Expired(now time.Time) bool {
+	expiry, err := t.ExpiryTime()
+	if err != nil {
+		return true
+	}
+	return !expiry.IsZero() && !now.Before(expiry)
+}
+
+// AllowsGroup 令牌是否允许使用指定模型组
+func (t *AccessToken) AllowsGroup(group string) bool {
+	for _, pattern := range t.DeniedGroups {
+		if matchGlob(pattern, group) {
+			return false
+		}
+	}
+	if len(t.AllowedGroups) == 0 {
+		return true
+	}
+	for _, pattern := range t.AllowedGroups {
+		if matchGlob(pattern, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 通配符匹配：* 匹配任意字符串（包括 /），? 匹配单个字符
+func matchGlob(pattern, name string) bool {
+	p, n := []rune(pattern), []rune(name)
+	// 回溯位置：最近一个 * 在模式中的位置，以及它开始匹配的名称位置
+	star, mark := -1, 0
+	i, j := 0, 0
+	for j < len(n) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == n[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, mark = i, j
+			i++
+		case star >= 0:
+			i = star + 1
+			mark++
+			j = mark
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
 }
 
 type ModelGroupConfig struct {
@@ -46,6 +140,23 @@ type ModelGroupConfig struct {
 	MaxTokens     int        `json:"maxTokens,omitempty"`
 	VisionCapable *bool      `json:"visionCapable,omitempty"`
 	ToolsCapable  *bool      `json:"toolsCapable,omitempty"`
+	Timeouts      *TimeoutConfig `json:"timeouts,omitempty"` // 覆盖全局超时配置
+	ContextPolicy *ContextPolicy `json:"contextPolicy,omitempty"` // 超出上下文窗口时的处理策略，未配置时直接拒绝
+	Cache         *GroupCacheConfig `json:"cache,omitempty"`       // 响应缓存，未配置时不缓存
+	Coalesce      bool           `json:"coalesce,omitempty"`      // 合并并发的相同请求，只向上游发送一次
+	Hedge         *HedgeConfig   `json:"hedge,omitempty"`         // 对冲请求，未配置时不对冲
+	Passthrough   *PassthroughConfig `json:"passthrough,omitempty"` // 透传给上游的未知字段，未配置时全部透传
+	StructuredOutput *StructuredOutputConfig `json:"structuredOutput,omitempty"` // 结构化输出的网关侧校验，未配置时不校验
+	Overrides     []transform.Rule `json:"overrides,omitempty"`  // 修改统一格式的请求，字段名使用统一格式，对所有上游生效
+	Transforms    []transform.Rule `json:"transforms,omitempty"` // 修改发往上游的最终请求体，字段名使用目标平台的格式
+}
+
+// ContextPolicy 超出上下文窗口时的处理策略
+// 系统消息始终保留，keepLastTurns 指定始终保留的最近对话轮数
+type ContextPolicy struct {
+	Mode          string `json:"mode"`                    // reject（直接拒绝）| drop-oldest | middle-out，裁剪方式见 relay.TrimDropOldest 等
+	KeepLastTurns int    `json:"keepLastTurns,omitempty"` // 默认 1
+	ReserveTokens int    `json:"reserveTokens,omitempty"` // 客户端未指定 max_tokens 时为输出预留的 token 数，默认 1024
 }
 
 type ModelRef struct {
@@ -54,12 +165,168 @@ type ModelRef struct {
 	BaseURL string `json:"baseUrl"`
 	APIKey  string `json:"apiKey"`
 	Platform string `json:"platform"`
+	Timeouts *TimeoutConfig `json:"timeouts,omitempty"` // 覆盖模型组超时配置
+	ContextWindow int `json:"contextWindow,omitempty"` // 上下文窗口（token），0 时使用模型组的 maxTokens
+	Completions bool `json:"completions,omitempty"` // 支持旧版 /completions 接口，文本补全请求原样转发，否则包装为聊天请求
+	// 每百万 token 的价格（美元），未配置时使用内置价格表
+	InputPrice       *float64 `json:"inputPrice,omitempty"`
+	OutputPrice      *float64 `json:"outputPrice,omitempty"`
+	CachedInputPrice *float64 `json:"cachedInputPrice,omitempty"`
+	// 在模型组的 overrides / transforms 之后应用
+	Overrides  []transform.Rule `json:"overrides,omitempty"`
+	Transforms []transform.Rule `json:"transforms,omitempty"`
+	// 上游请求附加的请求头和查询参数，请求头可覆盖默认的 Content-Type、Accept 和认证头
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	// API Key 的传递方式：bearer（默认）| header:<请求头> | query:<参数名> | none，见 Auth
+	AuthScheme string `json:"authScheme,omitempty"`
+}
+
+// API Key 的传递方式
+const (
+	AuthBearer = "bearer" // Authorization: Bearer <apiKey>
+	AuthHeader = "header" // 放在指定请求头中，如 header:x-api-key
+	AuthQuery  = "query"  // 放在指定查询参数中，如 query:key
+	AuthNone   = "none"   // 不传递，认证信息由 headers 或 query 提供
+)
+
+// Auth 解析 AuthScheme，返回传递方式和请求头名或参数名
+func (m *ModelRef) Auth() (scheme, name string, err error) {
+	scheme, name, _ = strings.Cut(m.AuthScheme, ":")
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	name = strings.TrimSpace(name)
+	switch scheme {
+	case "", AuthBearer:
+		return AuthBearer, "", nil
+	case AuthNone:
+		return AuthNone, "", nil
+	case AuthHeader, AuthQuery:
+		if name == "" {
+			return "", "", fmt.Errorf("authScheme '%s' requires a name, e.g. '%s:<name>'", m.AuthScheme, scheme)
+		}
+		return scheme, name, nil
+	}
+	return "", "", fmt.Errorf("unknown authScheme '%s', expected bearer, header:<name>, query:<name> or none", m.AuthScheme)
+}
+
+// TimeoutConfig 上游请求的分阶段超时（秒），0 表示继承上一级配置，负数表示不限制
+type TimeoutConfig struct {
+	Dial         int `json:"dial,omitempty"`         // TCP 连接超时
+	TLSHandshake int `json:"tlsHandshake,omitempty"` // TLS 握手超时
+	FirstByte    int `json:"firstByte,omitempty"`    // 流式请求首个数据块超时
+	Idle         int `json:"idle,omitempty"`         // 流式请求数据块间的空闲超时
+}
+
+// RedactionConfig 日志脱敏配置
+// 上游 API Key、访问令牌和 Authorization 头始终会被遮蔽
+type RedactionConfig struct {
+	Paths          []string `json:"paths,omitempty"`          // 额外遮蔽的 JSON 路径，如 "user"、"messages.*.name"
+	Content        string   `json:"content,omitempty"`        // 对话内容处理方式：keep（默认）| hash | truncate
+	TruncateLength int      `json:"truncateLength,omitempty"` // truncate 模式保留的字符数，默认 64
+}
+
+// RequestLogConfig 请求记录持久化配置，记录以 JSONL 格式追加写入并按大小轮转
+type RequestLogConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir,omitempty"`         // 存储目录，默认为配置文件所在目录下的 request-logs
+	MaxFileSize int    `json:"maxFileSize,omitempty"` // 单个文件最大大小（MB），默认 50
+	MaxFiles    int    `json:"maxFiles,omitempty"`    // 保留的历史文件数，默认 10
+}
+
+// CacheConfig 响应缓存的存储配置
+type CacheConfig struct {
+	MaxEntries  int    `json:"maxEntries,omitempty"`  // 内存层最大条目数，默认 1000
+	Dir         string `json:"dir,omitempty"`         // 磁盘层目录，为空时只使用内存
+	MaxDiskSize int    `json:"maxDiskSize,omitempty"` // 磁盘层最大占用（MB），默认 512，超出时淘汰最久未使用的条目
+}
+
+// GroupCacheConfig 模型组的响应缓存配置
+type GroupCacheConfig struct {
+	Enabled        bool `json:"enabled"`
+	TTL            int  `json:"ttl,omitempty"`            // 缓存有效期（秒），默认 3600
+	AnyTemperature bool `json:"anyTemperature,omitempty"` // 缓存所有请求；默认只缓存 temperature 为 0 的请求
+}
+
+// HedgeConfig 对冲请求配置，用于对延迟敏感的模型组
+// 首个响应在 Delay 内未到达时向组内另一个模型再发起一次请求，先响应的一方胜出，另一方被取消
+type HedgeConfig struct {
+	Enabled bool `json:"enabled"`
+	Delay   int  `json:"delay,omitempty"` // 发起对冲前的等待时间（毫秒），默认 1000
+}
+
+// PassthroughConfig 透传字段的允许和禁止列表，支持 * 和 ? 通配符
+// 只作用于统一格式无法识别、原样转发给同系上游的字段；禁止列表优先，允许列表为空时允许所有字段
+type PassthroughConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Allows 是否允许透传指定字段，未配置时全部允许
+func (p *PassthroughConfig) Allows(field string) bool {
+	if p == nil {
+		return true
+	}
+	for _, pattern := range p.Deny {
+		if matchGlob(pattern, field) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.Allow {
+		if matchGlob(pattern, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// StructuredOutputConfig 结构化输出（response_format 为 json_object 或 json_schema）的网关侧校验
+// 只校验非流式响应：返回内容不是合法 JSON 或不符合 JSON Schema 时重新请求上游
+type StructuredOutputConfig struct {
+	Validate   bool `json:"validate"`
+	MaxRetries *int `json:"maxRetries,omitempty"` // 校验失败后的重试次数，默认 1，0 表示不重试直接返回错误
+}
+
+// defaultStructuredOutputRetries 结构化输出校验失败后默认的重试次数
+const defaultStructuredOutputRetries = 1
+
+// Retries 返回校验失败后的重试次数
+func (s *StructuredOutputConfig) Retries() int {
+	if s.MaxRetries != nil && *s.MaxRetries >= 0 {
+		return *s.MaxRetries
+	}
+	return defaultStructuredOutputRetries
+}
+
+// defaultHedgeDelay 对冲请求默认等待时间
+const defaultHedgeDelay = time.Second
+
+// HedgeDelay 返回发起对冲前的等待时间
+func (h *HedgeConfig) HedgeDelay() time.Duration {
+	if h.Delay > 0 {
+		return time.Duration(h.Delay) * time.Millisecond
+	}
+	return defaultHedgeDelay
+}
+
+// defaultCacheTTL 响应缓存默认有效期
+const defaultCacheTTL = time.Hour
+
+// CacheTTL 返回缓存有效期
+func (g *GroupCacheConfig) CacheTTL() time.Duration {
+	if g.TTL > 0 {
+		return time.Duration(g.TTL) * time.Second
+	}
+	return defaultCacheTTL
 }
 
 type DailyLimit struct {
 	Enabled    bool  `json:"enabled"`
 	MaxRequest int   `json:"maxRequests"`
 	MaxTokens  int   `json:"maxTokens"`
+	MaxCost    float64 `json:"maxCost,omitempty"` // 每日费用上限（美元）
 }
 
 var GlobalConfig *Config
@@ -74,6 +341,9 @@ func Load(path string) (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 
 	cfg.path = path
 	cfg.mu.Lock()
@@ -93,6 +363,9 @@ func (c *Config) Reload() error {
 	if err := json.Unmarshal(data, &newCfg); err != nil {
 		return err
 	}
+	if err := newCfg.validate(); err != nil {
+		return err
+	}
 
 	c.mu.Lock()
 	c.Server = newCfg.Server
@@ -102,8 +375,59 @@ func (c *Config) Reload() error {
 	c.HTTPTimeout = newCfg.HTTPTimeout
 	c.DebugMode = newCfg.DebugMode
 	c.VerboseLog = newCfg.VerboseLog
+	c.Timeouts = newCfg.Timeouts
+	c.LogLevel = newCfg.LogLevel
+	c.LogFormat = newCfg.LogFormat
+	c.Redaction = newCfg.Redaction
+	c.RequestLog = newCfg.RequestLog
+	c.Cache = newCfg.Cache
+	hooks := c.reloadHooks
+	c.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(c)
+	}
+	return nil
+}
+
+// OnReload 注册配置重新加载后调用的函数，用于更新按配置构建的组件（如日志脱敏器中的密钥）
+func (c *Config) OnReload(hook func(*Config)) {
+	c.mu.Lock()
+	c.reloadHooks = append(c.reloadHooks, hook)
 	c.mu.Unlock()
+}
 
+// validate 检查无法在使用时安全回退的配置项
+func (c *Config) validate() error {
+	for i := range c.Tokens {
+		if _, err := c.Tokens[i].ExpiryTime(); err != nil {
+			return err
+		}
+	}
+	for _, group := range c.Groups {
+		if err := validateRules(group.Name, group.Overrides, group.Transforms); err != nil {
+			return err
+		}
+		for _, model := range group.Models {
+			if err := validateRules(group.Name+"/"+model.Name, model.Overrides, model.Transforms); err != nil {
+				return err
+			}
+			if _, _, err := model.Auth(); err != nil {
+				return fmt.Errorf("'%s/%s': %w", group.Name, model.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRules 检查 overrides 和 transforms 规则
+func validateRules(owner string, overrides, transforms []transform.Rule) error {
+	if err := transform.Validate(overrides); err != nil {
+		return fmt.Errorf("'%s': invalid overrides: %w", owner, err)
+	}
+	if err := transform.Validate(transforms); err != nil {
+		return fmt.Errorf("'%s': invalid transforms: %w", owner, err)
+	}
 	return nil
 }
 
@@ -125,12 +449,90 @@ func (c *Config) GetGroupByName(name string) *ModelGroupConfig {
 	return nil
 }
 
+// ContextWindow 返回模型的上下文窗口大小，0 表示未配置
+func (g *ModelGroupConfig) ContextWindow(model *ModelRef) int {
+	if model != nil && model.ContextWindow > 0 {
+		return model.ContextWindow
+	}
+	return g.MaxTokens
+}
+
 func (c *Config) GetTokens() []AccessToken {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.Tokens
 }
 
+// GetRedaction 返回日志脱敏配置
+func (c *Config) GetRedaction() RedactionConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Redaction
+}
+
+// GetRequestLogDir 返回请求记录的存储目录
+func (c *Config) GetRequestLogDir() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.RequestLog.Dir != "" {
+		return c.RequestLog.Dir
+	}
+	return filepath.Join(filepath.Dir(c.path), "request-logs")
+}
+
+// GetLogLevel 返回日志级别，未配置时调试模式为 debug，否则为 info
+func (c *Config) GetLogLevel() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.LogLevel != "" {
+		return c.LogLevel
+	}
+	if c.DebugMode {
+		return "debug"
+	}
+	return "info"
+}
+
+// Secrets 返回配置中出现的所有密钥（访问令牌、上游 API Key 以及看起来像凭据的附加请求头和查询参数），用于日志脱敏
+func (c *Config) Secrets() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var secrets []string
+	for _, token := range c.Tokens {
+		secrets = append(secrets, token.Token)
+	}
+	for _, group := range c.Groups {
+		for _, model := range group.Models {
+			secrets = append(secrets, model.APIKey)
+			for name, value := range model.Headers {
+				if isCredentialName(name) {
+					secrets = append(secrets, value)
+				}
+			}
+			for name, value := range model.Query {
+				if isCredentialName(name) {
+					secrets = append(secrets, value)
+				}
+			}
+		}
+	}
+	return secrets
+}
+
+// isCredentialName 请求头或查询参数名是否像是用于认证
+func isCredentialName(name string) bool {
+	name = strings.ToLower(name)
+	for _, hint := range []string{"auth", "key", "token", "secret", "signature", "password"} {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Config) GetHeartbeatTimeout() time.Duration {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -141,6 +543,78 @@ func (c *Config) GetHeartbeatTimeout() time.Duration {
 	return 300 * time.Second // 默认 300 秒
 }
 
+// 分阶段超时的默认值（秒）
+const (
+	defaultDialTimeout         = 10
+	defaultTLSHandshakeTimeout = 10
+	defaultIdleTimeout         = 60
+)
+
+// ResolvedTimeouts 合并后的超时配置，0 表示不限制
+type ResolvedTimeouts struct {
+	Dial         time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	Idle         time.Duration
+	Total        time.Duration // 非流式请求的整体超时，来自 HTTPTimeout
+}
+
+// ResolveTimeouts 按 模型 > 模型组 > 全局 > 默认值 的优先级合并超时配置
+// 流式请求的首块超时未配置时沿用 HTTPTimeout，整体时长不受限制
+func (c *Config) ResolveTimeouts(group *ModelGroupConfig, model *ModelRef) ResolvedTimeouts {
+	c.mu.RLock()
+	global := c.Timeouts
+	httpTimeout := c.HTTPTimeout
+	c.mu.RUnlock()
+
+	merged := TimeoutConfig{
+		Dial:         defaultDialTimeout,
+		TLSHandshake: defaultTLSHandshakeTimeout,
+		FirstByte:    httpTimeout,
+		Idle:         defaultIdleTimeout,
+	}
+	layers := []*TimeoutConfig{&global}
+	if group != nil {
+		layers = append(layers, group.Timeouts)
+	}
+	if model != nil {
+		layers = append(layers, model.Timeouts)
+	}
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		if layer.Dial != 0 {
+			merged.Dial = layer.Dial
+		}
+		if layer.TLSHandshake != 0 {
+			merged.TLSHandshake = layer.TLSHandshake
+		}
+		if layer.FirstByte != 0 {
+			merged.FirstByte = layer.FirstByte
+		}
+		if layer.Idle != 0 {
+			merged.Idle = layer.Idle
+		}
+	}
+
+	return ResolvedTimeouts{
+		Dial:         secondsToDuration(merged.Dial),
+		TLSHandshake: secondsToDuration(merged.TLSHandshake),
+		FirstByte:    secondsToDuration(merged.FirstByte),
+		Idle:         secondsToDuration(merged.Idle),
+		Total:        secondsToDuration(httpTimeout),
+	}
+}
+
+// secondsToDuration 将秒数转换为 time.Duration，非正数视为不限制
+func secondsToDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func init() {
 	configFile := flag.String("config", "", "Path to config file")
 	flag.Parse()
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// level 全局日志级别，支持在运行时调整
+var level = new(slog.LevelVar)
+
+// Setup 初始化全局结构化日志，输出到标准输出
+// 标准库 log 包的输出也会经由同一个 handler（INFO 级别）
+func Setup(levelName, format string) {
+	level.Set(ParseLevel(levelName))
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		// 所有字符串字段（包括消息本身）都经过脱敏处理
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindString {
+				a.Value = slog.StringValue(CurrentRedactor().String(a.Value.String()))
+			}
+			return a
+		},
+	}
+	var handler slog.Handler
+	if strings.EqualFold(format, FormatJSON) {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// SetLevel 调整全局日志级别
+func SetLevel(levelName string) {
+	level.Set(ParseLevel(levelName))
+}
+
+// ParseLevel 解析日志级别名称，无法识别时返回 INFO
+func ParseLevel(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
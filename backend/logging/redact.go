@@ -0,0 +1,239 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// 消息内容的处理方式
+const (
+	ContentKeep     = "keep"     // 原样输出
+	ContentHash     = "hash"     // 输出 SHA-256 摘要和长度
+	ContentTruncate = "truncate" // 仅保留开头若干字符
+)
+
+// defaultTruncateLength 截断模式下保留的字符数
+const defaultTruncateLength = 64
+
+// sensitiveKeys JSON 中总是遮蔽的字段名（小写比较）
+var sensitiveKeys = map[string]bool{
+	"apikey":         true,
+	"api_key":        true,
+	"authorization":  true,
+	"x-api-key":      true,
+	"x-goog-api-key": true,
+	"access_token":   true,
+	"token":          true,
+	"password":       true,
+	"secret":         true,
+}
+
+// contentPaths 各格式中承载用户对话内容的 JSON 路径
+var contentPaths = []string{
+	"messages.*.content",
+	"system",
+	"contents.*.parts.*.text",
+	"systemInstruction.parts.*.text",
+	"prompt",
+	"input",
+	"instructions",
+	"choices.*.message.content",
+	"choices.*.message.reasoning_content",
+	"choices.*.text",
+}
+
+// secretPatterns 常见密钥格式，即使不在已知密钥列表中也会遮蔽
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`sk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_-]{30,}`),
+}
+
+// RedactOptions 脱敏配置
+type RedactOptions struct {
+	Secrets        []string // 需要遮蔽的已知密钥（上游 API Key、访问令牌等）
+	Paths          []string // 额外需要遮蔽的 JSON 路径，以 "." 分隔，"*" 匹配任意键或数组下标
+	Content        string   // 消息内容处理方式：keep | hash | truncate
+	TruncateLength int
+}
+
+// Redactor 对日志中的密钥和对话内容进行脱敏
+type Redactor struct {
+	secrets        []string
+	paths          [][]string
+	content        string
+	truncateLength int
+}
+
+func NewRedactor(opts RedactOptions) *Redactor {
+	r := &Redactor{
+		content:        strings.ToLower(opts.Content),
+		truncateLength: opts.TruncateLength,
+	}
+	if r.truncateLength <= 0 {
+		r.truncateLength = defaultTruncateLength
+	}
+
+	// 较长的密钥优先替换，避免前缀相同的密钥只被部分遮蔽
+	for _, secret := range opts.Secrets {
+		if len(secret) >= 4 {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+
+	for _, path := range opts.Paths {
+		if path = strings.TrimSpace(path); path != "" {
+			r.paths = append(r.paths, strings.Split(path, "."))
+		}
+	}
+	return r
+}
+
+// current 当前生效的脱敏器，由日志 handler 读取
+var current atomic.Pointer[Redactor]
+
+// SetRedactor 设置全局脱敏器，所有日志输出都会经过它处理
+func SetRedactor(r *Redactor) {
+	current.Store(r)
+}
+
+// CurrentRedactor 返回全局脱敏器，未设置时返回只按内置规则处理的脱敏器
+func CurrentRedactor() *Redactor {
+	if r := current.Load(); r != nil {
+		return r
+	}
+	return NewRedactor(RedactOptions{})
+}
+
+// mask 遮蔽密钥，保留开头少量字符便于辨认
+func mask(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
+
+// String 遮蔽文本中出现的已知密钥和常见密钥格式
+func (r *Redactor) String(s string) string {
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, mask(secret))
+		}
+	}
+	for _, pattern := range secretPatterns {
+		s = pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if sub := pattern.FindStringSubmatch(match); len(sub) > 1 {
+				return sub[1] + "****"
+			}
+			return mask(match)
+		})
+	}
+	return s
+}
+
+// JSON 对 JSON 文本脱敏：遮蔽敏感字段和配置的路径，并按配置处理对话内容
+// 无法解析为 JSON 时按普通文本处理
+func (r *Redactor) JSON(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return r.String(string(data))
+	}
+
+	v = maskSensitiveKeys(v)
+	for _, path := range r.paths {
+		v = applyPath(v, path, func(interface{}) interface{} { return "****" })
+	}
+	if r.content == ContentHash || r.content == ContentTruncate {
+		for _, path := range contentPaths {
+			v = applyPath(v, strings.Split(path, "."), r.redactContent)
+		}
+	}
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return r.String(string(data))
+	}
+	return r.String(string(out))
+}
+
+// redactContent 按配置摘要或截断对话内容中的所有字符串
+func (r *Redactor) redactContent(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		if r.content == ContentHash {
+			sum := sha256.Sum256([]byte(val))
+			return fmt.Sprintf("sha256:%s (len=%d)", hex.EncodeToString(sum[:6]), utf8.RuneCountInString(val))
+		}
+		if utf8.RuneCountInString(val) <= r.truncateLength {
+			return val
+		}
+		runes := []rune(val)
+		return fmt.Sprintf("%s…(%d chars)", string(runes[:r.truncateLength]), len(runes))
+	case []interface{}:
+		for i := range val {
+			val[i] = r.redactContent(val[i])
+		}
+	case map[string]interface{}:
+		for key, item := range val {
+			// 保留内容块的类型等结构字段
+			if key == "type" {
+				continue
+			}
+			val[key] = r.redactContent(item)
+		}
+	}
+	return v
+}
+
+// maskSensitiveKeys 递归遮蔽敏感字段的值
+func maskSensitiveKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			if sensitiveKeys[strings.ToLower(key)] {
+				if s, ok := item.(string); ok {
+					val[key] = mask(s)
+					continue
+				}
+			}
+			val[key] = maskSensitiveKeys(item)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = maskSensitiveKeys(val[i])
+		}
+	}
+	return v
+}
+
+// applyPath 对匹配路径的所有值应用 fn
+func applyPath(v interface{}, path []string, fn func(interface{}) interface{}) interface{} {
+	if len(path) == 0 {
+		return fn(v)
+	}
+
+	segment, rest := path[0], path[1:]
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			if segment == "*" || segment == key {
+				val[key] = applyPath(item, rest, fn)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			if segment == "*" || segment == fmt.Sprint(i) {
+				val[i] = applyPath(item, rest, fn)
+			}
+		}
+	}
+	return v
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"github.com/elysia-api/backend/config"
+	"github.com/elysia-api/backend/logging"
 	"github.com/elysia-api/backend/server"
 	"github.com/elysia-api/backend/signal"
 )
@@ -13,6 +14,12 @@ func main() {
 		log.Fatal("Config not loaded")
 	}
 
+	// 初始化结构化日志，之后标准库 log 的输出也使用相同格式
+	logging.Setup(config.GlobalConfig.GetLogLevel(), config.GlobalConfig.LogFormat)
+	// 重新加载配置后按新的密钥和脱敏配置重建脱敏器，新增的 API Key 和访问令牌同样会被遮蔽
+	setRedactor(config.GlobalConfig)
+	config.GlobalConfig.OnReload(setRedactor)
+
 	// 启动心跳监控（超时时间从 config.GlobalConfig.HeartbeatTimeout 获取）
 	// 如果配置中未设置，使用默认值 300 秒
 	signal.StartHeartbeatMonitor(config.GlobalConfig.GetHeartbeatTimeout())
@@ -30,3 +37,14 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// setRedactor 按配置中的密钥和脱敏选项设置全局脱敏器
+func setRedactor(cfg *config.Config) {
+	redaction := cfg.GetRedaction()
+	logging.SetRedactor(logging.NewRedactor(logging.RedactOptions{
+		Secrets:        cfg.Secrets(),
+		Paths:          redaction.Paths,
+		Content:        redaction.Content,
+		TruncateLength: redaction.TruncateLength,
+	}))
+}
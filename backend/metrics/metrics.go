@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "elysia"
+
+// 所有请求级指标共用的标签
+var labelNames = []string{"group", "model", "platform", "format", "token"}
+
+// Labels 请求级指标的标签值，未知的字段以空字符串表示
+type Labels struct {
+	Group    string
+	Model    string
+	Platform string
+	Format   string
+	Token    string
+}
+
+func (l Labels) values(extra ...string) []string {
+	return append([]string{l.Group, l.Model, l.Platform, l.Format, l.Token}, extra...)
+}
+
+// 延迟类指标的分桶（秒），覆盖从快速补全到长时间推理的范围
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Total number of relayed requests by response status.",
+	}, append(labelNames, "status", "stream"))
+
+	errorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "request_errors_total",
+		Help:      "Total number of failed requests by error kind (client, upstream, stream).",
+	}, append(labelNames, "kind"))
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "End-to-end request latency.",
+		Buckets:   latencyBuckets,
+	}, append(labelNames, "stream"))
+
+	timeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_first_token_seconds",
+		Help:      "Time from receiving a stream request to forwarding the first upstream event.",
+		Buckets:   latencyBuckets,
+	}, labelNames)
+
+	tokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Total number of tokens consumed, by type (prompt, completion).",
+	}, append(labelNames, "type"))
+
+	costTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Total estimated cost in US dollars, computed from usage and model pricing.",
+	}, labelNames)
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Total number of response cache lookups by result (hit, miss) and tier (memory, disk).",
+	}, []string{"group", "result", "tier"})
+
+	coalescedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coalesced_requests_total",
+		Help:      "Total number of requests served by joining an identical in-flight upstream request.",
+	}, []string{"group", "stream"})
+
+	hedgedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hedged_requests_total",
+		Help:      "Total number of hedge attempts by result (launched, skipped, won, lost).",
+	}, []string{"group", "result"})
+
+	inflightRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_requests",
+		Help:      "Number of requests currently being relayed per model group.",
+	}, []string{"group"})
+
+	groupMaxConcurrency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "group_max_concurrency",
+		Help:      "Configured maximum concurrency per model group (0 means unlimited).",
+	}, []string{"group"})
+)
+
+// ObserveRequest 记录一次请求的状态码和耗时
+func ObserveRequest(l Labels, status int, stream bool, duration time.Duration) {
+	streamLabel := strconv.FormatBool(stream)
+	requestsTotal.WithLabelValues(l.values(strconv.Itoa(status), streamLabel)...).Inc()
+	requestDuration.WithLabelValues(l.values(streamLabel)...).Observe(duration.Seconds())
+}
+
+// ObserveError 记录一次失败请求
+func ObserveError(l Labels, kind string) {
+	errorsTotal.WithLabelValues(l.values(kind)...).Inc()
+}
+
+// ObserveTTFT 记录流式请求的首 token 延迟
+func ObserveTTFT(l Labels, d time.Duration) {
+	timeToFirstToken.WithLabelValues(l.values()...).Observe(d.Seconds())
+}
+
+// AddTokens 累加 token 用量
+func AddTokens(l Labels, prompt, completion int) {
+	if prompt > 0 {
+		tokensTotal.WithLabelValues(l.values("prompt")...).Add(float64(prompt))
+	}
+	if completion > 0 {
+		tokensTotal.WithLabelValues(l.values("completion")...).Add(float64(completion))
+	}
+}
+
+// AddCost 累加费用（美元）
+func AddCost(l Labels, cost float64) {
+	if cost > 0 {
+		costTotal.WithLabelValues(l.values()...).Add(cost)
+	}
+}
+
+// ObserveCache 记录一次响应缓存查找，未命中时 tier 为空
+func ObserveCache(group, result, tier string) {
+	cacheLookups.WithLabelValues(group, result, tier).Inc()
+}
+
+// ObserveCoalesced 记录一次被合并的请求
+func ObserveCoalesced(group string, stream bool) {
+	coalescedRequests.WithLabelValues(group, strconv.FormatBool(stream)).Inc()
+}
+
+// ObserveHedge 记录一次对冲：launched 已发起，skipped 因并发已满未发起，won 对冲请求胜出，lost 原请求胜出
+func ObserveHedge(group, result string) {
+	hedgedRequests.WithLabelValues(group, result).Inc()
+}
+
+// TrackInflight 增加模型组的并发计数，返回的函数用于请求结束时减少计数
+func TrackInflight(group string, maxConcurrency int) func() {
+	groupMaxConcurrency.WithLabelValues(group).Set(float64(maxConcurrency))
+	gauge := inflightRequests.WithLabelValues(group)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// Handler 返回 Prometheus 指标的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,88 @@
+package pricing
+
+import "strings"
+
+// Price 每百万 token 的价格（美元）
+type Price struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cachedInput"` // 命中缓存的输入 token，0 时按 Input 计价
+}
+
+// Cost 计算一次请求的费用，cached 为 prompt 中命中缓存的部分
+func (p Price) Cost(prompt, cached, completion int) float64 {
+	if cached > prompt {
+		cached = prompt
+	}
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	return (float64(prompt-cached)*p.Input + float64(cached)*cachedPrice + float64(completion)*p.Output) / 1e6
+}
+
+// defaultPrices 常见模型的官方标价，按名称前缀匹配（最长前缀优先）
+// 仅作为未在模型配置中指定价格时的默认值
+var defaultPrices = map[string]Price{
+	// OpenAI
+	"gpt-5":         {Input: 1.25, Output: 10, CachedInput: 0.125},
+	"gpt-5-mini":    {Input: 0.25, Output: 2, CachedInput: 0.025},
+	"gpt-5-nano":    {Input: 0.05, Output: 0.4, CachedInput: 0.005},
+	"gpt-4.1":       {Input: 2, Output: 8, CachedInput: 0.5},
+	"gpt-4.1-mini":  {Input: 0.4, Output: 1.6, CachedInput: 0.1},
+	"gpt-4.1-nano":  {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gpt-4o":        {Input: 2.5, Output: 10, CachedInput: 1.25},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+	"chatgpt-4o":    {Input: 5, Output: 15},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-4":         {Input: 30, Output: 60},
+	"gpt-3.5-turbo": {Input: 0.5, Output: 1.5},
+	"o1":            {Input: 15, Output: 60, CachedInput: 7.5},
+	"o1-mini":       {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+	"o3":            {Input: 2, Output: 8, CachedInput: 0.5},
+	"o3-mini":       {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+	"o4-mini":       {Input: 1.1, Output: 4.4, CachedInput: 0.275},
+
+	// Anthropic
+	"claude-opus-4-5":   {Input: 5, Output: 25, CachedInput: 0.5},
+	"claude-opus-4":     {Input: 15, Output: 75, CachedInput: 1.5},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CachedInput: 0.1},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CachedInput: 0.08},
+	"claude-3-opus":     {Input: 15, Output: 75, CachedInput: 1.5},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CachedInput: 0.03},
+
+	// Google
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10, CachedInput: 0.31},
+	"gemini-2.5-flash":      {Input: 0.3, Output: 2.5, CachedInput: 0.075},
+	"gemini-2.5-flash-lite": {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gemini-2.0-flash":      {Input: 0.1, Output: 0.4, CachedInput: 0.025},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.3},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5},
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.3},
+
+	// DeepSeek
+	"deepseek-chat":     {Input: 0.27, Output: 1.1, CachedInput: 0.07},
+	"deepseek-reasoner": {Input: 0.55, Output: 2.19, CachedInput: 0.14},
+}
+
+// Default 返回模型的默认价格，未收录时返回 false
+func Default(model string) (Price, bool) {
+	name := strings.ToLower(model)
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:] // 去掉 "openai/gpt-4o" 之类的厂商前缀
+	}
+
+	best := ""
+	for prefix := range defaultPrices {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return defaultPrices[best], true
+}
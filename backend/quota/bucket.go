@@ -0,0 +1,68 @@
+package quota
+
+import (
+	"math"
+	"time"
+)
+
+// Bucket 令牌桶：容量为每分钟限额，按限额 / 60 的速率每秒补充
+// 余量允许为负，用于请求结束后才知道实际消耗的 token 限额
+type Bucket struct {
+	capacity float64
+	rate     float64 // 每秒补充量
+	tokens   float64
+	last     time.Time
+}
+
+// NewBucket 创建装满的令牌桶
+func NewBucket(perMinute int, now time.Time) *Bucket {
+	return &Bucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     now,
+	}
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// Available 当前余量（向下取整，可能为负）
+func (b *Bucket) Available(now time.Time) int {
+	b.refill(now)
+	return int(math.Floor(b.tokens))
+}
+
+// Take 余量足够时扣除 n 并返回 true
+func (b *Bucket) Take(n float64, now time.Time) bool {
+	b.refill(now)
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Consume 无条件扣除 n，余量可能变为负数
+func (b *Bucket) Consume(n float64, now time.Time) {
+	b.refill(now)
+	b.tokens -= n
+}
+
+// WaitFor 余量恢复到 n 所需的时间
+func (b *Bucket) WaitFor(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= n || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// ResetIn 令牌桶恢复到满额所需的时间
+func (b *Bucket) ResetIn(now time.Time) time.Duration {
+	return b.WaitFor(b.capacity, now)
+}
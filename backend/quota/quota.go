@@ -0,0 +1,266 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 限额类型，用于错误信息和日志
+const (
+	LimitRequests      = "requests per minute"
+	LimitTokens        = "tokens per minute"
+	LimitDailyRequests = "daily request limit"
+	LimitDaily         = "daily token budget"
+	LimitMonthly       = "monthly token budget"
+	LimitDailyCost     = "daily cost budget"
+	LimitMonthlyCost   = "monthly cost budget"
+)
+
+// Limits 单个访问令牌或模型组的限额，0 表示不限制
+type Limits struct {
+	RPM           int
+	TPM           int
+	DailyRequests int
+	DailyTokens   int64
+	MonthlyTokens int64
+	DailyCost     float64 // 美元
+	MonthlyCost   float64 // 美元
+}
+
+// Usage 一个统计周期内的用量
+type Usage struct {
+	Requests int
+	Tokens   int64
+	Cost     float64
+}
+
+// ExceededError 超出限额
+type ExceededError struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s", e.Limit)
+}
+
+// Status 限额和剩余量，Limits 中未配置的项对应的剩余量无意义
+type Status struct {
+	Limits
+
+	RemainingRequests int
+	RemainingTokens   int
+	ResetRequests     time.Duration
+	ResetTokens       time.Duration
+
+	Daily                  Usage
+	DailyRequestsRemaining int
+	DailyRemaining         int64
+	DailyCostRemaining     float64
+	DailyReset             time.Time
+	Monthly                Usage
+	MonthlyRemaining       int64
+	MonthlyCostRemaining   float64
+	MonthlyReset           time.Time
+}
+
+// state 单个访问令牌或模型组的计数状态
+type state struct {
+	limits  Limits
+	rpm     *Bucket
+	tpm     *Bucket
+	day     string
+	daily   Usage
+	month   string
+	monthly Usage
+}
+
+// Manager 按名称（访问令牌或模型组）维护限额计数
+type Manager struct {
+	mu     sync.Mutex
+	states map[string]*state
+	loc    *time.Location
+	now    func() time.Time
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		states: make(map[string]*state),
+		loc:    time.Local,
+		now:    time.Now,
+	}
+}
+
+// stateFor 返回令牌的计数状态，限额变化（配置重载）时重建令牌桶，自然日/月切换时清零预算
+func (m *Manager) stateFor(name string, limits Limits, now time.Time) *state {
+	st, ok := m.states[name]
+	if !ok {
+		st = &state{}
+		m.states[name] = st
+	}
+
+	if !ok || st.limits.RPM != limits.RPM {
+		st.rpm = nil
+		if limits.RPM > 0 {
+			st.rpm = NewBucket(limits.RPM, now)
+		}
+	}
+	if !ok || st.limits.TPM != limits.TPM {
+		st.tpm = nil
+		if limits.TPM > 0 {
+			st.tpm = NewBucket(limits.TPM, now)
+		}
+	}
+	st.limits = limits
+
+	local := now.In(m.loc)
+	if day := local.Format("2006-01-02"); st.day != day {
+		st.day = day
+		st.daily = Usage{}
+	}
+	if month := local.Format("2006-01"); st.month != month {
+		st.month = month
+		st.monthly = Usage{}
+	}
+	return st
+}
+
+// Acquire 检查所有限额，通过时占用一次请求配额
+// token 和费用限额在请求前只检查是否仍有余量，实际消耗在 Record 中扣除
+func (m *Manager) Acquire(name string, limits Limits) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	st := m.stateFor(name, limits, now)
+
+	monthly := &ExceededError{RetryAfter: m.monthReset(now).Sub(now)}
+	switch {
+	case limits.MonthlyTokens > 0 && st.monthly.Tokens >= limits.MonthlyTokens:
+		monthly.Limit = LimitMonthly
+	case limits.MonthlyCost > 0 && st.monthly.Cost >= limits.MonthlyCost:
+		monthly.Limit = LimitMonthlyCost
+	}
+	if monthly.Limit != "" {
+		return m.status(st, now), monthly
+	}
+
+	daily := &ExceededError{RetryAfter: m.dayReset(now).Sub(now)}
+	switch {
+	case limits.DailyRequests > 0 && st.daily.Requests >= limits.DailyRequests:
+		daily.Limit = LimitDailyRequests
+	case limits.DailyTokens > 0 && st.daily.Tokens >= limits.DailyTokens:
+		daily.Limit = LimitDaily
+	case limits.DailyCost > 0 && st.daily.Cost >= limits.DailyCost:
+		daily.Limit = LimitDailyCost
+	}
+	if daily.Limit != "" {
+		return m.status(st, now), daily
+	}
+
+	if st.tpm != nil && st.tpm.Available(now) <= 0 {
+		return m.status(st, now), &ExceededError{Limit: LimitTokens, RetryAfter: st.tpm.WaitFor(1, now)}
+	}
+	if st.rpm != nil && !st.rpm.Take(1, now) {
+		return m.status(st, now), &ExceededError{Limit: LimitRequests, RetryAfter: st.rpm.WaitFor(1, now)}
+	}
+	st.daily.Requests++
+	st.monthly.Requests++
+	return m.status(st, now), nil
+}
+
+// Record 记录一次请求实际消耗的 token 数和费用
+func (m *Manager) Record(name string, limits Limits, tokens int64, cost float64) {
+	if tokens <= 0 && cost <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	st := m.stateFor(name, limits, now)
+	if st.tpm != nil {
+		st.tpm.Consume(float64(tokens), now)
+	}
+	st.daily.Tokens += tokens
+	st.daily.Cost += cost
+	st.monthly.Tokens += tokens
+	st.monthly.Cost += cost
+}
+
+// Seed 以历史用量初始化当日和当月的计数，用于重启后恢复
+func (m *Manager) Seed(name string, daily, monthly Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	st, ok := m.states[name]
+	if !ok {
+		st = m.stateFor(name, Limits{}, now)
+	}
+	st.daily = daily
+	st.monthly = monthly
+}
+
+// Status 返回当前的限额和剩余量
+func (m *Manager) Status(name string, limits Limits) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	return m.status(m.stateFor(name, limits, now), now)
+}
+
+func (m *Manager) status(st *state, now time.Time) Status {
+	status := Status{
+		Limits:       st.limits,
+		Daily:        st.daily,
+		DailyReset:   m.dayReset(now),
+		Monthly:      st.monthly,
+		MonthlyReset: m.monthReset(now),
+	}
+	if st.rpm != nil {
+		status.RemainingRequests = max(st.rpm.Available(now), 0)
+		status.ResetRequests = st.rpm.ResetIn(now)
+	}
+	if st.tpm != nil {
+		status.RemainingTokens = max(st.tpm.Available(now), 0)
+		status.ResetTokens = st.tpm.ResetIn(now)
+	}
+	if st.limits.DailyRequests > 0 {
+		status.DailyRequestsRemaining = max(st.limits.DailyRequests-st.daily.Requests, 0)
+	}
+	if st.limits.DailyTokens > 0 {
+		status.DailyRemaining = max(st.limits.DailyTokens-st.daily.Tokens, 0)
+	}
+	if st.limits.MonthlyTokens > 0 {
+		status.MonthlyRemaining = max(st.limits.MonthlyTokens-st.monthly.Tokens, 0)
+	}
+	if st.limits.DailyCost > 0 {
+		status.DailyCostRemaining = max(st.limits.DailyCost-st.daily.Cost, 0)
+	}
+	if st.limits.MonthlyCost > 0 {
+		status.MonthlyCostRemaining = max(st.limits.MonthlyCost-st.monthly.Cost, 0)
+	}
+	return status
+}
+
+// dayReset 下一个自然日的开始时间
+func (m *Manager) dayReset(now time.Time) time.Time {
+	local := now.In(m.loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, m.loc)
+}
+
+// monthReset 下一个自然月的开始时间
+func (m *Manager) monthReset(now time.Time) time.Time {
+	local := now.In(m.loc)
+	return time.Date(local.Year(), local.Month()+1, 1, 0, 0, 0, 0, m.loc)
+}
+
+// MonthStart 当前自然月的开始时间，用于从历史记录恢复计数
+func (m *Manager) MonthStart() time.Time {
+	local := m.now().In(m.loc)
+	return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, m.loc)
+}
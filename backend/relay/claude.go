@@ -0,0 +1,606 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// claudeRequest Anthropic Messages API 请求
+type claudeRequest struct {
+	Model         string          `json:"model"`
+	MaxTokens     int             `json:"max_tokens"`
+	Messages      []claudeMessage `json:"messages"`
+	System        json.RawMessage `json:"system,omitempty"` // 字符串或文本块数组
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	TopK          int             `json:"top_k,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stop          interface{}     `json:"stop,omitempty"` // 旧版字段
+	Thinking      *struct {
+		Type         string `json:"type"` // "enabled" | "disabled"
+		BudgetTokens int    `json:"budget_tokens"`
+	} `json:"thinking,omitempty"`
+	ThinkingEnabled *bool `json:"thinking_enabled,omitempty"` // 旧版字段
+	ThinkingBudget  int   `json:"thinking_budget,omitempty"`  // 旧版字段
+	Metadata        *struct {
+		UserID string `json:"user_id"`
+	} `json:"metadata,omitempty"`
+	Tools []struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		InputSchema map[string]interface{} `json:"input_schema,omitempty"`
+	} `json:"tools,omitempty"`
+	ToolChoice *struct {
+		Type                   string `json:"type"` // "auto" | "any" | "tool" | "none"
+		Name                   string `json:"name,omitempty"`
+		DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+	} `json:"tool_choice,omitempty"`
+}
+
+type claudeMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // 字符串或内容块数组
+}
+
+// claudeBlock Claude 内容块，不同类型使用不同字段
+type claudeBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image / document
+	Source *struct {
+		Type      string `json:"type"` // "base64" | "url" | "text"
+		MediaType string `json:"media_type,omitempty"`
+		Data      string `json:"data,omitempty"`
+		URL       string `json:"url,omitempty"`
+	} `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// ClaudeToUnified 将 Claude 格式转换为统一格式
+// 支持数组形式的 system、多模态内容块、tool_use/tool_result 和 thinking 配置
+// 历史消息中的 thinking 块不会发送给上游
+func ClaudeToUnified(body []byte) (*UnifiedRequest, error) {
+	var claudeReq claudeRequest
+	if err := json.Unmarshal(body, &claudeReq); err != nil {
+		return nil, fmt.Errorf("failed to parse Claude request: %w", err)
+	}
+
+	unified := &UnifiedRequest{
+		Model:       claudeReq.Model,
+		MaxTokens:   claudeReq.MaxTokens,
+		Stream:      claudeReq.Stream,
+		Temperature: claudeReq.Temperature,
+		TopP:        claudeReq.TopP,
+		TopK:        claudeReq.TopK,
+		Stop:        claudeReq.Stop,
+		ExtraFields: extraFields(body, claudeFields),
+		ExtraFormat: FormatClaude,
+	}
+	if len(claudeReq.StopSequences) > 0 {
+		unified.Stop = claudeReq.StopSequences
+	}
+	if claudeReq.Metadata != nil {
+		unified.User = claudeReq.Metadata.UserID
+	}
+
+	// system 提示放在消息开头
+	system, err := claudeSystemText(claudeReq.System)
+	if err != nil {
+		return nil, err
+	}
+	if system != "" {
+		unified.Messages = append(unified.Messages, UnifiedMessage{Role: "system", Content: system})
+	}
+
+	for i, msg := range claudeReq.Messages {
+		messages, err := claudeMessageToUnified(msg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content in message %d: %w", i, err)
+		}
+		unified.Messages = append(unified.Messages, messages...)
+	}
+
+	// 转换思考配置
+	switch {
+	case claudeReq.Thinking != nil && claudeReq.Thinking.Type == "enabled":
+		unified.ThinkingConfig = &ThinkingConfig{Enabled: true, Effort: thinkingEffort(claudeReq.Thinking.BudgetTokens)}
+	case claudeReq.ThinkingEnabled != nil && *claudeReq.ThinkingEnabled:
+		unified.ThinkingConfig = &ThinkingConfig{Enabled: true, Effort: thinkingEffort(claudeReq.ThinkingBudget)}
+	}
+
+	// 转换工具
+	for _, tool := range claudeReq.Tools {
+		unified.Tools = append(unified.Tools, Tool{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if choice := claudeReq.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "any":
+			unified.ToolChoice = "required"
+		case "none":
+			unified.ToolChoice = "none"
+		case "tool":
+			unified.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice.Name},
+			}
+		default:
+			unified.ToolChoice = "auto"
+		}
+	}
+
+	return unified, nil
+}
+
+// thinkingEffort 按思考预算估计推理强度
+func thinkingEffort(budget int) string {
+	switch {
+	case budget <= 0:
+		return "medium"
+	case budget <= 1000:
+		return "low"
+	case budget >= 20000:
+		return "high"
+	default:
+		return "medium"
+	}
+}
+
+// claudeSystemText 提取 system 提示文本，数组形式时按块拼接
+func claudeSystemText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var blocks []claudeBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", fmt.Errorf("invalid system prompt: %w", err)
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// parseClaudeContent 解析消息内容，字符串形式视为单个文本块
+func parseClaudeContent(raw json.RawMessage) ([]claudeBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []claudeBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []claudeBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// claudeMessageToUnified 转换一条 Claude 消息
+// tool_result 块拆分为独立的 tool 消息并放在同一轮用户内容之前，tool_use 块转换为 tool_calls
+func claudeMessageToUnified(msg claudeMessage) ([]UnifiedMessage, error) {
+	blocks, err := parseClaudeContent(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []UnifiedMessage
+	var parts []interface{}
+	var toolCalls []ToolCall
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+		case "image":
+			if url := claudeSourceURL(block); url != "" {
+				parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+			}
+		case "document":
+			if block.Source != nil && block.Source.Type == "text" {
+				parts = append(parts, map[string]interface{}{"type": "text", "text": block.Source.Data})
+			} else if url := claudeSourceURL(block); url != "" {
+				parts = append(parts, map[string]interface{}{"type": "file", "file": map[string]interface{}{"file_data": url}})
+			}
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		case "tool_result":
+			result, err := claudeToolResultText(block)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, UnifiedMessage{Role: "tool", Content: result, ToolCallID: block.ToolUseID})
+		case "thinking", "redacted_thinking":
+			// 历史思考内容只对 Claude 原生上游有意义，不转发
+		}
+	}
+
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return messages, nil
+	}
+
+	var content interface{}
+	switch {
+	case msg.Role == "assistant" || allTextParts(parts):
+		// assistant 消息和纯文本内容合并为字符串，兼容只接受字符串的上游
+		var text strings.Builder
+		for _, part := range parts {
+			if m, ok := part.(map[string]interface{}); ok && m["type"] == "text" {
+				text.WriteString(m["text"].(string))
+			}
+		}
+		if text.Len() > 0 || len(toolCalls) == 0 {
+			content = text.String()
+		}
+	default:
+		content = parts
+	}
+	return append(messages, UnifiedMessage{Role: msg.Role, Content: content, ToolCalls: toolCalls}), nil
+}
+
+func allTextParts(parts []interface{}) bool {
+	for _, part := range parts {
+		if m, ok := part.(map[string]interface{}); !ok || m["type"] != "text" {
+			return false
+		}
+	}
+	return true
+}
+
+// claudeSourceURL 将图片或文档来源转换为 URL，base64 数据转换为 data URL
+func claudeSourceURL(block claudeBlock) string {
+	if block.Source == nil {
+		return ""
+	}
+	switch block.Source.Type {
+	case "base64":
+		return "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+	case "url":
+		return block.Source.URL
+	}
+	return ""
+}
+
+// claudeToolResultText 提取工具结果的文本内容
+func claudeToolResultText(block claudeBlock) (string, error) {
+	blocks, err := parseClaudeContent(block.Content)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if block.IsError {
+		text = "Error: " + text
+	}
+	return text, nil
+}
+
+// ClaudeResponse Anthropic Messages API 响应
+type ClaudeResponse struct {
+	ID           string                   `json:"id"`
+	Type         string                   `json:"type"` // "message"
+	Role         string                   `json:"role"`
+	Model        string                   `json:"model"`
+	Content      []map[string]interface{} `json:"content"`
+	StopReason   *string                  `json:"stop_reason"`
+	StopSequence *string                  `json:"stop_sequence"`
+	Usage        ClaudeUsage              `json:"usage"`
+}
+
+// ClaudeUsage Claude 格式的用量，input_tokens 不含命中缓存的部分
+type ClaudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func toClaudeUsage(usage Usage) ClaudeUsage {
+	cached := usage.CachedTokens()
+	return ClaudeUsage{
+		InputTokens:          usage.PromptTokens - cached,
+		OutputTokens:         usage.CompletionTokens,
+		CacheReadInputTokens: cached,
+	}
+}
+
+// claudeMessageID 将上游响应 ID 转换为 Claude 风格的消息 ID
+func claudeMessageID(id string) string {
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// claudeStopReason 将 OpenAI 的 finish_reason 转换为 Claude 的 stop_reason
+func claudeStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// toolInput 将工具调用参数转换为 JSON 对象，参数不是合法 JSON 时返回空对象
+func toolInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// OpenAIToClaudeResponse 将 OpenAI 格式的响应转换为 Claude 格式，只使用第一个候选
+func OpenAIToClaudeResponse(resp *OpenAIResponse) *ClaudeResponse {
+	out := &ClaudeResponse{
+		ID:      claudeMessageID(resp.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []map[string]interface{}{},
+		Usage:   toClaudeUsage(resp.Usage),
+	}
+
+	finishReason := ""
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		finishReason = choice.FinishReason
+		if choice.Message.ReasoningContent != "" {
+			out.Content = append(out.Content, map[string]interface{}{
+				"type": "thinking", "thinking": choice.Message.ReasoningContent, "signature": "",
+			})
+		}
+		if text := extractTextFromContent(choice.Message.Content); text != "" {
+			out.Content = append(out.Content, map[string]interface{}{"type": "text", "text": text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			out.Content = append(out.Content, map[string]interface{}{
+				"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": toolInput(call.Function.Arguments),
+			})
+		}
+	}
+
+	stopReason := claudeStopReason(finishReason)
+	out.StopReason = &stopReason
+	return out
+}
+
+// ClaudeErrorType 按 HTTP 状态码返回 Claude 的错误类型
+func ClaudeErrorType(status int) string {
+	switch status {
+	case 400:
+		return "invalid_request_error"
+	case 401:
+		return "authentication_error"
+	case 403:
+		return "permission_error"
+	case 404:
+		return "not_found_error"
+	case 413:
+		return "request_too_large"
+	case 429:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// ClaudeErrorBody 构造 Claude 格式的错误响应体
+func ClaudeErrorBody(errType, message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errType, "message": message},
+	})
+	return body
+}
+
+// StreamConverter 将 OpenAI 格式的流式事件转换为其他格式的事件
+type StreamConverter interface {
+	// Convert 转换一个上游事件（不含 [DONE]）
+	Convert(event *SSEEvent) []*SSEEvent
+	// Finish 流结束时调用，返回收尾事件；重复调用返回空
+	Finish(usage Usage) []*SSEEvent
+}
+
+// ClaudeStreamConverter 将 OpenAI 格式的流式响应转换为 Claude 的 SSE 事件序列：
+// message_start、content_block_start/delta/stop、message_delta、message_stop
+type ClaudeStreamConverter struct {
+	model        string
+	promptTokens int // 本地估算的提示词 token 数，用于 message_start
+
+	started    bool
+	finished   bool
+	nextIndex  int    // 下一个内容块的序号
+	openBlock  string // 当前未结束的内容块类型，为空表示没有
+	toolIndex  int    // 当前工具调用在上游响应中的序号
+	stopReason string
+}
+
+func NewClaudeStreamConverter(model string, promptTokens int) *ClaudeStreamConverter {
+	return &ClaudeStreamConverter{model: model, promptTokens: promptTokens, toolIndex: -1}
+}
+
+// claudeEvent 构造一个 Claude 流式事件，data 中的 type 与事件名相同
+func claudeEvent(name string, data map[string]interface{}) *SSEEvent {
+	data["type"] = name
+	body, _ := json.Marshal(data)
+	return &SSEEvent{Event: name, Data: string(body), HasData: true, Retry: -1}
+}
+
+func (c *ClaudeStreamConverter) start(id, model string) *SSEEvent {
+	c.started = true
+	if model == "" {
+		model = c.model
+	}
+	return claudeEvent("message_start", map[string]interface{}{
+		"message": map[string]interface{}{
+			"id":            claudeMessageID(id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         ClaudeUsage{InputTokens: c.promptTokens},
+		},
+	})
+}
+
+// openNew 结束当前内容块并开始一个新块
+func (c *ClaudeStreamConverter) openNew(events []*SSEEvent, blockType string, block map[string]interface{}) []*SSEEvent {
+	events = c.closeBlock(events)
+	block["type"] = blockType
+	c.openBlock = blockType
+	return append(events, claudeEvent("content_block_start", map[string]interface{}{
+		"index":         c.nextIndex,
+		"content_block": block,
+	}))
+}
+
+func (c *ClaudeStreamConverter) closeBlock(events []*SSEEvent) []*SSEEvent {
+	if c.openBlock == "" {
+		return events
+	}
+	c.openBlock = ""
+	events = append(events, claudeEvent("content_block_stop", map[string]interface{}{"index": c.nextIndex}))
+	c.nextIndex++
+	return events
+}
+
+func (c *ClaudeStreamConverter) delta(events []*SSEEvent, delta map[string]interface{}) []*SSEEvent {
+	return append(events, claudeEvent("content_block_delta", map[string]interface{}{
+		"index": c.nextIndex,
+		"delta": delta,
+	}))
+}
+
+// Convert 转换一个上游事件，只处理第一个候选
+func (c *ClaudeStreamConverter) Convert(event *SSEEvent) []*SSEEvent {
+	if c.finished || !event.HasData || event.IsDone() {
+		return nil
+	}
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil
+	}
+
+	var events []*SSEEvent
+	if !c.started {
+		events = append(events, c.start(chunk.ID, chunk.Model))
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		delta := choice.Delta
+		if delta.ReasoningContent != "" {
+			if c.openBlock != "thinking" {
+				events = c.openNew(events, "thinking", map[string]interface{}{"thinking": "", "signature": ""})
+			}
+			events = c.delta(events, map[string]interface{}{"type": "thinking_delta", "thinking": delta.ReasoningContent})
+		}
+		if delta.Content != "" {
+			if c.openBlock != "text" {
+				events = c.openNew(events, "text", map[string]interface{}{"text": ""})
+			}
+			events = c.delta(events, map[string]interface{}{"type": "text_delta", "text": delta.Content})
+		}
+		for i, call := range delta.ToolCalls {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if c.openBlock != "tool_use" || index != c.toolIndex || call.ID != "" {
+				c.toolIndex = index
+				events = c.openNew(events, "tool_use", map[string]interface{}{
+					"id": call.ID, "name": call.Function.Name, "input": map[string]interface{}{},
+				})
+			}
+			if call.Function.Arguments != "" {
+				events = c.delta(events, map[string]interface{}{"type": "input_json_delta", "partial_json": call.Function.Arguments})
+			}
+		}
+		if choice.FinishReason != "" {
+			c.stopReason = claudeStopReason(choice.FinishReason)
+			events = c.closeBlock(events)
+		}
+	}
+	return events
+}
+
+// Finish 输出 message_delta（包含最终用量和 stop_reason）和 message_stop
+func (c *ClaudeStreamConverter) Finish(usage Usage) []*SSEEvent {
+	if c.finished {
+		return nil
+	}
+	c.finished = true
+
+	var events []*SSEEvent
+	if !c.started {
+		events = append(events, c.start("", ""))
+	}
+	events = c.closeBlock(events)
+
+	stopReason := c.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	claudeUsage := toClaudeUsage(usage)
+	events = append(events, claudeEvent("message_delta", map[string]interface{}{
+		"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": map[string]interface{}{
+			"input_tokens":            claudeUsage.InputTokens,
+			"output_tokens":           claudeUsage.OutputTokens,
+			"cache_read_input_tokens": claudeUsage.CacheReadInputTokens,
+		},
+	}))
+	return append(events, claudeEvent("message_stop", map[string]interface{}{}))
+}
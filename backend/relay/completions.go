@@ -0,0 +1,478 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ObjectTextCompletion 旧版文本补全响应的 object 类型
+// 旧版 /completions 上游的响应转换为聊天格式后保留此类型，表示文本已按原生语义处理（包含 echo 的提示词、旧版格式的 logprobs）
+const ObjectTextCompletion = "text_completion"
+
+// ErrNativeCompletionRequired 提示词无法包装为单条聊天消息
+var ErrNativeCompletionRequired = errors.New("multiple prompts and token prompts require an upstream with native completions support")
+
+// CompletionOptions 旧版文本补全中聊天接口没有对应字段的部分
+type CompletionOptions struct {
+	Prompt   json.RawMessage `json:"prompt"`             // 字符串、字符串数组、token 数组或 token 数组的数组
+	Suffix   string          `json:"suffix,omitempty"`   // 只转发给原生上游
+	Echo     bool            `json:"echo,omitempty"`     // 在补全结果前附加提示词
+	Logprobs *int            `json:"logprobs,omitempty"` // 返回的候选 token 数，0 表示只返回采样 token 的 logprob
+	BestOf   int             `json:"best_of,omitempty"`  // 只转发给原生上游
+}
+
+// Prompts 返回文本形式的提示词，prompt 包含 token 数组时返回 false
+func (o *CompletionOptions) Prompts() ([]string, bool) {
+	var text string
+	if err := json.Unmarshal(o.Prompt, &text); err == nil {
+		return []string{text}, true
+	}
+	var texts []string
+	if err := json.Unmarshal(o.Prompt, &texts); err == nil {
+		return texts, true
+	}
+	return nil, false
+}
+
+// ChatPrompt 返回可以包装为单条用户消息的提示词，prompt 需为字符串或只有一个元素的字符串数组
+func (o *CompletionOptions) ChatPrompt() (string, bool) {
+	prompts, ok := o.Prompts()
+	if !ok || len(prompts) != 1 {
+		return "", false
+	}
+	return prompts[0], true
+}
+
+// completionsRequest 旧版 /v1/completions 请求
+type completionsRequest struct {
+	Model            string          `json:"model"`
+	Prompt           json.RawMessage `json:"prompt"`
+	Suffix           string          `json:"suffix,omitempty"`
+	Echo             bool            `json:"echo,omitempty"`
+	Logprobs         *int            `json:"logprobs,omitempty"`
+	BestOf           int             `json:"best_of,omitempty"`
+	MaxTokens        int             `json:"max_tokens,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"top_p,omitempty"`
+	N                int             `json:"n,omitempty"`
+	Stream           bool            `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`
+	Stop             interface{}     `json:"stop,omitempty"`
+	PresencePenalty  *float64        `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64        `json:"frequency_penalty,omitempty"`
+	User             string          `json:"user,omitempty"`
+	Seed             *int64          `json:"seed,omitempty"`
+}
+
+// CompletionsToUnified 将旧版文本补全请求转换为统一格式
+// 每个文本提示词作为一条用户消息，用于聊天上游和本地 token 估算；原始 prompt 等字段保存在 Completion 中供原生上游使用
+func CompletionsToUnified(body []byte) (*UnifiedRequest, error) {
+	var req completionsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse completions request: %w", err)
+	}
+	if len(req.Prompt) == 0 || string(req.Prompt) == "null" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+
+	unified := &UnifiedRequest{
+		Model:            req.Model,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		N:                req.N,
+		Stream:           req.Stream,
+		StreamOptions:    req.StreamOptions,
+		Stop:             req.Stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		User:             req.User,
+		Seed:             req.Seed,
+		Completion: &CompletionOptions{
+			Prompt:   req.Prompt,
+			Suffix:   req.Suffix,
+			Echo:     req.Echo,
+			Logprobs: req.Logprobs,
+			BestOf:   req.BestOf,
+		},
+		ExtraFields: extraFields(body, completionsFields),
+		ExtraFormat: FormatCompletions,
+	}
+	if req.Logprobs != nil {
+		unified.LogProbs = true
+		unified.TopLogProbs = *req.Logprobs
+	}
+
+	prompts, ok := unified.Completion.Prompts()
+	if !ok {
+		var tokens [][]int
+		var single []int
+		if json.Unmarshal(req.Prompt, &single) != nil && json.Unmarshal(req.Prompt, &tokens) != nil {
+			return nil, fmt.Errorf("prompt must be a string, an array of strings or an array of token arrays")
+		}
+	}
+	for _, prompt := range prompts {
+		unified.Messages = append(unified.Messages, UnifiedMessage{Role: "user", Content: prompt})
+	}
+	return unified, nil
+}
+
+// UnifiedToCompletion 将统一格式转换为旧版 /completions 请求，prompt 原样转发
+func UnifiedToCompletion(unified *UnifiedRequest) ([]byte, error) {
+	options := unified.Completion
+	if options == nil {
+		return nil, fmt.Errorf("request has no completion prompt")
+	}
+
+	result := map[string]interface{}{
+		"model":  unified.Model,
+		"prompt": options.Prompt,
+	}
+	if options.Suffix != "" {
+		result["suffix"] = options.Suffix
+	}
+	if options.Echo {
+		result["echo"] = true
+	}
+	if options.Logprobs != nil {
+		result["logprobs"] = *options.Logprobs
+	}
+	if options.BestOf > 0 {
+		result["best_of"] = options.BestOf
+	}
+	if unified.MaxTokens > 0 {
+		result["max_tokens"] = unified.MaxTokens
+	}
+	if unified.Temperature != nil {
+		result["temperature"] = *unified.Temperature
+	}
+	if unified.TopP != nil {
+		result["top_p"] = *unified.TopP
+	}
+	if unified.N > 1 {
+		result["n"] = unified.N
+	}
+	if unified.Stream {
+		result["stream"] = true
+		if unified.StreamOptions != nil {
+			result["stream_options"] = unified.StreamOptions
+		}
+	}
+	if unified.Stop != nil {
+		result["stop"] = unified.Stop
+	}
+	if unified.PresencePenalty != nil {
+		result["presence_penalty"] = *unified.PresencePenalty
+	}
+	if unified.FrequencyPenalty != nil {
+		result["frequency_penalty"] = *unified.FrequencyPenalty
+	}
+	if unified.User != "" {
+		result["user"] = unified.User
+	}
+	if unified.Seed != nil {
+		result["seed"] = *unified.Seed
+	}
+	addExtraFields(result, unified, FormatCompletions)
+	return json.Marshal(result)
+}
+
+// completionResponse 旧版 /completions 响应，也用于流式响应块
+type completionResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Text         string          `json:"text"`
+		Index        int             `json:"index"`
+		Logprobs     json.RawMessage `json:"logprobs"`
+		FinishReason string          `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// CompletionToChatResponse 将旧版 /completions 响应转换为聊天格式，object 保持为 text_completion
+func CompletionToChatResponse(body []byte) (*OpenAIResponse, error) {
+	var completion completionResponse
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, err
+	}
+
+	resp := &OpenAIResponse{
+		ID:      completion.ID,
+		Object:  ObjectTextCompletion,
+		Created: completion.Created,
+		Model:   completion.Model,
+	}
+	if completion.Usage != nil {
+		resp.Usage = *completion.Usage
+	}
+	for _, choice := range completion.Choices {
+		out := Choice{
+			Index:        choice.Index,
+			Message:      Message{Role: "assistant", Content: choice.Text},
+			FinishReason: choice.FinishReason,
+		}
+		if hasLogprobs(choice.Logprobs) {
+			out.Logprobs = choice.Logprobs
+		}
+		resp.Choices = append(resp.Choices, out)
+	}
+	return resp, nil
+}
+
+// CompletionChunkToChat 将旧版 /completions 的流式响应块转换为聊天格式的响应块，object 保持为 text_completion
+// 无法解析的事件原样返回
+func CompletionChunkToChat(event *SSEEvent) *SSEEvent {
+	if !event.HasData || event.IsDone() {
+		return event
+	}
+	var completion completionResponse
+	if err := json.Unmarshal([]byte(event.Data), &completion); err != nil {
+		return event
+	}
+
+	choices := make([]interface{}, 0, len(completion.Choices))
+	for _, choice := range completion.Choices {
+		out := map[string]interface{}{
+			"index":         choice.Index,
+			"delta":         map[string]interface{}{"content": choice.Text},
+			"finish_reason": nil,
+		}
+		if choice.FinishReason != "" {
+			out["finish_reason"] = choice.FinishReason
+		}
+		if hasLogprobs(choice.Logprobs) {
+			out["logprobs"] = choice.Logprobs
+		}
+		choices = append(choices, out)
+	}
+	chunk := map[string]interface{}{
+		"id":      completion.ID,
+		"object":  ObjectTextCompletion,
+		"created": completion.Created,
+		"model":   completion.Model,
+		"choices": choices,
+	}
+	if completion.Usage != nil {
+		chunk["usage"] = completion.Usage
+	}
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return event
+	}
+
+	converted := *event
+	converted.Data = string(data)
+	return &converted
+}
+
+// CompletionResponse 旧版文本补全响应
+type CompletionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"` // "text_completion"
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+}
+
+type CompletionChoice struct {
+	Text         string          `json:"text"`
+	Index        int             `json:"index"`
+	Logprobs     json.RawMessage `json:"logprobs"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+// completionID 将上游响应 ID 转换为旧版文本补全风格的 ID
+func completionID(id string) string {
+	if strings.HasPrefix(id, "cmpl-") {
+		return id
+	}
+	return "cmpl-" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// chatLogprobs 聊天接口返回的 logprobs
+type chatLogprobs struct {
+	Content []struct {
+		Token       string  `json:"token"`
+		Logprob     float64 `json:"logprob"`
+		TopLogprobs []struct {
+			Token   string  `json:"token"`
+			Logprob float64 `json:"logprob"`
+		} `json:"top_logprobs"`
+	} `json:"content"`
+}
+
+// legacyLogprobs 旧版文本补全的 logprobs
+type legacyLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
+}
+
+// toLegacyLogprobs 将聊天格式的 logprobs 转换为旧版格式，offset 为第一个 token 在文本中的字符位置
+// 返回转换结果和最后一个 token 之后的位置，没有内容时返回 nil
+func toLegacyLogprobs(raw json.RawMessage, offset int) (json.RawMessage, int) {
+	if !hasLogprobs(raw) {
+		return nil, offset
+	}
+	var chat chatLogprobs
+	if err := json.Unmarshal(raw, &chat); err != nil || len(chat.Content) == 0 {
+		return nil, offset
+	}
+
+	legacy := legacyLogprobs{}
+	for _, token := range chat.Content {
+		top := make(map[string]float64, len(token.TopLogprobs))
+		for _, alt := range token.TopLogprobs {
+			top[alt.Token] = alt.Logprob
+		}
+		legacy.Tokens = append(legacy.Tokens, token.Token)
+		legacy.TokenLogprobs = append(legacy.TokenLogprobs, token.Logprob)
+		legacy.TopLogprobs = append(legacy.TopLogprobs, top)
+		legacy.TextOffset = append(legacy.TextOffset, offset)
+		offset += utf8.RuneCountInString(token.Token)
+	}
+	body, err := json.Marshal(legacy)
+	if err != nil {
+		return nil, offset
+	}
+	return body, offset
+}
+
+// OpenAIToCompletionResponse 将 OpenAI 格式的响应转换为旧版文本补全格式
+// 聊天上游的响应在此附加 echo 的提示词并转换 logprobs，原生上游的响应只调整外层结构
+func OpenAIToCompletionResponse(resp *OpenAIResponse, options *CompletionOptions) *CompletionResponse {
+	out := &CompletionResponse{
+		ID:      completionID(resp.ID),
+		Object:  ObjectTextCompletion,
+		Created: resp.Created,
+		Model:   resp.Model,
+		Choices: []CompletionChoice{},
+		Usage:   &resp.Usage,
+	}
+
+	native := resp.Object == ObjectTextCompletion
+	prompt := ""
+	if !native && options != nil && options.Echo {
+		prompt, _ = options.ChatPrompt()
+	}
+	for _, choice := range resp.Choices {
+		text := extractTextFromContent(choice.Message.Content)
+		logprobs := choice.Logprobs
+		if !native {
+			text = prompt + text
+			logprobs, _ = toLegacyLogprobs(choice.Logprobs, utf8.RuneCountInString(prompt))
+		}
+		finishReason := choice.FinishReason
+		out.Choices = append(out.Choices, CompletionChoice{
+			Text:         text,
+			Index:        choice.Index,
+			Logprobs:     logprobs,
+			FinishReason: &finishReason,
+		})
+	}
+	return out
+}
+
+// CompletionStreamConverter 将 OpenAI 格式的流式响应转换为旧版文本补全的流式响应块
+// 用量由 Finish 在 [DONE] 之前按需输出，上游的 usage 块不直接转发
+type CompletionStreamConverter struct {
+	options      *CompletionOptions
+	model        string
+	includeUsage bool
+
+	id       string
+	created  int64
+	offsets  map[int]int // 聊天上游各候选已输出的字符数，用于 logprobs 的 text_offset
+	finished bool
+}
+
+func NewCompletionStreamConverter(options *CompletionOptions, model string, includeUsage bool) *CompletionStreamConverter {
+	return &CompletionStreamConverter{options: options, model: model, includeUsage: includeUsage, offsets: make(map[int]int)}
+}
+
+func (c *CompletionStreamConverter) chunk(choices []CompletionChoice, usage *Usage) *SSEEvent {
+	body, _ := json.Marshal(&CompletionResponse{
+		ID:      completionID(c.id),
+		Object:  ObjectTextCompletion,
+		Created: c.created,
+		Model:   c.model,
+		Choices: choices,
+		Usage:   usage,
+	})
+	return &SSEEvent{Data: string(body), HasData: true, Retry: -1}
+}
+
+// Convert 转换一个上游事件
+func (c *CompletionStreamConverter) Convert(event *SSEEvent) []*SSEEvent {
+	if c.finished || !event.HasData || event.IsDone() {
+		return nil
+	}
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil
+	}
+	if chunk.ID != "" {
+		c.id, c.created = chunk.ID, chunk.Created
+	}
+	if chunk.Model != "" {
+		c.model = chunk.Model
+	}
+
+	native := chunk.Object == ObjectTextCompletion
+	choices := []CompletionChoice{}
+	for _, choice := range chunk.Choices {
+		text := choice.Delta.Content
+		logprobs := choice.Logprobs
+		if !native {
+			offset, seen := c.offsets[choice.Index]
+			if !seen && c.options != nil && c.options.Echo {
+				prompt, _ := c.options.ChatPrompt()
+				text = prompt + text
+				offset = utf8.RuneCountInString(prompt)
+			}
+			logprobs, _ = toLegacyLogprobs(choice.Logprobs, offset)
+			c.offsets[choice.Index] = offset + utf8.RuneCountInString(choice.Delta.Content)
+		}
+		if text == "" && choice.FinishReason == "" && logprobs == nil {
+			continue
+		}
+
+		var finishReason *string
+		if choice.FinishReason != "" {
+			reason := choice.FinishReason
+			finishReason = &reason
+		}
+		choices = append(choices, CompletionChoice{
+			Text:         text,
+			Index:        choice.Index,
+			Logprobs:     logprobs,
+			FinishReason: finishReason,
+		})
+	}
+	if len(choices) == 0 {
+		return nil
+	}
+	return []*SSEEvent{c.chunk(choices, nil)}
+}
+
+// Finish 客户端请求了 usage 时输出 usage 块，最后输出 [DONE]
+func (c *CompletionStreamConverter) Finish(usage Usage) []*SSEEvent {
+	if c.finished {
+		return nil
+	}
+	c.finished = true
+
+	var events []*SSEEvent
+	if c.includeUsage {
+		events = append(events, c.chunk([]CompletionChoice{}, &usage))
+	}
+	return append(events, &SSEEvent{Data: "[DONE]", HasData: true, Retry: -1})
+}
@@ -59,36 +59,15 @@ func DetectPlatform(baseURL, platform string) Platform {
 type FormatType string
 
 const (
-	FormatOpenAI    FormatType = "openai"
-	FormatDeepSeek  FormatType = "deepseek"
-	FormatGemini    FormatType = "gemini"
-	FormatClaude    FormatType = "claude"
-	FormatUnknown   FormatType = "unknown"
+	FormatOpenAI      FormatType = "openai"
+	FormatDeepSeek    FormatType = "deepseek"
+	FormatGemini      FormatType = "gemini"
+	FormatClaude      FormatType = "claude"
+	FormatResponses   FormatType = "responses"   // OpenAI Responses API，只由 /v1/responses 路由使用
+	FormatCompletions FormatType = "completions" // 旧版文本补全，只由 /v1/completions 路由使用
+	FormatUnknown     FormatType = "unknown"
 )
 
-// DetectInputFormat 检测输入请求的格式
-func DetectInputFormat(body []byte) FormatType {
-	var req map[string]interface{}
-	if err := json.Unmarshal(body, &req); err != nil {
-		return FormatUnknown
-	}
-
-	// 检查 Gemini 特有字段
-	if _, hasContents := req["contents"]; hasContents {
-		return FormatGemini
-	}
-
-	// 检查 Claude 特有字段
-	if _, hasSystem := req["system"]; hasSystem {
-		if _, hasMaxTokens := req["max_tokens"]; hasMaxTokens {
-			return FormatClaude
-		}
-	}
-
-	// 默认为 OpenAI 格式
-	return FormatOpenAI
-}
-
 // UnifiedRequest 统一的内部请求格式
 // 这是所有格式的"全集"，包含所有可能的字段
 type UnifiedRequest struct {
@@ -116,14 +95,14 @@ type UnifiedRequest struct {
 	// 工具调用
 	Tools               []Tool               `json:"tools,omitempty"`
 	ToolChoice          interface{}          `json:"tool_choice,omitempty"`
-	ParallelToolCalls   bool                 `json:"parallel_tool_calls,omitempty"`
+	ParallelToolCalls   *bool                `json:"parallel_tool_calls,omitempty"`
 
 	// 响应格式
 	ResponseFormat      *ResponseFormat      `json:"response_format,omitempty"`
 
 	// 其他常用字段
 	User                string               `json:"user,omitempty"`
-	Seed                float64              `json:"seed,omitempty"`
+	Seed                *int64               `json:"seed,omitempty"`
 	LogProbs            bool                 `json:"logprobs,omitempty"`
 	TopLogProbs         int                  `json:"top_logprobs,omitempty"`
 
@@ -131,13 +110,23 @@ type UnifiedRequest struct {
 	PromptCacheKey      string               `json:"prompt_cache_key,omitempty"`
 	PromptCacheRetention json.RawMessage      `json:"prompt_cache_retention,omitempty"`
 
-	// 预留扩展字段（使用 json.RawMessage 保留原始 JSON）
+	// 旧版文本补全（/v1/completions）特有的字段，其他入口为 nil
+	Completion          *CompletionOptions   `json:"completion,omitempty"`
+
+	// 统一格式无法识别的字段（使用 json.RawMessage 保留原始 JSON），只转发给与 ExtraFormat 同系的上游
 	ExtraFields         map[string]json.RawMessage `json:"-"`
+	ExtraFormat         FormatType           `json:"-"`
+
+	// 原始 OpenAI 请求体，只由 OpenAIToUnified 设置；修改消息时需要清空，见 OpenAIFastPath
+	Raw                 []byte               `json:"-"`
 }
 
 type UnifiedMessage struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"`
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	Name       string      `json:"name,omitempty"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`   // assistant 消息发起的工具调用
+	ToolCallID string      `json:"tool_call_id,omitempty"` // tool 消息对应的工具调用
 }
 
 type ThinkingConfig struct {
@@ -145,10 +134,13 @@ type ThinkingConfig struct {
 	Effort  string `json:"effort,omitempty"` // "low" | "medium" | "high"
 }
 
-// ConvertToUnified 将任意格式的请求转换为统一格式
+// ConvertToUnified 将任意格式的请求转换为统一格式，格式按请求体内容判断
 func ConvertToUnified(body []byte) (*UnifiedRequest, error) {
-	format := DetectInputFormat(body)
+	return ConvertFormatToUnified(DetectInputFormat(body), body)
+}
 
+// ConvertFormatToUnified 按指定格式将请求转换为统一格式
+func ConvertFormatToUnified(format FormatType, body []byte) (*UnifiedRequest, error) {
 	switch format {
 	case FormatGemini:
 		return GeminiToUnified(body)
@@ -161,328 +153,130 @@ func ConvertToUnified(body []byte) (*UnifiedRequest, error) {
 	}
 }
 
-// OpenAIToUnified 将 OpenAI 格式转换为统一格式
-func OpenAIToUnified(body []byte) (*UnifiedRequest, error) {
-	var req map[string]interface{}
-	if err := json.Unmarshal(body, &req); err != nil {
-		return nil, fmt.Errorf("failed to parse OpenAI request: %w", err)
-	}
-
-	unified := &UnifiedRequest{
-		Model: reqString(req, "model"),
-		Stream: reqBool(req, "stream"),
-	}
-
-	// 解析 messages
-	if msgs, ok := req["messages"].([]interface{}); ok {
-		for _, msg := range msgs {
-			if msgMap, ok := msg.(map[string]interface{}); ok {
-				unified.Messages = append(unified.Messages, UnifiedMessage{
-					Role:    reqString(msgMap, "role"),
-					Content: msgMap["content"],
-				})
-			}
-		}
-	}
-
-	// 数值字段
-	if v, ok := req["max_tokens"].(float64); ok {
-		unified.MaxTokens = int(v)
-	}
-	if v, ok := req["max_completion_tokens"].(float64); ok {
-		unified.MaxCompletionTokens = int(v)
-	}
-	if v, ok := req["temperature"].(float64); ok {
-		unified.Temperature = &v
-	}
-	if v, ok := req["top_p"].(float64); ok {
-		unified.TopP = &v
-	}
-	if v, ok := req["top_k"].(float64); ok {
-		unified.TopK = int(v)
-	}
-	if v, ok := req["n"].(float64); ok {
-		unified.N = int(v)
-	}
-	if v, ok := req["presence_penalty"].(float64); ok {
-		unified.PresencePenalty = &v
-	}
-	if v, ok := req["frequency_penalty"].(float64); ok {
-		unified.FrequencyPenalty = &v
-	}
-
-	// 其他字段
-	unified.Stop = req["stop"]
-	unified.ToolChoice = req["tool_choice"]
-	if req["user"] != nil {
-		unified.User = reqString(req, "user")
-	}
-
-	// stream_options
-	if so, ok := req["stream_options"].(map[string]interface{}); ok {
-		if include, ok := so["include_usage"].(bool); ok {
-			unified.StreamOptions = &StreamOptions{IncludeUsage: include}
-		}
-	}
-
-	// prompt_cache_key
-	if req["prompt_cache_key"] != nil {
-		unified.PromptCacheKey = reqString(req, "prompt_cache_key")
-	}
-
-	// reasoning_effort
-	if reasoningEffort := reqString(req, "reasoning_effort"); reasoningEffort != "" {
-		unified.ReasoningEffort = reasoningEffort
-	}
-
-	// Tools 解析（简化处理）
-	if tools, ok := req["tools"].([]interface{}); ok {
-		for _, tool := range tools {
-			if toolMap, ok := tool.(map[string]interface{}); ok {
-				if toolMap["type"] == "function" {
-					if funcMap, ok := toolMap["function"].(map[string]interface{}); ok {
-						var params map[string]interface{}
-						if p, ok := funcMap["parameters"].(map[string]interface{}); ok {
-							params = p
-						}
-						unified.Tools = append(unified.Tools, Tool{
-							Type: "function",
-							Function: FunctionDefinition{
-								Name:       reqString(funcMap, "name"),
-								Description: reqString(funcMap, "description"),
-								Parameters:  params,
-							},
-						})
-					}
-				}
-			}
-		}
-	}
-
-	return unified, nil
+// openAIChatRequest OpenAIToUnified 解析的请求字段
+type openAIChatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role       string      `json:"role"`
+		Content    interface{} `json:"content"`
+		Name       string      `json:"name"`
+		ToolCalls  []ToolCall  `json:"tool_calls"`
+		ToolCallID string      `json:"tool_call_id"`
+	} `json:"messages"`
+	MaxTokens            looseInt        `json:"max_tokens"`
+	MaxCompletionTokens  looseInt        `json:"max_completion_tokens"`
+	Temperature          *float64        `json:"temperature"`
+	TopP                 *float64        `json:"top_p"`
+	TopK                 looseInt        `json:"top_k"`
+	N                    looseInt        `json:"n"`
+	Stream               bool            `json:"stream"`
+	StreamOptions        *StreamOptions  `json:"stream_options"`
+	Stop                 interface{}     `json:"stop"`
+	PresencePenalty      *float64        `json:"presence_penalty"`
+	FrequencyPenalty     *float64        `json:"frequency_penalty"`
+	ReasoningEffort      string          `json:"reasoning_effort"`
+	Tools                []Tool          `json:"tools"`
+	ToolChoice           interface{}     `json:"tool_choice"`
+	ParallelToolCalls    *bool           `json:"parallel_tool_calls"`
+	ResponseFormat       *ResponseFormat `json:"response_format"`
+	User                 string          `json:"user"`
+	Seed                 looseInt        `json:"seed"`
+	LogProbs             bool            `json:"logprobs"`
+	TopLogProbs          looseInt        `json:"top_logprobs"`
+	PromptCacheKey       string          `json:"prompt_cache_key"`
+	PromptCacheRetention json.RawMessage `json:"prompt_cache_retention"`
 }
 
-// Helper function to safely get string value from map
-func reqString(m map[string]interface{}, key string) string {
-	v, ok := m[key]
-	if !ok || v == nil {
-		return ""
-	}
-	if s, ok := v.(string); ok {
-		return s
-	}
-	return ""
+// looseInt 宽松解析的整数字段：接受整数和 100.0 这样的小数形式，小数部分被截断
+// null 和其他类型的值按未设置处理，与按 map 解析请求时的行为一致
+type looseInt struct {
+	value int64
+	set   bool
 }
 
-// Helper function to safely get bool value from map
-func reqBool(m map[string]interface{}, key string) bool {
-	v, ok := m[key]
-	if !ok || v == nil {
-		return false
+func (n *looseInt) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if json.Unmarshal(data, &number) != nil || number == "" {
+		return nil
 	}
-	if b, ok := v.(bool); ok {
-		return b
+	if value, err := number.Int64(); err == nil {
+		n.value, n.set = value, true
+	} else if value, err := number.Float64(); err == nil {
+		n.value, n.set = int64(value), true
 	}
-	return false
+	return nil
 }
 
-// GeminiToUnified 将 Gemini 格式转换为统一格式
-func GeminiToUnified(body []byte) (*UnifiedRequest, error) {
-	var geminiReq struct {
-		Model         string `json:"model"`
-		Contents      []GeminiContent `json:"contents"`
-		GenerationConfig struct {
-			Temperature float64 `json:"temperature,omitempty"`
-			MaxTokens   int     `json:"maxOutputTokens,omitempty"`
-			TopP        float64 `json:"topP,omitempty"`
-		} `json:"generationConfig,omitempty"`
-		ThinkingConfig *struct {
-			IncludeThoughts bool   `json:"includeThoughts,omitempty"`
-			ThinkingEffort  string `json:"thinkingEffort,omitempty"` // "low" | "medium" | "high"
-		} `json:"thinkingConfig,omitempty"`
-	}
-
-	if err := json.Unmarshal(body, &geminiReq); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini request: %w", err)
-	}
-
-	unified := &UnifiedRequest{
-		Model:     geminiReq.Model,
-		MaxTokens: geminiReq.GenerationConfig.MaxTokens,
-	}
-
-	// 正确处理指针类型
-	if geminiReq.GenerationConfig.Temperature > 0 {
-		unified.Temperature = &geminiReq.GenerationConfig.Temperature
-	}
-	if geminiReq.GenerationConfig.TopP > 0 {
-		unified.TopP = &geminiReq.GenerationConfig.TopP
-	}
-
-	// 转换思考配置
-	if geminiReq.ThinkingConfig != nil && geminiReq.ThinkingConfig.IncludeThoughts {
-		unified.ThinkingConfig = &ThinkingConfig{
-			Enabled: true,
-			Effort:  geminiReq.ThinkingConfig.ThinkingEffort,
-		}
-	}
-
-	// 转换消息
-	for _, content := range geminiReq.Contents {
-		role := content.Role
-		if role == "user" {
-			role = "user"
-		} else if role == "model" {
-			role = "assistant"
-		}
-
-		// 处理 parts
-		var contentParts []interface{}
-		var textContent strings.Builder
-
-		for _, part := range content.Parts {
-			if part.Text != "" {
-				// 如果只有文本，合并为单一字符串
-				contentParts = nil
-				textContent.WriteString(part.Text)
-			}
-			if part.ExecutableCode != nil {
-				contentParts = append(contentParts, map[string]interface{}{
-					"type": "code",
-					"code": part.ExecutableCode.Code,
-				})
-			}
-		}
-
-		var finalContent interface{}
-		if len(contentParts) > 0 && textContent.Len() > 0 {
-			// 混合内容
-			finalContent = append([]interface{}{
-				map[string]interface{}{"type": "text", "text": textContent.String()},
-			}, contentParts...)
-		} else if len(contentParts) > 0 {
-			finalContent = contentParts
-		} else {
-			finalContent = textContent.String()
-		}
+// Int 返回整数值，未设置时为 0
+func (n looseInt) Int() int {
+	return int(n.value)
+}
 
-		unified.Messages = append(unified.Messages, UnifiedMessage{
-			Role:    role,
-			Content: finalContent,
-		})
+// Ptr 返回整数值的指针，未设置时为 nil
+func (n looseInt) Ptr() *int64 {
+	if !n.set {
+		return nil
 	}
-
-	return unified, nil
+	value := n.value
+	return &value
 }
 
-// ClaudeToUnified 将 Claude 格式转换为统一格式
-func ClaudeToUnified(body []byte) (*UnifiedRequest, error) {
-	var claudeReq struct {
-		Model     string `json:"model"`
-		MaxTokens int    `json:"max_tokens"`
-		Messages  []struct {
-			Role    string `json:"role"`
-			Content interface{} `json:"content"`
-		} `json:"messages"`
-		System          string  `json:"system,omitempty"`
-		Temperature     float64 `json:"temperature,omitempty"`
-		TopP            float64 `json:"top_p,omitempty"`
-		Stream          bool    `json:"stream,omitempty"`
-		Stop            interface{} `json:"stop,omitempty"`
-		ThinkingEnabled *bool   `json:"thinking_enabled,omitempty"`
-		ThinkingBudget  int     `json:"thinking_budget,omitempty"`
-		Tools           []struct {
-			Name        string                 `json:"name"`
-			Description string                 `json:"description,omitempty"`
-			InputSchema map[string]interface{} `json:"input_schema,omitempty"`
-		} `json:"tools,omitempty"`
-	}
-
-	if err := json.Unmarshal(body, &claudeReq); err != nil {
-		return nil, fmt.Errorf("failed to parse Claude request: %w", err)
+// OpenAIToUnified 将 OpenAI 格式转换为统一格式
+// 统一格式无法识别的顶层字段保存在 ExtraFields 中，转发给兼容 OpenAI 的上游；原始请求体保存在 Raw 中供 OpenAIFastPath 使用
+func OpenAIToUnified(body []byte) (*UnifiedRequest, error) {
+	var req openAIChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAI request: %w", err)
 	}
 
 	unified := &UnifiedRequest{
-		Model:     claudeReq.Model,
-		MaxTokens: claudeReq.MaxTokens,
-		Stream:    claudeReq.Stream,
-		Stop:      claudeReq.Stop,
-	}
-
-	// 正确处理指针类型
-	if claudeReq.Temperature > 0 {
-		unified.Temperature = &claudeReq.Temperature
-	}
-	if claudeReq.TopP > 0 {
-		unified.TopP = &claudeReq.TopP
-	}
-
-	// 转换消息
-	for _, msg := range claudeReq.Messages {
+		Model:                req.Model,
+		MaxTokens:            req.MaxTokens.Int(),
+		MaxCompletionTokens:  req.MaxCompletionTokens.Int(),
+		Temperature:          req.Temperature,
+		TopP:                 req.TopP,
+		TopK:                 req.TopK.Int(),
+		N:                    req.N.Int(),
+		Stream:               req.Stream,
+		StreamOptions:        req.StreamOptions,
+		Stop:                 req.Stop,
+		PresencePenalty:      req.PresencePenalty,
+		FrequencyPenalty:     req.FrequencyPenalty,
+		ReasoningEffort:      req.ReasoningEffort,
+		ToolChoice:           req.ToolChoice,
+		ParallelToolCalls:    req.ParallelToolCalls,
+		ResponseFormat:       req.ResponseFormat,
+		User:                 req.User,
+		Seed:                 req.Seed.Ptr(),
+		LogProbs:             req.LogProbs,
+		TopLogProbs:          req.TopLogProbs.Int(),
+		PromptCacheKey:       req.PromptCacheKey,
+		PromptCacheRetention: req.PromptCacheRetention,
+		ExtraFields:          extraFields(body, openAIFields),
+		ExtraFormat:          FormatOpenAI,
+		Raw:                  body,
+	}
+
+	for _, msg := range req.Messages {
 		unified.Messages = append(unified.Messages, UnifiedMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
 		})
 	}
 
-	// 如果有 system 消息，添加到开头
-	if claudeReq.System != "" {
-		systemMsg := UnifiedMessage{
-			Role:    "system",
-			Content: claudeReq.System,
-		}
-		unified.Messages = append([]UnifiedMessage{systemMsg}, unified.Messages...)
-	}
-
-	// 转换思考配置
-	if claudeReq.ThinkingEnabled != nil && *claudeReq.ThinkingEnabled {
-		effort := "medium"
-		if claudeReq.ThinkingBudget > 0 {
-			if claudeReq.ThinkingBudget <= 1000 {
-				effort = "low"
-			} else if claudeReq.ThinkingBudget >= 20000 {
-				effort = "high"
-			}
-		}
-		unified.ThinkingConfig = &ThinkingConfig{
-			Enabled: true,
-			Effort:  effort,
+	// 只保留函数工具
+	for _, tool := range req.Tools {
+		if tool.Type == "function" {
+			unified.Tools = append(unified.Tools, tool)
 		}
 	}
 
-	// 转换工具
-	for _, tool := range claudeReq.Tools {
-		unified.Tools = append(unified.Tools, Tool{
-			Type: "function",
-			Function: FunctionDefinition{
-				Name:        tool.Name,
-				Description: tool.Description,
-				Parameters:  tool.InputSchema,
-			},
-		})
-	}
-
 	return unified, nil
 }
 
-// Types for Gemini
-type GeminiContent struct {
-	Role  string        `json:"role"`
-	Parts []GeminiPart  `json:"parts"`
-}
-
-type GeminiPart struct {
-	Text            string              `json:"text,omitempty"`
-	ExecutableCode   *GeminiExecutableCode `json:"executableCode,omitempty"`
-	FunctionCall     interface{}         `json:"functionCall,omitempty"`
-	FunctionResponse interface{}         `json:"functionResponse,omitempty"`
-}
-
-type GeminiExecutableCode struct {
-	Language string `json:"language,omitempty"`
-	Code     string `json:"code,omitempty"`
-}
-
 // ConvertFromUnified 从统一格式转换为目标平台格式
 func ConvertFromUnified(unified *UnifiedRequest, targetPlatform Platform) ([]byte, error) {
 	switch targetPlatform {
@@ -509,6 +303,9 @@ func UnifiedToOpenAI(unified *UnifiedRequest) ([]byte, error) {
 	if unified.MaxTokens > 0 {
 		result["max_tokens"] = unified.MaxTokens
 	}
+	if unified.MaxCompletionTokens > 0 {
+		result["max_completion_tokens"] = unified.MaxCompletionTokens
+	}
 	if unified.Temperature != nil {
 		result["temperature"] = *unified.Temperature
 	}
@@ -517,6 +314,9 @@ func UnifiedToOpenAI(unified *UnifiedRequest) ([]byte, error) {
 	}
 	if unified.Stream {
 		result["stream"] = unified.Stream
+		if unified.StreamOptions != nil {
+			result["stream_options"] = unified.StreamOptions
+		}
 	}
 	if unified.Stop != nil {
 		result["stop"] = unified.Stop
@@ -533,12 +333,42 @@ func UnifiedToOpenAI(unified *UnifiedRequest) ([]byte, error) {
 	if unified.ToolChoice != nil {
 		result["tool_choice"] = unified.ToolChoice
 	}
+	if unified.ParallelToolCalls != nil {
+		result["parallel_tool_calls"] = *unified.ParallelToolCalls
+	}
+	if unified.ResponseFormat != nil {
+		result["response_format"] = unified.ResponseFormat
+	}
+	if unified.N > 1 {
+		result["n"] = unified.N
+	}
+	if unified.LogProbs {
+		result["logprobs"] = true
+		if unified.TopLogProbs > 0 {
+			result["top_logprobs"] = unified.TopLogProbs
+		}
+	}
+	if unified.Seed != nil {
+		result["seed"] = *unified.Seed
+	}
+	if unified.User != "" {
+		result["user"] = unified.User
+	}
+	if unified.PromptCacheKey != "" {
+		result["prompt_cache_key"] = unified.PromptCacheKey
+	}
+	if len(unified.PromptCacheRetention) > 0 {
+		result["prompt_cache_retention"] = unified.PromptCacheRetention
+	}
 
-	// 处理思考配置 (OpenAI reasoning_effort)
-	if unified.ThinkingConfig != nil && unified.ThinkingConfig.Enabled {
+	// 处理思考配置 (OpenAI reasoning_effort)，客户端直接指定的 reasoning_effort 优先
+	if unified.ReasoningEffort != "" {
+		result["reasoning_effort"] = unified.ReasoningEffort
+	} else if unified.ThinkingConfig != nil && unified.ThinkingConfig.Enabled {
 		result["reasoning_effort"] = unified.ThinkingConfig.Effort
 	}
 
+	addExtraFields(result, unified, FormatOpenAI)
 	return json.Marshal(result)
 }
 
@@ -556,6 +386,15 @@ func UnifiedToDeepSeek(unified *UnifiedRequest) ([]byte, error) {
 			"role":    msg.Role,
 			"content": normalizeContentForDeepSeek(msg.Content),
 		}
+		if len(msg.ToolCalls) > 0 {
+			messages[i]["tool_calls"] = msg.ToolCalls
+		}
+		if msg.ToolCallID != "" {
+			messages[i]["tool_call_id"] = msg.ToolCallID
+		}
+		if msg.Name != "" {
+			messages[i]["name"] = msg.Name
+		}
 	}
 	result["messages"] = messages
 
@@ -580,9 +419,26 @@ func UnifiedToDeepSeek(unified *UnifiedRequest) ([]byte, error) {
 	if unified.FrequencyPenalty != nil {
 		result["frequency_penalty"] = *unified.FrequencyPenalty
 	}
+	if len(unified.Tools) > 0 {
+		result["tools"] = unified.Tools
+	}
+	if unified.ToolChoice != nil {
+		result["tool_choice"] = unified.ToolChoice
+	}
+	// DeepSeek 只支持 JSON 模式，json_schema 降级为 json_object
+	if unified.ResponseFormat.IsJSON() {
+		result["response_format"] = ResponseFormat{Type: "json_object"}
+	}
+	if unified.LogProbs {
+		result["logprobs"] = true
+		if unified.TopLogProbs > 0 {
+			result["top_logprobs"] = unified.TopLogProbs
+		}
+	}
 
-	// DeepSeek 不支持流式选项和其他高级参数
+	// DeepSeek 不支持流式选项和其他高级参数，客户端以 OpenAI 格式显式传入的字段仍原样转发
 
+	addExtraFields(result, unified, FormatOpenAI)
 	return json.Marshal(result)
 }
 
@@ -609,6 +465,18 @@ func UnifiedToClaude(unified *UnifiedRequest) ([]byte, error) {
 		result["stop"] = unified.Stop
 	}
 
+	// Claude 不支持 response_format，结构化输出通过强制调用工具实现，见 UsesStructuredOutputTool
+	if unified.ResponseFormat.IsJSON() {
+		result["tools"], result["tool_choice"] = structuredOutputTools(unified)
+	} else {
+		if len(unified.Tools) > 0 {
+			result["tools"] = unified.Tools
+		}
+		if unified.ToolChoice != nil {
+			result["tool_choice"] = unified.ToolChoice
+		}
+	}
+
 	// Claude 思考模式
 	if unified.ThinkingConfig != nil && unified.ThinkingConfig.Enabled {
 		enabled := true
@@ -622,6 +490,7 @@ func UnifiedToClaude(unified *UnifiedRequest) ([]byte, error) {
 		result["thinking_budget"] = budget
 	}
 
+	addExtraFields(result, unified, FormatClaude)
 	return json.Marshal(result)
 }
 
@@ -637,14 +506,18 @@ func UnifiedToGemini(unified *UnifiedRequest) ([]byte, error) {
 		Parts []GeminiPart `json:"parts"`
 	}
 
+	type GeminiGenerationConfig struct {
+		Temperature      float64                `json:"temperature,omitempty"`
+		MaxTokens        int                    `json:"maxOutputTokens,omitempty"`
+		TopP             float64                `json:"topP,omitempty"`
+		TopK             int                    `json:"topK,omitempty"`
+		ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+		ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`
+	}
+
 	type GeminiRequest struct {
-		Contents          []GeminiContent `json:"contents"`
-		GenerationConfig  *struct {
-			Temperature float64 `json:"temperature,omitempty"`
-			MaxTokens   int     `json:"maxOutputTokens,omitempty"`
-			TopP        float64 `json:"topP,omitempty"`
-			TopK        int     `json:"topK,omitempty"`
-		} `json:"generationConfig,omitempty"`
+		Contents         []GeminiContent         `json:"contents"`
+		GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
 	}
 
 	req := GeminiRequest{
@@ -653,15 +526,10 @@ func UnifiedToGemini(unified *UnifiedRequest) ([]byte, error) {
 
 	// 如果有参数，创建 generationConfig
 	hasConfig := unified.Temperature != nil || unified.MaxTokens > 0 ||
-		unified.TopP != nil || unified.TopK > 0
+		unified.TopP != nil || unified.TopK > 0 || unified.ResponseFormat.IsJSON()
 
 	if hasConfig {
-		req.GenerationConfig = &struct {
-			Temperature float64 `json:"temperature,omitempty"`
-			MaxTokens   int     `json:"maxOutputTokens,omitempty"`
-			TopP        float64 `json:"topP,omitempty"`
-			TopK        int     `json:"topK,omitempty"`
-		}{}
+		req.GenerationConfig = &GeminiGenerationConfig{}
 
 		if unified.Temperature != nil {
 			req.GenerationConfig.Temperature = *unified.Temperature
@@ -675,6 +543,13 @@ func UnifiedToGemini(unified *UnifiedRequest) ([]byte, error) {
 		if unified.TopK > 0 {
 			req.GenerationConfig.TopK = unified.TopK
 		}
+		// 结构化输出：JSON 模式对应 responseMimeType，JSON Schema 转换为 responseSchema
+		if unified.ResponseFormat.IsJSON() {
+			req.GenerationConfig.ResponseMimeType = "application/json"
+			if schema := unified.ResponseFormat.Schema(); schema != nil {
+				req.GenerationConfig.ResponseSchema = geminiResponseSchema(schema)
+			}
+		}
 	}
 
 	// 转换消息
@@ -704,7 +579,11 @@ func UnifiedToGemini(unified *UnifiedRequest) ([]byte, error) {
 		req.Contents = append(req.Contents, content)
 	}
 
-	return json.Marshal(req)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtraFields(body, unified, FormatGemini)
 }
 
 // extractTextFromContent 从 content 中提取文本（支持多种格式）
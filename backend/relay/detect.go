@@ -0,0 +1,190 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 请求格式的判断依据
+const (
+	DetectByRoute   = "route"   // 路由固定了格式
+	DetectByHeader  = "header"  // 请求头指定或暗示了格式
+	DetectByContent = "content" // 按请求体内容判断
+)
+
+// Detection 请求格式的判断结果和依据
+type Detection struct {
+	Format  FormatType              `json:"format"`
+	Source  string                  `json:"source"`
+	Reason  string                  `json:"reason"`
+	Signals map[FormatType][]string `json:"signals,omitempty"` // 请求体中各格式特有的字段
+}
+
+// DetectInputFormat 按请求体内容判断请求格式，见 ClassifyInputFormat
+func DetectInputFormat(body []byte) FormatType {
+	return ClassifyInputFormat(body).Format
+}
+
+// ClassifyInputFormat 按请求体内容判断请求格式
+// 只根据各格式特有的字段判断：单独的顶层 system 或 max_tokens 不足以认定为 Claude，
+// 同时出现多种格式特有字段时按 OpenAI 处理；无法确定时也按 OpenAI 处理
+func ClassifyInputFormat(body []byte) Detection {
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return Detection{Format: FormatUnknown, Source: DetectByContent, Reason: "request body is not a JSON object"}
+	}
+
+	signals := map[FormatType][]string{}
+	add := func(format FormatType, signal string) {
+		for _, existing := range signals[format] {
+			if existing == signal {
+				return
+			}
+		}
+		signals[format] = append(signals[format], signal)
+	}
+	collectGeminiSignals(req, add)
+	collectClaudeSignals(req, add)
+	collectOpenAISignals(req, add)
+
+	detection := Detection{Source: DetectByContent, Signals: signals}
+	_, hasMessages := req["messages"]
+	gemini, claude, openai := len(signals[FormatGemini]) > 0, len(signals[FormatClaude]) > 0, len(signals[FormatOpenAI]) > 0
+	switch {
+	case gemini && !hasMessages && !claude:
+		detection.Format = FormatGemini
+		detection.Reason = "Gemini-only fields: " + strings.Join(signals[FormatGemini], ", ")
+	case claude && !openai && !gemini:
+		detection.Format = FormatClaude
+		detection.Reason = "Claude-only fields: " + strings.Join(signals[FormatClaude], ", ")
+	case gemini || claude:
+		detection.Format = FormatOpenAI
+		detection.Reason = "fields of several formats present, defaulting to OpenAI"
+	case openai:
+		detection.Format = FormatOpenAI
+		detection.Reason = "OpenAI-only fields: " + strings.Join(signals[FormatOpenAI], ", ")
+	default:
+		detection.Format = FormatOpenAI
+		detection.Reason = "no format-specific fields, defaulting to OpenAI"
+	}
+	if _, ok := req["system"]; ok && detection.Format == FormatOpenAI && !claude {
+		detection.Reason += "; a top-level system string alone is ambiguous, send anthropic-version or X-Elysia-Format: claude for Claude requests"
+	}
+	return detection
+}
+
+// rawObjects 将 JSON 数组解析为对象列表，不是数组时返回 nil
+func rawObjects(raw json.RawMessage) []map[string]json.RawMessage {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+	return items
+}
+
+// rawString 将 JSON 值解析为字符串，不是字符串时返回 false
+func rawString(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+func collectGeminiSignals(req map[string]json.RawMessage, add func(FormatType, string)) {
+	for _, content := range rawObjects(req["contents"]) {
+		if _, ok := content["parts"]; ok {
+			add(FormatGemini, "contents[].parts")
+		}
+	}
+	for _, field := range []string{"systemInstruction", "system_instruction", "generationConfig", "generation_config", "safetySettings", "toolConfig"} {
+		if _, ok := req[field]; ok {
+			add(FormatGemini, field)
+		}
+	}
+	for _, tool := range rawObjects(req["tools"]) {
+		if _, ok := tool["functionDeclarations"]; ok {
+			add(FormatGemini, "tools[].functionDeclarations")
+		}
+	}
+}
+
+// claudeOnlyBlocks 只在 Claude 消息中出现的内容块类型
+var claudeOnlyBlocks = map[string]bool{
+	"tool_use": true, "tool_result": true, "thinking": true, "redacted_thinking": true, "document": true,
+}
+
+func collectClaudeSignals(req map[string]json.RawMessage, add func(FormatType, string)) {
+	for _, field := range []string{"stop_sequences", "anthropic_version"} {
+		if _, ok := req[field]; ok {
+			add(FormatClaude, field)
+		}
+	}
+	var thinking struct {
+		Type string `json:"type"`
+	}
+	if raw, ok := req["thinking"]; ok && json.Unmarshal(raw, &thinking) == nil && thinking.Type != "" {
+		add(FormatClaude, "thinking.type")
+	}
+	// 数组形式的 system 是 Claude 特有的；字符串形式无法区分
+	if blocks := rawObjects(req["system"]); len(blocks) > 0 {
+		add(FormatClaude, "system[] blocks")
+	}
+	for _, tool := range rawObjects(req["tools"]) {
+		if _, ok := tool["input_schema"]; ok {
+			add(FormatClaude, "tools[].input_schema")
+		}
+	}
+	var choice struct {
+		Type string `json:"type"`
+	}
+	if raw, ok := req["tool_choice"]; ok && json.Unmarshal(raw, &choice) == nil && choice.Type != "" && choice.Type != "function" {
+		add(FormatClaude, "tool_choice.type="+choice.Type)
+	}
+	for _, msg := range rawObjects(req["messages"]) {
+		for _, block := range rawObjects(msg["content"]) {
+			blockType, _ := rawString(block["type"])
+			_, hasSource := block["source"]
+			if claudeOnlyBlocks[blockType] || (blockType == "image" && hasSource) {
+				add(FormatClaude, "messages[].content[].type="+blockType)
+			}
+		}
+	}
+}
+
+// openAIOnlyRoles 只在 OpenAI 消息中出现的角色
+var openAIOnlyRoles = map[string]bool{"system": true, "developer": true, "tool": true, "function": true}
+
+func collectOpenAISignals(req map[string]json.RawMessage, add func(FormatType, string)) {
+	for _, field := range []string{"response_format", "stream_options", "max_completion_tokens", "n", "logprobs", "reasoning_effort", "parallel_tool_calls"} {
+		if _, ok := req[field]; ok {
+			add(FormatOpenAI, field)
+		}
+	}
+	for _, tool := range rawObjects(req["tools"]) {
+		if _, ok := tool["function"]; ok {
+			add(FormatOpenAI, "tools[].function")
+		}
+	}
+	if raw, ok := req["tool_choice"]; ok {
+		if mode, ok := rawString(raw); ok && mode == "required" {
+			add(FormatOpenAI, "tool_choice=required")
+		}
+	}
+	for _, msg := range rawObjects(req["messages"]) {
+		if role, _ := rawString(msg["role"]); openAIOnlyRoles[role] {
+			add(FormatOpenAI, fmt.Sprintf("messages[].role=%s", role))
+		}
+		for _, field := range []string{"tool_calls", "tool_call_id", "name"} {
+			if _, ok := msg[field]; ok {
+				add(FormatOpenAI, "messages[]."+field)
+			}
+		}
+		for _, part := range rawObjects(msg["content"]) {
+			if partType, _ := rawString(part["type"]); partType == "image_url" || partType == "input_audio" || partType == "file" {
+				add(FormatOpenAI, "messages[].content[].type="+partType)
+			}
+		}
+	}
+}
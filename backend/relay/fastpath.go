@@ -0,0 +1,41 @@
+package relay
+
+// OpenAIFastPath 请求来自 OpenAI 格式、目标上游兼容 OpenAI 且消息未被修改时，
+// 直接在原始请求体上替换网关管理的字段（模型名、流式选项和被裁剪的输出上限）并删除不允许透传的字段，
+// 不重新编码 messages，也不会丢失统一格式无法表示的内容
+// 不满足条件时返回 false，需要用 ConvertFromUnified 完整转换
+func OpenAIFastPath(unified *UnifiedRequest, platform Platform) ([]byte, bool) {
+	if unified.Raw == nil || unified.Completion != nil {
+		return nil, false
+	}
+	// DeepSeek 需要改写消息内容，其他平台使用各自的请求格式
+	switch platform {
+	case PlatformOpenAI, PlatformAzure, PlatformUnknown:
+	default:
+		return nil, false
+	}
+
+	set := map[string]interface{}{"model": unified.Model}
+	if unified.MaxTokens > 0 {
+		set["max_tokens"] = unified.MaxTokens
+	}
+	if unified.MaxCompletionTokens > 0 {
+		set["max_completion_tokens"] = unified.MaxCompletionTokens
+	}
+	if unified.Stream && unified.StreamOptions != nil {
+		set["stream_options"] = unified.StreamOptions
+	}
+	keep := func(field string) bool {
+		if openAIFields[field] {
+			return true
+		}
+		_, ok := unified.ExtraFields[field]
+		return ok
+	}
+
+	body, err := patchObject(unified.Raw, set, keep)
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,582 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types for Gemini
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"` // 思考内容
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+	ExecutableCode   *GeminiExecutableCode   `json:"executableCode,omitempty"`
+}
+
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type GeminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type GeminiExecutableCode struct {
+	Language string `json:"language,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	IncludeThoughts bool   `json:"includeThoughts,omitempty"`
+	ThinkingBudget  *int   `json:"thinkingBudget,omitempty"`
+	ThinkingEffort  string `json:"thinkingEffort,omitempty"` // "low" | "medium" | "high"
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64               `json:"temperature,omitempty"`
+	TopP             *float64               `json:"topP,omitempty"`
+	TopK             int                    `json:"topK,omitempty"`
+	MaxOutputTokens  int                    `json:"maxOutputTokens,omitempty"`
+	CandidateCount   int                    `json:"candidateCount,omitempty"`
+	StopSequences    []string               `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64               `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64               `json:"frequencyPenalty,omitempty"`
+	Seed             *int64                 `json:"seed,omitempty"`
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`
+	ThinkingConfig   *geminiThinkingConfig  `json:"thinkingConfig,omitempty"`
+}
+
+// geminiRequest Gemini generateContent 请求
+// REST 接口同时接受 camelCase 和 snake_case，这里兼容常见的 snake_case 写法
+type geminiRequest struct {
+	Model                  string                  `json:"model"`
+	Contents               []GeminiContent         `json:"contents"`
+	SystemInstruction      *GeminiContent          `json:"systemInstruction,omitempty"`
+	SystemInstructionSnake *GeminiContent          `json:"system_instruction,omitempty"`
+	GenerationConfig       *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	GenerationConfigSnake  *geminiGenerationConfig `json:"generation_config,omitempty"`
+	ThinkingConfig         *geminiThinkingConfig   `json:"thinkingConfig,omitempty"` // 旧版位置
+	Tools                  []struct {
+		FunctionDeclarations []struct {
+			Name                 string                 `json:"name"`
+			Description          string                 `json:"description,omitempty"`
+			Parameters           map[string]interface{} `json:"parameters,omitempty"`
+			ParametersJSONSchema map[string]interface{} `json:"parametersJsonSchema,omitempty"`
+		} `json:"functionDeclarations,omitempty"`
+	} `json:"tools,omitempty"`
+	ToolConfig *struct {
+		FunctionCallingConfig *struct {
+			Mode                 string   `json:"mode"` // "AUTO" | "ANY" | "NONE"
+			AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+		} `json:"functionCallingConfig,omitempty"`
+	} `json:"toolConfig,omitempty"`
+}
+
+// GeminiToUnified 将 Gemini 格式转换为统一格式
+// 支持 systemInstruction、多模态内容、functionCall/functionResponse 和工具声明
+// Gemini 的函数调用没有 ID 时按顺序生成，函数结果按名称对应到最近一次同名调用
+func GeminiToUnified(body []byte) (*UnifiedRequest, error) {
+	var geminiReq geminiRequest
+	if err := json.Unmarshal(body, &geminiReq); err != nil {
+		return nil, fmt.Errorf("failed to parse Gemini request: %w", err)
+	}
+
+	unified := &UnifiedRequest{
+		Model:       geminiReq.Model,
+		ExtraFields: extraFields(body, geminiFields),
+		ExtraFormat: FormatGemini,
+	}
+
+	config := geminiReq.GenerationConfig
+	if config == nil {
+		config = geminiReq.GenerationConfigSnake
+	}
+	thinking := geminiReq.ThinkingConfig
+	if config != nil {
+		unified.Temperature = config.Temperature
+		unified.TopP = config.TopP
+		unified.TopK = config.TopK
+		unified.MaxTokens = config.MaxOutputTokens
+		unified.N = config.CandidateCount
+		unified.PresencePenalty = config.PresencePenalty
+		unified.FrequencyPenalty = config.FrequencyPenalty
+		unified.Seed = config.Seed
+		if len(config.StopSequences) > 0 {
+			unified.Stop = config.StopSequences
+		}
+		if config.ResponseMimeType == "application/json" {
+			if config.ResponseSchema != nil {
+				unified.ResponseFormat = &ResponseFormat{
+					Type:       "json_schema",
+					JSONSchema: map[string]interface{}{"name": "response", "schema": config.ResponseSchema},
+				}
+			} else {
+				unified.ResponseFormat = &ResponseFormat{Type: "json_object"}
+			}
+		}
+		if config.ThinkingConfig != nil {
+			thinking = config.ThinkingConfig
+		}
+	}
+
+	// 转换思考配置，thinkingBudget 为 0 表示关闭
+	if thinking != nil {
+		budget := 0
+		if thinking.ThinkingBudget != nil {
+			budget = *thinking.ThinkingBudget
+		}
+		if thinking.IncludeThoughts || budget > 0 {
+			effort := thinking.ThinkingEffort
+			if effort == "" {
+				effort = thinkingEffort(budget)
+			}
+			unified.ThinkingConfig = &ThinkingConfig{Enabled: true, Effort: effort}
+		}
+	}
+
+	// system 提示放在消息开头
+	system := geminiReq.SystemInstruction
+	if system == nil {
+		system = geminiReq.SystemInstructionSnake
+	}
+	if system != nil {
+		if text := geminiText(system.Parts); text != "" {
+			unified.Messages = append(unified.Messages, UnifiedMessage{Role: "system", Content: text})
+		}
+	}
+
+	// 转换消息
+	calls := &geminiCallIDs{pending: make(map[string][]string)}
+	for _, content := range geminiReq.Contents {
+		unified.Messages = append(unified.Messages, geminiContentToUnified(content, calls)...)
+	}
+
+	// 转换工具
+	for _, tool := range geminiReq.Tools {
+		for _, decl := range tool.FunctionDeclarations {
+			params := decl.Parameters
+			if params == nil {
+				params = decl.ParametersJSONSchema
+			}
+			unified.Tools = append(unified.Tools, Tool{
+				Type: "function",
+				Function: FunctionDefinition{
+					Name:        decl.Name,
+					Description: decl.Description,
+					Parameters:  params,
+				},
+			})
+		}
+	}
+	if geminiReq.ToolConfig != nil && geminiReq.ToolConfig.FunctionCallingConfig != nil {
+		fc := geminiReq.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(fc.Mode) {
+		case "ANY":
+			if len(fc.AllowedFunctionNames) == 1 {
+				unified.ToolChoice = map[string]interface{}{
+					"type":     "function",
+					"function": map[string]interface{}{"name": fc.AllowedFunctionNames[0]},
+				}
+			} else {
+				unified.ToolChoice = "required"
+			}
+		case "NONE":
+			unified.ToolChoice = "none"
+		case "AUTO":
+			unified.ToolChoice = "auto"
+		}
+	}
+
+	return unified, nil
+}
+
+// geminiText 拼接非思考内容的文本
+func geminiText(parts []GeminiPart) string {
+	var text strings.Builder
+	for _, part := range parts {
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// geminiCallIDs 为没有 ID 的函数调用生成 ID，并按名称记录尚未返回结果的调用
+type geminiCallIDs struct {
+	next    int
+	pending map[string][]string
+}
+
+func (g *geminiCallIDs) call(call *GeminiFunctionCall) string {
+	id := call.ID
+	if id == "" {
+		g.next++
+		id = fmt.Sprintf("call_%d", g.next)
+	}
+	g.pending[call.Name] = append(g.pending[call.Name], id)
+	return id
+}
+
+func (g *geminiCallIDs) response(resp *GeminiFunctionResponse) string {
+	if resp.ID != "" {
+		return resp.ID
+	}
+	if ids := g.pending[resp.Name]; len(ids) > 0 {
+		g.pending[resp.Name] = ids[1:]
+		return ids[0]
+	}
+	g.next++
+	return fmt.Sprintf("call_%d", g.next)
+}
+
+// geminiContentToUnified 转换一条 Gemini 消息
+// functionResponse 转换为独立的 tool 消息并放在同一轮内容之前，functionCall 转换为 tool_calls
+func geminiContentToUnified(content GeminiContent, calls *geminiCallIDs) []UnifiedMessage {
+	role := "user"
+	if content.Role == "model" {
+		role = "assistant"
+	}
+
+	var messages []UnifiedMessage
+	var contentParts []interface{}
+	var toolCalls []ToolCall
+	var textContent strings.Builder
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+			// 历史思考内容不转发
+		case part.Text != "":
+			textContent.WriteString(part.Text)
+		case part.InlineData != nil:
+			url := "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data
+			contentParts = append(contentParts, geminiMediaPart(part.InlineData.MimeType, url))
+		case part.FileData != nil:
+			contentParts = append(contentParts, geminiMediaPart(part.FileData.MimeType, part.FileData.FileURI))
+		case part.ExecutableCode != nil:
+			contentParts = append(contentParts, map[string]interface{}{
+				"type": "code",
+				"code": part.ExecutableCode.Code,
+			})
+		case part.FunctionCall != nil:
+			arguments := string(part.FunctionCall.Args)
+			if arguments == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       calls.call(part.FunctionCall),
+				Type:     "function",
+				Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: arguments},
+			})
+		case part.FunctionResponse != nil:
+			result := string(part.FunctionResponse.Response)
+			if result == "" {
+				result = "{}"
+			}
+			messages = append(messages, UnifiedMessage{
+				Role:       "tool",
+				Content:    result,
+				ToolCallID: calls.response(part.FunctionResponse),
+			})
+		}
+	}
+
+	if textContent.Len() == 0 && len(contentParts) == 0 && len(toolCalls) == 0 {
+		return messages
+	}
+
+	var finalContent interface{}
+	if len(contentParts) > 0 && textContent.Len() > 0 {
+		// 混合内容
+		finalContent = append([]interface{}{
+			map[string]interface{}{"type": "text", "text": textContent.String()},
+		}, contentParts...)
+	} else if len(contentParts) > 0 {
+		finalContent = contentParts
+	} else if textContent.Len() > 0 || len(toolCalls) == 0 {
+		finalContent = textContent.String()
+	}
+
+	return append(messages, UnifiedMessage{Role: role, Content: finalContent, ToolCalls: toolCalls})
+}
+
+// geminiMediaPart 图片转换为 image_url，其他文件转换为 file
+func geminiMediaPart(mimeType, url string) map[string]interface{} {
+	if strings.HasPrefix(mimeType, "image/") || mimeType == "" {
+		return map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}}
+	}
+	return map[string]interface{}{"type": "file", "file": map[string]interface{}{"file_data": url}}
+}
+
+// GeminiResponse Gemini generateContent 响应
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate `json:"candidates"`
+	UsageMetadata *GeminiUsage      `json:"usageMetadata,omitempty"`
+	ModelVersion  string            `json:"modelVersion,omitempty"`
+	ResponseID    string            `json:"responseId,omitempty"`
+}
+
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+type GeminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+func toGeminiUsage(usage Usage) *GeminiUsage {
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	return &GeminiUsage{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens,
+		TotalTokenCount:         total,
+		CachedContentTokenCount: usage.CachedTokens(),
+	}
+}
+
+// geminiFinishReason 将 OpenAI 的 finish_reason 转换为 Gemini 的 finishReason
+func geminiFinishReason(finishReason string) string {
+	switch finishReason {
+	case "":
+		return ""
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// geminiFunctionCallPart 将工具调用转换为 functionCall
+func geminiFunctionCallPart(call ToolCall) GeminiPart {
+	return GeminiPart{FunctionCall: &GeminiFunctionCall{
+		ID:   call.ID,
+		Name: call.Function.Name,
+		Args: toolInput(call.Function.Arguments),
+	}}
+}
+
+// OpenAIToGeminiResponse 将 OpenAI 格式的响应转换为 Gemini 格式
+func OpenAIToGeminiResponse(resp *OpenAIResponse) *GeminiResponse {
+	out := &GeminiResponse{
+		Candidates:    []GeminiCandidate{},
+		UsageMetadata: toGeminiUsage(resp.Usage),
+		ModelVersion:  resp.Model,
+		ResponseID:    resp.ID,
+	}
+	for _, choice := range resp.Choices {
+		parts := []GeminiPart{}
+		if choice.Message.ReasoningContent != "" {
+			parts = append(parts, GeminiPart{Text: choice.Message.ReasoningContent, Thought: true})
+		}
+		if text := extractTextFromContent(choice.Message.Content); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			parts = append(parts, geminiFunctionCallPart(call))
+		}
+		out.Candidates = append(out.Candidates, GeminiCandidate{
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: geminiFinishReason(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+	return out
+}
+
+// GeminiErrorStatus 按 HTTP 状态码返回 Gemini（Google API）的错误状态
+func GeminiErrorStatus(status int) string {
+	switch status {
+	case 400:
+		return "INVALID_ARGUMENT"
+	case 401:
+		return "UNAUTHENTICATED"
+	case 403:
+		return "PERMISSION_DENIED"
+	case 404:
+		return "NOT_FOUND"
+	case 429:
+		return "RESOURCE_EXHAUSTED"
+	case 503:
+		return "UNAVAILABLE"
+	case 504:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+// GeminiErrorBody 构造 Gemini 格式的错误响应体
+func GeminiErrorBody(status int, message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"status":  GeminiErrorStatus(status),
+		},
+	})
+	return body
+}
+
+// geminiStreamChoice 单个候选的流式状态
+type geminiStreamChoice struct {
+	toolCalls    []*ToolCall // 按上游序号累积的工具调用，参数拼接完整后随最后一个响应块输出
+	finishReason string
+}
+
+// GeminiStreamConverter 将 OpenAI 格式的流式响应转换为 Gemini 的 SSE 响应块（alt=sse）
+// 文本和思考内容随到随发；函数调用、finishReason 和 usageMetadata 在最后一个响应块中输出
+type GeminiStreamConverter struct {
+	model    string
+	id       string
+	choices  map[int]*geminiStreamChoice
+	finished bool
+}
+
+func NewGeminiStreamConverter(model string) *GeminiStreamConverter {
+	return &GeminiStreamConverter{model: model, choices: make(map[int]*geminiStreamChoice)}
+}
+
+func (c *GeminiStreamConverter) choice(index int) *geminiStreamChoice {
+	choice, ok := c.choices[index]
+	if !ok {
+		choice = &geminiStreamChoice{}
+		c.choices[index] = choice
+	}
+	return choice
+}
+
+func (c *GeminiStreamConverter) event(resp *GeminiResponse) *SSEEvent {
+	resp.ModelVersion = c.model
+	resp.ResponseID = c.id
+	body, _ := json.Marshal(resp)
+	return &SSEEvent{Data: string(body), HasData: true, Retry: -1}
+}
+
+// Convert 转换一个上游事件
+func (c *GeminiStreamConverter) Convert(event *SSEEvent) []*SSEEvent {
+	if c.finished || !event.HasData || event.IsDone() {
+		return nil
+	}
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil
+	}
+	if chunk.ID != "" {
+		c.id = chunk.ID
+	}
+	if chunk.Model != "" {
+		c.model = chunk.Model
+	}
+
+	resp := &GeminiResponse{Candidates: []GeminiCandidate{}}
+	for _, choice := range chunk.Choices {
+		state := c.choice(choice.Index)
+		for i, call := range choice.Delta.ToolCalls {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			for len(state.toolCalls) <= index {
+				state.toolCalls = append(state.toolCalls, &ToolCall{Type: "function"})
+			}
+			acc := state.toolCalls[index]
+			if call.ID != "" {
+				acc.ID = call.ID
+			}
+			if call.Function.Name != "" {
+				acc.Function.Name = call.Function.Name
+			}
+			acc.Function.Arguments += call.Function.Arguments
+		}
+		if choice.FinishReason != "" {
+			state.finishReason = choice.FinishReason
+		}
+
+		var parts []GeminiPart
+		if choice.Delta.ReasoningContent != "" {
+			parts = append(parts, GeminiPart{Text: choice.Delta.ReasoningContent, Thought: true})
+		}
+		if choice.Delta.Content != "" {
+			parts = append(parts, GeminiPart{Text: choice.Delta.Content})
+		}
+		if len(parts) > 0 {
+			resp.Candidates = append(resp.Candidates, GeminiCandidate{
+				Content: GeminiContent{Role: "model", Parts: parts},
+				Index:   choice.Index,
+			})
+		}
+	}
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	return []*SSEEvent{c.event(resp)}
+}
+
+// Finish 输出包含函数调用、finishReason 和最终用量的最后一个响应块
+func (c *GeminiStreamConverter) Finish(usage Usage) []*SSEEvent {
+	if c.finished {
+		return nil
+	}
+	c.finished = true
+
+	resp := &GeminiResponse{Candidates: []GeminiCandidate{}, UsageMetadata: toGeminiUsage(usage)}
+	if len(c.choices) == 0 {
+		c.choices[0] = &geminiStreamChoice{finishReason: "stop"}
+	}
+	indexes := make([]int, 0, len(c.choices))
+	for index := range c.choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		state := c.choices[index]
+		parts := []GeminiPart{}
+		for _, call := range state.toolCalls {
+			parts = append(parts, geminiFunctionCallPart(*call))
+		}
+		finishReason := geminiFinishReason(state.finishReason)
+		if finishReason == "" {
+			finishReason = "STOP"
+		}
+		resp.Candidates = append(resp.Candidates, GeminiCandidate{
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: finishReason,
+			Index:        index,
+		})
+	}
+	return []*SSEEvent{c.event(resp)}
+}
@@ -0,0 +1,211 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// scanObject 依次返回 JSON 对象的顶层字段，值按原始字节返回而不解码
+// rawKey 是包含引号的原始键名；fn 返回 false 时停止
+func scanObject(body []byte, fn func(name string, rawKey, value []byte) bool) error {
+	i := skipSpace(body, 0)
+	if i >= len(body) || body[i] != '{' {
+		return fmt.Errorf("invalid JSON object: expected '{' at offset %d", i)
+	}
+	i = skipSpace(body, i+1)
+	if i < len(body) && body[i] == '}' {
+		return checkTrailing(body, i+1)
+	}
+	for {
+		keyEnd, err := scanString(body, i)
+		if err != nil {
+			return err
+		}
+		rawKey := body[i:keyEnd]
+		name, err := decodeKey(rawKey)
+		if err != nil {
+			return err
+		}
+		i = skipSpace(body, keyEnd)
+		if i >= len(body) || body[i] != ':' {
+			return fmt.Errorf("invalid JSON object: expected ':' at offset %d", i)
+		}
+		i = skipSpace(body, i+1)
+		valueEnd, err := scanValue(body, i)
+		if err != nil {
+			return err
+		}
+		if !fn(name, rawKey, body[i:valueEnd]) {
+			return nil
+		}
+		i = skipSpace(body, valueEnd)
+		if i >= len(body) {
+			return fmt.Errorf("invalid JSON object: unexpected end of input")
+		}
+		switch body[i] {
+		case ',':
+			i = skipSpace(body, i+1)
+		case '}':
+			return checkTrailing(body, i+1)
+		default:
+			return fmt.Errorf("invalid JSON object: unexpected '%c' at offset %d", body[i], i)
+		}
+	}
+}
+
+// patchObject 修改 JSON 对象的顶层字段，其他字段的值不解码、按原始字节复制
+// set 中的字段替换原值，原对象中没有的按键名顺序追加到末尾；keep 不为 nil 且返回 false 的字段被删除
+func patchObject(body []byte, set map[string]interface{}, keep func(field string) bool) ([]byte, error) {
+	encoded := make(map[string][]byte, len(set))
+	for name, value := range set {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[name] = data
+	}
+
+	out := make([]byte, 0, len(body)+64)
+	out = append(out, '{')
+	written := make(map[string]bool, len(set))
+	appendField := func(rawKey, value []byte) {
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+		out = append(out, rawKey...)
+		out = append(out, ':')
+		out = append(out, value...)
+	}
+
+	err := scanObject(body, func(name string, rawKey, value []byte) bool {
+		if data, ok := encoded[name]; ok {
+			// 重复的键只保留第一个
+			if !written[name] {
+				appendField(rawKey, data)
+				written[name] = true
+			}
+			return true
+		}
+		if keep == nil || keep(name) {
+			appendField(rawKey, value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0, len(encoded))
+	for name := range encoded {
+		if !written[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		rawKey, _ := json.Marshal(name)
+		appendField(rawKey, encoded[name])
+	}
+	return append(out, '}'), nil
+}
+
+func skipSpace(body []byte, i int) int {
+	for i < len(body) && (body[i] == ' ' || body[i] == '\t' || body[i] == '\n' || body[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+func checkTrailing(body []byte, i int) error {
+	if i = skipSpace(body, i); i < len(body) {
+		return fmt.Errorf("invalid JSON object: unexpected data after offset %d", i)
+	}
+	return nil
+}
+
+// scanString 返回从 i 开始的字符串结束引号之后的位置
+// 用 IndexByte 跳到下一个引号，前面有奇数个反斜杠时是转义的引号
+func scanString(body []byte, i int) (int, error) {
+	if i >= len(body) || body[i] != '"' {
+		return 0, fmt.Errorf("invalid JSON: expected string at offset %d", i)
+	}
+	for j := i + 1; j < len(body); {
+		k := bytes.IndexByte(body[j:], '"')
+		if k < 0 {
+			break
+		}
+		end := j + k
+		backslashes := 0
+		for p := end - 1; p > i && body[p] == '\\'; p-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return end + 1, nil
+		}
+		j = end + 1
+	}
+	return 0, fmt.Errorf("invalid JSON: unterminated string at offset %d", i)
+}
+
+// scanValue 返回从 i 开始的值结束之后的位置，只匹配括号和字符串边界，不校验值的内容
+func scanValue(body []byte, i int) (int, error) {
+	if i >= len(body) {
+		return 0, fmt.Errorf("invalid JSON: unexpected end of input")
+	}
+	switch body[i] {
+	case '"':
+		return scanString(body, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(body); j++ {
+			switch body[j] {
+			case '"':
+				end, err := scanString(body, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("invalid JSON: unterminated value at offset %d", i)
+	default:
+		j := i
+		for j < len(body) && !isDelimiter(body[j]) {
+			j++
+		}
+		if j == i {
+			return 0, fmt.Errorf("invalid JSON: unexpected '%c' at offset %d", body[i], i)
+		}
+		return j, nil
+	}
+}
+
+// isDelimiter 数字和 true/false/null 之后可能出现的字符
+func isDelimiter(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// decodeKey 解码键名，没有转义字符时直接截取
+func decodeKey(rawKey []byte) (string, error) {
+	if bytes.IndexByte(rawKey, '\\') < 0 {
+		return string(rawKey[1 : len(rawKey)-1]), nil
+	}
+	var name string
+	if err := json.Unmarshal(rawKey, &name); err != nil {
+		return "", fmt.Errorf("invalid JSON object key %s: %w", rawKey, err)
+	}
+	return name, nil
+}
@@ -0,0 +1,227 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanObject(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string // 依次为 "键=原始值"
+		wantErr bool
+	}{
+		{name: "empty", body: `{}`, want: nil},
+		{name: "whitespace", body: " \n{ \"a\" :\t1 ,\r\n\"b\": true }\n", want: []string{"a=1", "b=true"}},
+		{name: "scalars", body: `{"s":"x","n":-1.5e3,"t":true,"f":false,"z":null}`,
+			want: []string{`s="x"`, "n=-1.5e3", "t=true", "f=false", "z=null"}},
+		{name: "nested", body: `{"a":{"b":[1,{"c":[]}]},"d":[[],{}]}`,
+			want: []string{`a={"b":[1,{"c":[]}]}`, "d=[[],{}]"}},
+		{name: "brackets in strings", body: `{"a":"}]{[","b":{"c":"]}"}}`,
+			want: []string{`a="}]{["`, `b={"c":"]}"}`}},
+		{name: "escaped quote", body: `{"a":"say \"hi\"}","b":1}`,
+			want: []string{`a="say \"hi\"}"`, "b=1"}},
+		{name: "escaped backslash before quote", body: `{"a":"dir\\","b":"\\\"x"}`,
+			want: []string{`a="dir\\"`, `b="\\\"x"`}},
+		{name: "escaped quote in nested string", body: `{"a":["\"]",{"k":"\\"}]}`,
+			want: []string{`a=["\"]",{"k":"\\"}]`}},
+		{name: "escaped key", body: `{"model":"m","a\"b":1}`, want: []string{`model="m"`, `a"b=1`}},
+		{name: "duplicate keys", body: `{"a":1,"a":2}`, want: []string{"a=1", "a=2"}},
+		{name: "unicode", body: `{"文本":"你好"}`, want: []string{`文本="你好"`}},
+
+		{name: "not an object", body: `[1]`, wantErr: true},
+		{name: "empty input", body: ``, wantErr: true},
+		{name: "trailing data", body: `{"a":1} {"b":2}`, wantErr: true},
+		{name: "trailing comma", body: `{"a":1,}`, wantErr: true},
+		{name: "missing colon", body: `{"a" 1}`, wantErr: true},
+		{name: "missing value", body: `{"a":}`, wantErr: true},
+		{name: "unterminated object", body: `{"a":1`, wantErr: true},
+		{name: "unterminated string", body: `{"a":"x}`, wantErr: true},
+		{name: "escaped closing quote", body: `{"a":"x\"}`, wantErr: true},
+		{name: "unterminated nested value", body: `{"a":[1,{"b":2}}`, wantErr: true},
+		{name: "unquoted key", body: `{a:1}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := scanObject([]byte(tt.body), func(name string, _, value []byte) bool {
+				got = append(got, name+"="+string(value))
+				return true
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("scanObject(%s) succeeded with %q, want error", tt.body, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scanObject(%s): %v", tt.body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("scanObject(%s) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanObjectStop(t *testing.T) {
+	var got []string
+	err := scanObject([]byte(`{"a":1,"b":2,"c":`), func(name string, _, _ []byte) bool {
+		got = append(got, name)
+		return name != "b"
+	})
+	if err != nil || !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("got %q, %v; want [a b] without error", got, err)
+	}
+}
+
+func TestPatchObject(t *testing.T) {
+	dropSecret := func(field string) bool { return !strings.HasPrefix(field, "secret") }
+	tests := []struct {
+		name    string
+		body    string
+		set     map[string]interface{}
+		keep    func(string) bool
+		want    string
+		wantErr bool
+	}{
+		{name: "replace", body: `{"model":"a","messages":[]}`, set: map[string]interface{}{"model": "b"},
+			want: `{"model":"b","messages":[]}`},
+		{name: "append missing in key order", body: `{"model":"a"}`,
+			set:  map[string]interface{}{"model": "b", "z": 1, "max_tokens": 10},
+			want: `{"model":"b","max_tokens":10,"z":1}`},
+		{name: "empty object", body: ` {} `, set: map[string]interface{}{"model": "b"}, want: `{"model":"b"}`},
+		{name: "values copied verbatim", body: "{ \"messages\" : [ {\"content\":\"a\\\"}\"} ] , \"n\":1.0 }",
+			set:  map[string]interface{}{"model": "m"},
+			want: `{"messages":[ {"content":"a\"}"} ],"n":1.0,"model":"m"}`},
+		{name: "drop fields", body: `{"secret_a":1,"model":"a","secret_b":{"x":"}"},"keep":true}`,
+			set: map[string]interface{}{"model": "b"}, keep: dropSecret,
+			want: `{"model":"b","keep":true}`},
+		{name: "set overrides keep", body: `{"secret":"x"}`, set: map[string]interface{}{"secret": "y"}, keep: dropSecret,
+			want: `{"secret":"y"}`},
+		{name: "duplicate set key written once", body: `{"model":"a","x":1,"model":"c"}`,
+			set: map[string]interface{}{"model": "b"}, want: `{"model":"b","x":1}`},
+		{name: "duplicate kept key copied", body: `{"x":1,"x":2}`, set: map[string]interface{}{},
+			want: `{"x":1,"x":2}`},
+		{name: "escaped key matched", body: `{"mod\u0065l":"a"}`, set: map[string]interface{}{"model": "b"},
+			want: `{"mod\u0065l":"b"}`},
+		{name: "value needing escapes", body: `{}`, set: map[string]interface{}{"model": "a\"b\\c"},
+			want: `{"model":"a\"b\\c"}`},
+
+		{name: "trailing data", body: `{"model":"a"}x`, set: map[string]interface{}{"model": "b"}, wantErr: true},
+		{name: "invalid", body: `{"model":"a"`, set: map[string]interface{}{"model": "b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patchObject([]byte(tt.body), tt.set, tt.keep)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("patchObject(%s) = %s, want error", tt.body, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("patchObject(%s): %v", tt.body, err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("patchObject(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+			if !json.Valid(got) {
+				t.Fatalf("patchObject(%s) produced invalid JSON: %s", tt.body, got)
+			}
+		})
+	}
+}
+
+func TestOpenAIFastPath(t *testing.T) {
+	body := []byte(`{"model":"group","messages":[{"role":"user","content":"hi"}],"stream":true,` +
+		`"stream_options":{"include_usage":false},"custom":{"a":1},"secret":1,"max_tokens":100.0}`)
+	unified, err := OpenAIToUnified(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unified.FilterExtraFields(func(field string) bool { return field != "secret" })
+	unified.Model = "gpt-4o"
+	unified.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	got, ok := OpenAIFastPath(unified, PlatformOpenAI)
+	if !ok {
+		t.Fatal("fast path not taken")
+	}
+	want := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"stream":true,` +
+		`"stream_options":{"include_usage":true},"custom":{"a":1},"max_tokens":100}`
+	if string(got) != want {
+		t.Fatalf("OpenAIFastPath = %s, want %s", got, want)
+	}
+
+	if _, ok := OpenAIFastPath(unified, PlatformAnthropic); ok {
+		t.Fatal("fast path taken for a non-OpenAI platform")
+	}
+	unified.Raw = nil
+	if _, ok := OpenAIFastPath(unified, PlatformOpenAI); ok {
+		t.Fatal("fast path taken without the raw body")
+	}
+}
+
+// largeMultimodalBody 构造包含 size 字节图片（base64 data URL）的多轮对话请求
+func largeMultimodalBody(size int) []byte {
+	image := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a}, size/6))
+	var messages []interface{}
+	messages = append(messages, map[string]interface{}{"role": "system", "content": "You are a helpful assistant."})
+	for i := 0; i < 10; i++ {
+		messages = append(messages,
+			map[string]interface{}{"role": "user", "content": fmt.Sprintf("Question %d: %s", i, strings.Repeat("lorem ipsum ", 50))},
+			map[string]interface{}{"role": "assistant", "content": fmt.Sprintf("Answer %d: %s", i, strings.Repeat("dolor sit amet ", 50))})
+	}
+	messages = append(messages, map[string]interface{}{"role": "user", "content": []interface{}{
+		map[string]interface{}{"type": "text", "text": "What is in this image?"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64," + image, "detail": "high"}},
+	}})
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":          "group",
+		"messages":       messages,
+		"max_tokens":     1024,
+		"temperature":    0.7,
+		"stream":         true,
+		"stream_options": map[string]interface{}{"include_usage": true},
+	})
+	return body
+}
+
+// benchmarkUnified 解析请求并模拟网关选择模型后的修改，解析不计入基准
+func benchmarkUnified(b *testing.B) *UnifiedRequest {
+	body := largeMultimodalBody(4 << 20)
+	unified, err := OpenAIToUnified(body)
+	if err != nil {
+		b.Fatal(err)
+	}
+	unified.Model = "gpt-4o"
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	return unified
+}
+
+func BenchmarkOpenAIFastPath(b *testing.B) {
+	unified := benchmarkUnified(b)
+	for i := 0; i < b.N; i++ {
+		if _, ok := OpenAIFastPath(unified, PlatformOpenAI); !ok {
+			b.Fatal("fast path not taken")
+		}
+	}
+}
+
+func BenchmarkUnifiedToOpenAI(b *testing.B) {
+	unified := benchmarkUnified(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := UnifiedToOpenAI(unified); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,55 +1,103 @@
 package relay
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
-	"time"
+	"sync"
 )
 
 type OpenAIAdapter struct {
-	client *http.Client
+	// 按连接阶段超时缓存的客户端，见 clientFor
+	mu      sync.Mutex
+	clients map[transportKey]*http.Client
 }
 
-func NewOpenAIAdapter(timeout time.Duration) *OpenAIAdapter {
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     90 * time.Second,
-		},
+func NewOpenAIAdapter() *OpenAIAdapter {
+	return &OpenAIAdapter{
+		clients: make(map[transportKey]*http.Client),
+	}
+}
+
+// Upstream 上游地址和认证方式
+type Upstream struct {
+	BaseURL string
+	APIKey  string
+	// 放置 API Key 的请求头及值前缀，如 Authorization 和 "Bearer "
+	AuthHeader string
+	AuthPrefix string
+	// 放置 API Key 的查询参数，与 AuthHeader 都为空时不传递 API Key
+	AuthQuery string
+	Headers   map[string]string // 附加请求头，最后设置，可覆盖默认请求头
+	Query     map[string]string // 附加查询参数
+}
+
+// URL 拼接上游接口地址，附加查询参数
+func (u Upstream) URL(path string) (string, error) {
+	endpoint := endpointURL(u.BaseURL, path)
+	if len(u.Query) == 0 && u.AuthQuery == "" {
+		return endpoint, nil
 	}
-	// timeout > 0 时才设置超时
-	if timeout > 0 {
-		client.Timeout = timeout
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
 	}
-	return &OpenAIAdapter{
-		client: client,
+	query := parsed.Query()
+	for k, v := range u.Query {
+		query.Set(k, v)
 	}
+	if u.AuthQuery != "" {
+		query.Set(u.AuthQuery, u.APIKey)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
 }
 
-// buildHTTPRequest 构建带有标准认证头的 HTTP 请求
-func buildHTTPRequest(method, url, apiKey string, body []byte, extraHeaders map[string]string) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+// buildHTTPRequest 构建带有认证信息和附加请求头的 HTTP 请求
+func buildHTTPRequest(ctx context.Context, method string, upstream Upstream, path string, body []byte, extraHeaders map[string]string) (*http.Request, error) {
+	endpoint, err := upstream.URL(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	// 添加额外的头部
 	for k, v := range extraHeaders {
 		req.Header.Set(k, v)
 	}
 
+	if upstream.AuthHeader != "" {
+		req.Header.Set(upstream.AuthHeader, upstream.AuthPrefix+upstream.APIKey)
+	}
+	for k, v := range upstream.Headers {
+		req.Header.Set(k, v)
+	}
+
 	return req, nil
 }
 
+// redactURLError 去掉传输错误中 URL 的查询参数，避免放在查询参数中的 API Key 出现在错误信息中
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if i := strings.IndexByte(urlErr.URL, '?'); i >= 0 {
+			urlErr.URL = urlErr.URL[:i]
+		}
+	}
+	return err
+}
+
 // OpenAIRequest 兼容 OpenAI API 格式
 type OpenAIRequest struct {
 	// 基础参数
@@ -110,6 +158,7 @@ type FunctionDefinition struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description,omitempty"`
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Strict      *bool                  `json:"strict,omitempty"`
 }
 
 // ToolChoice 工具选择
@@ -137,8 +186,25 @@ type ContentPrediction struct {
 }
 
 type Message struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"` // 可以是 string 或 []ContentPart
+	Role             string      `json:"role"`
+	Content          interface{} `json:"content"` // 可以是 string 或 []ContentPart
+	ReasoningContent string      `json:"reasoning_content,omitempty"` // 推理内容（DeepSeek 等）
+	ToolCalls        []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID       string      `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall 模型发起的工具调用
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // 仅出现在流式响应块中
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"` // "function"
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 工具调用的函数名和 JSON 参数
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // NormalizeContent 将 content 规范化为适合发送到 API 的格式
@@ -203,44 +269,55 @@ type OpenAIResponse struct {
 }
 
 type Choice struct {
-	Index        int     `json:"index"`
-	Message      Message `json:"message"`
-	FinishReason string  `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Message      Message         `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+	Logprobs     json.RawMessage `json:"logprobs,omitempty"` // 原样保留上游返回的 logprobs
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
 }
 
-func (a *OpenAIAdapter) SendRequest(baseUrl, apiKey string, req OpenAIRequest) (*OpenAIResponse, error) {
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
+// PromptTokensDetails 提示词 token 明细
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"` // 命中提示词缓存的 token 数
+}
+
+// CachedTokens 返回命中缓存的提示词 token 数
+func (u Usage) CachedTokens() int {
+	if u.PromptTokensDetails == nil {
+		return 0
 	}
+	return u.PromptTokensDetails.CachedTokens
+}
 
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimSuffix(baseUrl, "/"))
-	httpReq, err := buildHTTPRequest("POST", url, apiKey, body, nil)
+func (a *OpenAIAdapter) SendRequest(ctx context.Context, upstream Upstream, req OpenAIRequest, timeouts Timeouts) (*OpenAIResponse, error) {
+	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := a.client.Do(httpReq)
-	if err != nil {
-		return nil, err
+	return a.SendRequestRaw(ctx, upstream, body, timeouts)
+}
+
+// SendRequestRaw 发送原始 JSON 请求体
+// 整体耗时受 timeouts.Total 限制
+func (a *OpenAIAdapter) SendRequestRaw(ctx context.Context, upstream Upstream, body []byte, timeouts Timeouts) (*OpenAIResponse, error) {
+	if timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Total)
+		defer cancel()
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := a.post(ctx, upstream, "chat/completions", body, timeouts)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", string(respBody))
-	}
-
 	var openAIResp OpenAIResponse
 	if err := json.Unmarshal(respBody, &openAIResp); err != nil {
 		return nil, err
@@ -249,18 +326,38 @@ func (a *OpenAIAdapter) SendRequest(baseUrl, apiKey string, req OpenAIRequest) (
 	return &openAIResp, nil
 }
 
-// SendRequestRaw 发送原始 JSON 请求体
-func (a *OpenAIAdapter) SendRequestRaw(baseUrl, apiKey string, body []byte) (*OpenAIResponse, error) {
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimSuffix(baseUrl, "/"))
-	httpReq, err := buildHTTPRequest("POST", url, apiKey, body, nil)
+// SendCompletionRaw 向旧版 /completions 接口发送请求，返回转换为聊天格式的响应
+// 整体耗时受 timeouts.Total 限制
+func (a *OpenAIAdapter) SendCompletionRaw(ctx context.Context, upstream Upstream, body []byte, timeouts Timeouts) (*OpenAIResponse, error) {
+	if timeouts.Total > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Total)
+		defer cancel()
+	}
+
+	respBody, err := a.post(ctx, upstream, "completions", body, timeouts)
 	if err != nil {
 		return nil, err
 	}
+	return CompletionToChatResponse(respBody)
+}
 
-	resp, err := a.client.Do(httpReq)
+// endpointURL 拼接上游接口地址
+func endpointURL(baseUrl, path string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(baseUrl, "/"), path)
+}
+
+// post 发送非流式请求并返回响应体，非 200 响应作为错误返回
+func (a *OpenAIAdapter) post(ctx context.Context, upstream Upstream, path string, body []byte, timeouts Timeouts) ([]byte, error) {
+	httpReq, err := buildHTTPRequest(ctx, "POST", upstream, path, body, nil)
 	if err != nil {
 		return nil, err
 	}
+
+	resp, err := a.clientFor(timeouts).Do(httpReq)
+	if err != nil {
+		return nil, redactURLError(err)
+	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
@@ -271,80 +368,54 @@ func (a *OpenAIAdapter) SendRequestRaw(baseUrl, apiKey string, body []byte) (*Op
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("API error: %s", string(respBody))
 	}
+	return respBody, nil
+}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(respBody, &openAIResp); err != nil {
-		return nil, err
-	}
-
-	return &openAIResp, nil
+// SendRequestStream 发送流式请求并返回原始 HTTP 响应
+// 调用方需要负责关闭 resp.Body
+// 流式请求不设整体超时：首块超时和空闲超时触发时读取 resp.Body
+// 会返回 ErrFirstByteTimeout / ErrStreamIdleTimeout
+func (a *OpenAIAdapter) SendRequestStream(ctx context.Context, upstream Upstream, body []byte, timeouts Timeouts) (*http.Response, error) {
+	return a.postStream(ctx, upstream, "chat/completions", body, timeouts)
 }
 
-// IsStreamRequest 检查请求体是否为流式请求
-func IsStreamRequest(body []byte) bool {
-	var req map[string]interface{}
-	if err := json.Unmarshal(body, &req); err != nil {
-		return false
-	}
-	if stream, ok := req["stream"].(bool); ok {
-		return stream
-	}
-	return false
+// SendCompletionStream 向旧版 /completions 接口发送流式请求并返回原始 HTTP 响应
+// 响应块为 text_completion 格式，可用 CompletionChunkToChat 转换；调用方需要负责关闭 resp.Body
+func (a *OpenAIAdapter) SendCompletionStream(ctx context.Context, upstream Upstream, body []byte, timeouts Timeouts) (*http.Response, error) {
+	return a.postStream(ctx, upstream, "completions", body, timeouts)
 }
 
-// SendRequestStream 发送流式请求并返回原始 HTTP 响应
-// 调用方需要负责关闭 resp.Body
-func (a *OpenAIAdapter) SendRequestStream(baseUrl, apiKey string, body []byte) (*http.Response, error) {
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimSuffix(baseUrl, "/"))
+// postStream 发送流式请求，首块超时和空闲超时由 watchdog 监控
+func (a *OpenAIAdapter) postStream(ctx context.Context, upstream Upstream, path string, body []byte, timeouts Timeouts) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	watchdog := newStreamWatchdog(cancel, timeouts)
+
 	extraHeaders := map[string]string{
 		"Accept": "text/event-stream",
 	}
-	httpReq, err := buildHTTPRequest("POST", url, apiKey, body, extraHeaders)
+	httpReq, err := buildHTTPRequest(ctx, "POST", upstream, path, body, extraHeaders)
 	if err != nil {
+		watchdog.Close()
 		return nil, err
 	}
 
-	resp, err := a.client.Do(httpReq)
+	resp, err := a.clientFor(timeouts).Do(httpReq)
 	if err != nil {
-		return nil, err
+		if expired := watchdog.err(); expired != nil {
+			err = expired
+		}
+		watchdog.Close()
+		return nil, redactURLError(err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		watchdog.stop()
+		defer watchdog.Close()
 		defer resp.Body.Close()
 		respBody, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API error: %s", string(respBody))
 	}
 
+	resp.Body = watchdog.attach(resp.Body)
 	return resp, nil
 }
-
-// StreamResponseWriter 流式响应写入接口
-type StreamResponseWriter interface {
-	Write(data []byte) (int, error)
-	WriteString(data string) (int, error)
-	Flush() error
-}
-
-// ForwardStreamResponse 转发 SSE 流式响应
-func ForwardStreamResponse(resp *http.Response, writer StreamResponseWriter) error {
-	defer resp.Body.Close()
-
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// SSE 格式：每行以 "data: " 开头
-		if strings.HasPrefix(line, "data: ") {
-			data := line[6:] // 去掉 "data: " 前缀
-			if data == "[DONE]" {
-				// 发送结束标记
-				writer.Write([]byte("data: [DONE]\n\n"))
-				break
-			}
-			// 转发 SSE 数据
-			writer.Write([]byte("data: " + data + "\n\n"))
-		}
-		writer.Flush()
-	}
-
-	return scanner.Err()
-}
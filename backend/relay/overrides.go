@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/elysia-api/backend/transform"
+)
+
+// unifiedFields UnifiedRequest 序列化后的顶层字段名
+var unifiedFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(UnifiedRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// ApplyOverrides 将 overrides 规则应用到统一格式的请求上，返回修改后的副本，不修改 unified
+// 规则路径使用统一格式序列化后的字段名（与 OpenAI 请求基本一致），上游特有的字段应使用 transforms
+// 修改后的请求不再对应原始请求体，不会走 OpenAIFastPath
+func ApplyOverrides(unified *UnifiedRequest, rules []transform.Rule) (*UnifiedRequest, error) {
+	if len(rules) == 0 {
+		return unified, nil
+	}
+	data, err := json.Marshal(unified)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := transform.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	doc, err = transform.Apply(doc, rules)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("overrides must keep the request a JSON object")
+	}
+	for name := range object {
+		if !unifiedFields[name] {
+			return nil, fmt.Errorf("override field '%s' is not part of the unified request, use transforms for upstream-specific fields", name)
+		}
+	}
+	if data, err = json.Marshal(object); err != nil {
+		return nil, err
+	}
+
+	result := &UnifiedRequest{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("overrides produced an invalid request: %w", err)
+	}
+	if len(unified.ExtraFields) > 0 {
+		result.ExtraFields = make(map[string]json.RawMessage, len(unified.ExtraFields))
+		for name, value := range unified.ExtraFields {
+			result.ExtraFields[name] = value
+		}
+	}
+	result.ExtraFormat = unified.ExtraFormat
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package relay
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// 各格式转换为统一格式时已映射的顶层字段，其余字段保存在 ExtraFields 中原样转发给同系上游
+var (
+	// top_k 不是 OpenAI 的标准字段，解析到 TopK 的同时仍作为透传字段转发给兼容 OpenAI 的上游
+	openAIFields = fieldSet("model", "messages", "max_tokens", "max_completion_tokens", "temperature", "top_p",
+		"n", "stream", "stream_options", "stop", "presence_penalty", "frequency_penalty", "reasoning_effort",
+		"tools", "tool_choice", "parallel_tool_calls", "response_format", "user", "seed", "logprobs",
+		"top_logprobs", "prompt_cache_key", "prompt_cache_retention")
+	claudeFields = fieldSet("model", "max_tokens", "messages", "system", "temperature", "top_p", "top_k",
+		"stream", "stop_sequences", "stop", "thinking", "thinking_enabled", "thinking_budget", "metadata",
+		"tools", "tool_choice")
+	geminiFields = fieldSet("model", "contents", "systemInstruction", "system_instruction", "generationConfig",
+		"generation_config", "thinkingConfig", "tools", "toolConfig")
+	// 没有使用 Responses API 的上游，这些请求的透传字段只会被记录和过滤，不会转发
+	responsesFields = fieldSet("model", "input", "instructions", "max_output_tokens", "temperature", "top_p",
+		"top_logprobs", "stream", "user", "prompt_cache_key", "parallel_tool_calls", "previous_response_id",
+		"conversation", "background", "reasoning", "text", "tools", "tool_choice")
+	completionsFields = fieldSet("model", "prompt", "suffix", "echo", "logprobs", "best_of", "max_tokens",
+		"temperature", "top_p", "n", "stream", "stream_options", "stop", "presence_penalty", "frequency_penalty",
+		"user", "seed")
+)
+
+func fieldSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// extraFields 返回请求体中不在 known 内的顶层字段，没有时返回 nil
+// 字段值直接引用请求体，不复制也不解码
+func extraFields(body []byte, known map[string]bool) map[string]json.RawMessage {
+	var extra map[string]json.RawMessage
+	err := scanObject(body, func(name string, _, value []byte) bool {
+		if !known[name] {
+			if extra == nil {
+				extra = make(map[string]json.RawMessage)
+			}
+			extra[name] = value
+		}
+		return true
+	})
+	if err != nil {
+		return nil
+	}
+	return extra
+}
+
+// formatFamily 格式所属的协议族，DeepSeek 请求使用 OpenAI 的字段
+func formatFamily(format FormatType) FormatType {
+	if format == FormatDeepSeek {
+		return FormatOpenAI
+	}
+	return format
+}
+
+// FilterExtraFields 按 allows 过滤透传字段，返回被丢弃的字段名
+func (u *UnifiedRequest) FilterExtraFields(allows func(field string) bool) []string {
+	var dropped []string
+	for name := range u.ExtraFields {
+		if !allows(name) {
+			delete(u.ExtraFields, name)
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// addExtraFields 将透传字段合并到发往 family 协议族上游的请求中
+// 请求来自其他协议族时字段含义不同，不会转发；已映射的字段优先，透传字段不会覆盖
+func addExtraFields(result map[string]interface{}, unified *UnifiedRequest, family FormatType) {
+	if formatFamily(unified.ExtraFormat) != family {
+		return
+	}
+	for name, value := range unified.ExtraFields {
+		if _, exists := result[name]; !exists {
+			result[name] = value
+		}
+	}
+}
+
+// mergeExtraFields 与 addExtraFields 相同，用于已序列化的请求体
+func mergeExtraFields(body []byte, unified *UnifiedRequest, family FormatType) ([]byte, error) {
+	if len(unified.ExtraFields) == 0 || formatFamily(unified.ExtraFormat) != family {
+		return body, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(fields)+len(unified.ExtraFields))
+	for name, value := range fields {
+		result[name] = value
+	}
+	addExtraFields(result, unified, family)
+	return json.Marshal(result)
+}
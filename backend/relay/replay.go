@@ -0,0 +1,217 @@
+package relay
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// accumulatorChunk OpenAI 流式响应块中用于拼装完整响应的字段
+type accumulatorChunk struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role      string            `json:"role"`
+			Content   string            `json:"content"`
+			ToolCalls []json.RawMessage `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string          `json:"finish_reason"`
+		Logprobs     json.RawMessage `json:"logprobs"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// openAIStreamChunk OpenAI 流式响应块中用于格式转换的字段
+type openAIStreamChunk struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content          string     `json:"content"`
+			ReasoningContent string     `json:"reasoning_content"`
+			ToolCalls        []ToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string          `json:"finish_reason"`
+		Logprobs     json.RawMessage `json:"logprobs"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// accumulatedChoice 拼装中的单个候选
+type accumulatedChoice struct {
+	role         string
+	content      strings.Builder
+	finishReason string
+}
+
+// StreamAccumulator 将 OpenAI 格式的流式响应拼装为完整的非流式响应
+// 包含工具调用、logprobs 等无法用 Message 表示的内容时视为不完整
+type StreamAccumulator struct {
+	id         string
+	object     string
+	model      string
+	created    int64
+	choices    map[int]*accumulatedChoice
+	usage      Usage
+	incomplete bool
+}
+
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{choices: make(map[int]*accumulatedChoice)}
+}
+
+// Observe 记录一个 SSE 事件
+func (a *StreamAccumulator) Observe(event *SSEEvent) {
+	if !event.HasData || event.IsDone() || a.incomplete {
+		return
+	}
+	if event.Event != "" && event.Event != "message" {
+		a.incomplete = true
+		return
+	}
+
+	var chunk accumulatorChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		a.incomplete = true
+		return
+	}
+	if chunk.ID != "" {
+		a.id, a.model, a.created = chunk.ID, chunk.Model, chunk.Created
+		a.object = chunk.Object
+	}
+	if chunk.Usage != nil {
+		a.usage = *chunk.Usage
+	}
+
+	for _, delta := range chunk.Choices {
+		if len(delta.Delta.ToolCalls) > 0 || hasLogprobs(delta.Logprobs) {
+			a.incomplete = true
+			return
+		}
+		choice, ok := a.choices[delta.Index]
+		if !ok {
+			choice = &accumulatedChoice{role: "assistant"}
+			a.choices[delta.Index] = choice
+		}
+		if delta.Delta.Role != "" {
+			choice.role = delta.Delta.Role
+		}
+		choice.content.WriteString(delta.Delta.Content)
+		if delta.FinishReason != "" {
+			choice.finishReason = delta.FinishReason
+		}
+	}
+}
+
+// Response 返回拼装后的响应，流未正常结束或包含无法表示的内容时返回 false
+func (a *StreamAccumulator) Response() (*OpenAIResponse, bool) {
+	if a.incomplete || len(a.choices) == 0 {
+		return nil, false
+	}
+
+	object := "chat.completion"
+	if a.object == ObjectTextCompletion {
+		object = ObjectTextCompletion
+	}
+	resp := &OpenAIResponse{
+		ID:      a.id,
+		Object:  object,
+		Created: a.created,
+		Model:   a.model,
+		Usage:   a.usage,
+	}
+	for index, choice := range a.choices {
+		if choice.finishReason == "" {
+			return nil, false
+		}
+		resp.Choices = append(resp.Choices, Choice{
+			Index:        index,
+			Message:      Message{Role: choice.role, Content: choice.content.String()},
+			FinishReason: choice.finishReason,
+		})
+	}
+	sort.Slice(resp.Choices, func(i, j int) bool { return resp.Choices[i].Index < resp.Choices[j].Index })
+	return resp, true
+}
+
+// ResponseToChunks 将完整响应拆分为 OpenAI 流式响应块（不含 [DONE]）
+// 每个候选输出一个包含全部内容的块和一个结束块，includeUsage 时追加 usage 块
+// 来自旧版 /completions 接口的响应保留 text_completion 类型，供转换器识别
+func ResponseToChunks(resp *OpenAIResponse, includeUsage bool) ([][]byte, error) {
+	object := "chat.completion.chunk"
+	if resp.Object == ObjectTextCompletion {
+		object = ObjectTextCompletion
+	}
+	chunk := func(choices []interface{}, usage *Usage) ([]byte, error) {
+		data := map[string]interface{}{
+			"id":      resp.ID,
+			"object":  object,
+			"created": resp.Created,
+			"model":   resp.Model,
+			"choices": choices,
+		}
+		if usage != nil {
+			data["usage"] = usage
+		}
+		return json.Marshal(data)
+	}
+
+	var chunks [][]byte
+	for _, choice := range resp.Choices {
+		delta := map[string]interface{}{"role": choice.Message.Role, "content": choice.Message.Content}
+		if choice.Message.ReasoningContent != "" {
+			delta["reasoning_content"] = choice.Message.ReasoningContent
+		}
+		if len(choice.Message.ToolCalls) > 0 {
+			calls := make([]ToolCall, len(choice.Message.ToolCalls))
+			for i, call := range choice.Message.ToolCalls {
+				index := i
+				call.Index = &index
+				calls[i] = call
+			}
+			delta["tool_calls"] = calls
+		}
+		contentChoice := map[string]interface{}{
+			"index":         choice.Index,
+			"delta":         delta,
+			"finish_reason": nil,
+		}
+		if hasLogprobs(choice.Logprobs) {
+			contentChoice["logprobs"] = choice.Logprobs
+		}
+		content, err := chunk([]interface{}{contentChoice}, nil)
+		if err != nil {
+			return nil, err
+		}
+		finish, err := chunk([]interface{}{map[string]interface{}{
+			"index":         choice.Index,
+			"delta":         map[string]interface{}{},
+			"finish_reason": choice.FinishReason,
+		}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, content, finish)
+	}
+
+	if includeUsage {
+		usage, err := chunk([]interface{}{}, &resp.Usage)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, usage)
+	}
+	return chunks, nil
+}
+
+// hasLogprobs logprobs 字段是否有内容
+func hasLogprobs(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
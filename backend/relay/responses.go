@@ -0,0 +1,683 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// responsesRequest OpenAI Responses API 请求
+// 网关不保存响应，依赖服务端状态的字段（previous_response_id、conversation 等）不受支持
+type responsesRequest struct {
+	Model              string          `json:"model"`
+	Input              json.RawMessage `json:"input"` // 字符串或输入项数组
+	Instructions       string          `json:"instructions,omitempty"`
+	MaxOutputTokens    int             `json:"max_output_tokens,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"top_p,omitempty"`
+	TopLogProbs        int             `json:"top_logprobs,omitempty"`
+	Stream             bool            `json:"stream,omitempty"`
+	User               string          `json:"user,omitempty"`
+	PromptCacheKey     string          `json:"prompt_cache_key,omitempty"`
+	ParallelToolCalls  *bool           `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseID string          `json:"previous_response_id,omitempty"`
+	Conversation       json.RawMessage `json:"conversation,omitempty"`
+	Background         bool            `json:"background,omitempty"`
+	Reasoning          *struct {
+		Effort  string `json:"effort,omitempty"`
+		Summary string `json:"summary,omitempty"`
+	} `json:"reasoning,omitempty"`
+	Text *struct {
+		Format *struct {
+			Type   string                 `json:"type"` // "text" | "json_object" | "json_schema"
+			Name   string                 `json:"name,omitempty"`
+			Schema map[string]interface{} `json:"schema,omitempty"`
+			Strict *bool                  `json:"strict,omitempty"`
+		} `json:"format,omitempty"`
+	} `json:"text,omitempty"`
+	Tools []struct {
+		Type        string                 `json:"type"`
+		Name        string                 `json:"name,omitempty"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	} `json:"tools,omitempty"`
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"` // 字符串或 {"type": "function", "name": ...}
+}
+
+// responsesItem Responses API 输入项，不同类型使用不同字段
+type responsesItem struct {
+	Type string `json:"type"` // 省略时视为 message
+
+	// message
+	Role    string          `json:"role,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"` // 字符串或内容数组
+
+	// function_call / function_call_output
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"` // 字符串或内容数组
+}
+
+// responsesContent Responses API 消息内容
+type responsesContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	FileURL  string `json:"file_url,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// ResponsesToUnified 将 Responses API 请求转换为统一格式
+// instructions 作为 system 消息，function_call/function_call_output 输入项转换为 tool_calls 和 tool 消息
+// 历史中的 reasoning 输入项不会发送给上游
+func ResponsesToUnified(body []byte) (*UnifiedRequest, error) {
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse Responses request: %w", err)
+	}
+	switch {
+	case req.PreviousResponseID != "":
+		return nil, fmt.Errorf("previous_response_id is not supported: responses are not stored")
+	case len(req.Conversation) > 0 && string(req.Conversation) != "null":
+		return nil, fmt.Errorf("conversation is not supported: responses are not stored")
+	case req.Background:
+		return nil, fmt.Errorf("background mode is not supported")
+	}
+
+	unified := &UnifiedRequest{
+		Model:             req.Model,
+		MaxTokens:         req.MaxOutputTokens,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		User:              req.User,
+		PromptCacheKey:    req.PromptCacheKey,
+		ParallelToolCalls: req.ParallelToolCalls,
+		ExtraFields:       extraFields(body, responsesFields),
+		ExtraFormat:       FormatResponses,
+	}
+	if req.TopLogProbs > 0 {
+		unified.LogProbs = true
+		unified.TopLogProbs = req.TopLogProbs
+	}
+
+	if req.Instructions != "" {
+		unified.Messages = append(unified.Messages, UnifiedMessage{Role: "system", Content: req.Instructions})
+	}
+	messages, err := responsesInputToUnified(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	unified.Messages = append(unified.Messages, messages...)
+
+	if req.Reasoning != nil && req.Reasoning.Effort != "" && req.Reasoning.Effort != "none" {
+		unified.ThinkingConfig = &ThinkingConfig{Enabled: true, Effort: req.Reasoning.Effort}
+	}
+
+	if req.Text != nil && req.Text.Format != nil {
+		format := req.Text.Format
+		switch format.Type {
+		case "json_schema":
+			schema := map[string]interface{}{"name": format.Name, "schema": format.Schema}
+			if format.Strict != nil {
+				schema["strict"] = *format.Strict
+			}
+			unified.ResponseFormat = &ResponseFormat{Type: "json_schema", JSONSchema: schema}
+		case "json_object":
+			unified.ResponseFormat = &ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	// 转换工具，只支持函数工具
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool type '%s' is not supported", tool.Type)
+		}
+		unified.Tools = append(unified.Tools, Tool{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(req.ToolChoice) > 0 && string(req.ToolChoice) != "null" {
+		var mode string
+		var choice struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		}
+		switch {
+		case json.Unmarshal(req.ToolChoice, &mode) == nil:
+			unified.ToolChoice = mode
+		case json.Unmarshal(req.ToolChoice, &choice) == nil && choice.Type == "function":
+			unified.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice.Name},
+			}
+		default:
+			unified.ToolChoice = "auto"
+		}
+	}
+
+	return unified, nil
+}
+
+// responsesInputToUnified 转换 input，字符串形式视为一条用户消息
+// 连续的 function_call 输入项合并到前一条 assistant 消息中
+func responsesInputToUnified(raw json.RawMessage) ([]UnifiedMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []UnifiedMessage{{Role: "user", Content: text}}, nil
+	}
+	var items []responsesItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	var messages []UnifiedMessage
+	for i, item := range items {
+		switch item.Type {
+		case "", "message":
+			msg, err := responsesMessageToUnified(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid content in input item %d: %w", i, err)
+			}
+			messages = append(messages, msg)
+		case "function_call":
+			arguments := item.Arguments
+			if arguments == "" {
+				arguments = "{}"
+			}
+			call := ToolCall{ID: item.CallID, Type: "function", Function: FunctionCall{Name: item.Name, Arguments: arguments}}
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, UnifiedMessage{Role: "assistant", ToolCalls: []ToolCall{call}})
+		case "function_call_output":
+			output, err := responsesOutputText(item.Output)
+			if err != nil {
+				return nil, fmt.Errorf("invalid output in input item %d: %w", i, err)
+			}
+			messages = append(messages, UnifiedMessage{Role: "tool", Content: output, ToolCallID: item.CallID})
+		case "reasoning":
+			// 历史推理内容不转发
+		case "item_reference":
+			return nil, fmt.Errorf("input item %d: item_reference is not supported: responses are not stored", i)
+		default:
+			return nil, fmt.Errorf("input item %d: type '%s' is not supported", i, item.Type)
+		}
+	}
+	return messages, nil
+}
+
+// parseResponsesContent 解析内容，字符串形式视为单个文本
+func parseResponsesContent(raw json.RawMessage) ([]responsesContent, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []responsesContent{{Type: "input_text", Text: text}}, nil
+	}
+	var contents []responsesContent
+	if err := json.Unmarshal(raw, &contents); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// responsesMessageToUnified 转换一条消息输入项，developer 角色按 system 处理
+func responsesMessageToUnified(item responsesItem) (UnifiedMessage, error) {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	contents, err := parseResponsesContent(item.Content)
+	if err != nil {
+		return UnifiedMessage{}, err
+	}
+
+	var parts []interface{}
+	for _, content := range contents {
+		switch content.Type {
+		case "input_text", "output_text", "text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": content.Text})
+		case "refusal":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": content.Refusal})
+		case "input_image":
+			if content.ImageURL == "" {
+				return UnifiedMessage{}, fmt.Errorf("input_image requires image_url, file_id is not supported")
+			}
+			image := map[string]interface{}{"url": content.ImageURL}
+			if content.Detail != "" {
+				image["detail"] = content.Detail
+			}
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": image})
+		case "input_file":
+			data := content.FileData
+			if data == "" {
+				data = content.FileURL
+			}
+			if data == "" {
+				return UnifiedMessage{}, fmt.Errorf("input_file requires file_data or file_url, file_id is not supported")
+			}
+			file := map[string]interface{}{"file_data": data}
+			if content.Filename != "" {
+				file["filename"] = content.Filename
+			}
+			parts = append(parts, map[string]interface{}{"type": "file", "file": file})
+		default:
+			return UnifiedMessage{}, fmt.Errorf("content type '%s' is not supported", content.Type)
+		}
+	}
+
+	if role != "user" || allTextParts(parts) {
+		// 非用户消息和纯文本内容合并为字符串，兼容只接受字符串的上游
+		var text strings.Builder
+		for _, part := range parts {
+			if m, ok := part.(map[string]interface{}); ok && m["type"] == "text" {
+				text.WriteString(m["text"].(string))
+			}
+		}
+		return UnifiedMessage{Role: role, Content: text.String()}, nil
+	}
+	return UnifiedMessage{Role: role, Content: parts}, nil
+}
+
+// responsesOutputText 提取函数调用结果的文本
+func responsesOutputText(raw json.RawMessage) (string, error) {
+	contents, err := parseResponsesContent(raw)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		if content.Text != "" {
+			parts = append(parts, content.Text)
+		}
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// ResponsesResponse Responses API 响应对象
+type ResponsesResponse struct {
+	ID                string                   `json:"id"`
+	Object            string                   `json:"object"` // "response"
+	CreatedAt         int64                    `json:"created_at"`
+	Status            string                   `json:"status"` // "in_progress" | "completed" | "incomplete"
+	IncompleteDetails map[string]interface{}   `json:"incomplete_details"`
+	Error             map[string]interface{}   `json:"error"`
+	Model             string                   `json:"model"`
+	Output            []map[string]interface{} `json:"output"`
+	ParallelToolCalls bool                     `json:"parallel_tool_calls"`
+	Store             bool                     `json:"store"`
+	Usage             *ResponsesUsage          `json:"usage"`
+}
+
+// ResponsesUsage Responses API 用量
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+func toResponsesUsage(usage Usage) *ResponsesUsage {
+	out := &ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+	out.InputTokensDetails.CachedTokens = usage.CachedTokens()
+	if out.TotalTokens == 0 {
+		out.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return out
+}
+
+// responsesID 将上游响应 ID 转换为 Responses 风格的 ID
+func responsesID(id string) string {
+	if strings.HasPrefix(id, "resp_") {
+		return id
+	}
+	return "resp_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// newResponsesResponse 构造响应对象，并按 finish_reason 设置完成状态
+func newResponsesResponse(id, model string, createdAt int64, finishReason string) *ResponsesResponse {
+	resp := &ResponsesResponse{
+		ID:                responsesID(id),
+		Object:            "response",
+		CreatedAt:         createdAt,
+		Status:            "completed",
+		Model:             model,
+		Output:            []map[string]interface{}{},
+		ParallelToolCalls: true,
+	}
+	switch finishReason {
+	case "length":
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = map[string]interface{}{"reason": "max_output_tokens"}
+	case "content_filter":
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = map[string]interface{}{"reason": "content_filter"}
+	}
+	return resp
+}
+
+// 输出项 ID 以响应 ID 为后缀，函数调用沿用上游的调用 ID
+func reasoningItemID(respID string) string { return "rs_" + strings.TrimPrefix(respID, "resp_") }
+func messageItemID(respID string) string   { return "msg_" + strings.TrimPrefix(respID, "resp_") }
+func functionCallItemID(respID string, call ToolCall, index int) string {
+	if call.ID != "" {
+		return "fc_" + strings.TrimPrefix(call.ID, "call_")
+	}
+	return fmt.Sprintf("fc_%s_%d", strings.TrimPrefix(respID, "resp_"), index)
+}
+
+func reasoningItem(id, text string) map[string]interface{} {
+	summary := []interface{}{}
+	if text != "" {
+		summary = append(summary, map[string]interface{}{"type": "summary_text", "text": text})
+	}
+	return map[string]interface{}{"type": "reasoning", "id": id, "summary": summary}
+}
+
+func outputText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+}
+
+func messageItem(id, status string, content []interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "message", "id": id, "status": status, "role": "assistant", "content": content}
+}
+
+func functionCallItem(id, status string, call ToolCall) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function_call", "id": id, "status": status,
+		"call_id": call.ID, "name": call.Function.Name, "arguments": call.Function.Arguments,
+	}
+}
+
+// OpenAIToResponsesResponse 将 OpenAI 格式的响应转换为 Responses 格式，只使用第一个候选
+// 推理内容作为 reasoning 输出项的摘要返回
+func OpenAIToResponsesResponse(resp *OpenAIResponse) *ResponsesResponse {
+	var choice Choice
+	if len(resp.Choices) > 0 {
+		choice = resp.Choices[0]
+	}
+	createdAt := resp.Created
+	if createdAt == 0 {
+		createdAt = time.Now().Unix()
+	}
+	out := newResponsesResponse(resp.ID, resp.Model, createdAt, choice.FinishReason)
+	out.Usage = toResponsesUsage(resp.Usage)
+
+	if choice.Message.ReasoningContent != "" {
+		out.Output = append(out.Output, reasoningItem(reasoningItemID(out.ID), choice.Message.ReasoningContent))
+	}
+	if text := extractTextFromContent(choice.Message.Content); text != "" {
+		out.Output = append(out.Output, messageItem(messageItemID(out.ID), "completed", []interface{}{outputText(text)}))
+	}
+	for i, call := range choice.Message.ToolCalls {
+		out.Output = append(out.Output, functionCallItem(functionCallItemID(out.ID, call, i), "completed", call))
+	}
+	return out
+}
+
+// ResponsesErrorEvent 构造 Responses API 流式 error 事件的数据
+func ResponsesErrorEvent(message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":    "error",
+		"code":    "server_error",
+		"message": message,
+		"param":   nil,
+	})
+	return body
+}
+
+// ResponsesStreamConverter 将 OpenAI 格式的流式响应转换为 Responses API 的 SSE 事件序列：
+// response.created、response.in_progress、各输出项的 added/delta/done 事件，最后是 response.completed
+type ResponsesStreamConverter struct {
+	model     string
+	id        string
+	createdAt int64
+
+	sequence     int
+	started      bool
+	finished     bool
+	output       []map[string]interface{} // 已完成的输出项
+	openItem     string                   // 当前未结束的输出项类型，为空表示没有
+	text         strings.Builder          // 当前输出项累积的文本或参数
+	call         ToolCall                 // 当前函数调用
+	toolIndex    int                      // 当前函数调用在上游响应中的序号
+	finishReason string
+}
+
+func NewResponsesStreamConverter(model string) *ResponsesStreamConverter {
+	return &ResponsesStreamConverter{model: model, createdAt: time.Now().Unix(), toolIndex: -1}
+}
+
+// event 构造一个流式事件，data 中的 type 与事件名相同并带递增的 sequence_number
+func (c *ResponsesStreamConverter) event(name string, data map[string]interface{}) *SSEEvent {
+	data["type"] = name
+	data["sequence_number"] = c.sequence
+	c.sequence++
+	body, _ := json.Marshal(data)
+	return &SSEEvent{Event: name, Data: string(body), HasData: true, Retry: -1}
+}
+
+func (c *ResponsesStreamConverter) response(status string) *ResponsesResponse {
+	resp := newResponsesResponse(c.id, c.model, c.createdAt, c.finishReason)
+	if status != "" {
+		resp.Status = status
+	}
+	resp.Output = append(resp.Output, c.output...)
+	return resp
+}
+
+func (c *ResponsesStreamConverter) start(id, model string) []*SSEEvent {
+	c.started = true
+	c.id = responsesID(id)
+	if id == "" {
+		c.id = fmt.Sprintf("resp_%d", time.Now().UnixNano())
+	}
+	if model != "" {
+		c.model = model
+	}
+	resp := c.response("in_progress")
+	return []*SSEEvent{
+		c.event("response.created", map[string]interface{}{"response": resp}),
+		c.event("response.in_progress", map[string]interface{}{"response": resp}),
+	}
+}
+
+func (c *ResponsesStreamConverter) itemID() string {
+	switch c.openItem {
+	case "reasoning":
+		return reasoningItemID(c.id)
+	case "message":
+		return messageItemID(c.id)
+	default:
+		return functionCallItemID(c.id, c.call, c.toolIndex)
+	}
+}
+
+// openNew 结束当前输出项并开始一个新输出项
+func (c *ResponsesStreamConverter) openNew(events []*SSEEvent, itemType string) []*SSEEvent {
+	events = c.closeItem(events)
+	c.openItem = itemType
+	c.text.Reset()
+
+	index := len(c.output)
+	id := c.itemID()
+	switch itemType {
+	case "reasoning":
+		return append(events,
+			c.event("response.output_item.added", map[string]interface{}{"output_index": index, "item": reasoningItem(id, "")}),
+			c.event("response.reasoning_summary_part.added", map[string]interface{}{
+				"item_id": id, "output_index": index, "summary_index": 0, "part": map[string]interface{}{"type": "summary_text", "text": ""},
+			}))
+	case "message":
+		return append(events,
+			c.event("response.output_item.added", map[string]interface{}{"output_index": index, "item": messageItem(id, "in_progress", []interface{}{})}),
+			c.event("response.content_part.added", map[string]interface{}{
+				"item_id": id, "output_index": index, "content_index": 0, "part": outputText(""),
+			}))
+	default:
+		return append(events, c.event("response.output_item.added", map[string]interface{}{
+			"output_index": index, "item": functionCallItem(id, "in_progress", c.call),
+		}))
+	}
+}
+
+func (c *ResponsesStreamConverter) delta(events []*SSEEvent, delta string) []*SSEEvent {
+	c.text.WriteString(delta)
+	data := map[string]interface{}{"item_id": c.itemID(), "output_index": len(c.output), "delta": delta}
+	switch c.openItem {
+	case "reasoning":
+		data["summary_index"] = 0
+		return append(events, c.event("response.reasoning_summary_text.delta", data))
+	case "message":
+		data["content_index"] = 0
+		return append(events, c.event("response.output_text.delta", data))
+	default:
+		return append(events, c.event("response.function_call_arguments.delta", data))
+	}
+}
+
+// closeItem 输出当前输出项的 done 事件并记录完整的输出项
+func (c *ResponsesStreamConverter) closeItem(events []*SSEEvent) []*SSEEvent {
+	if c.openItem == "" {
+		return events
+	}
+	index := len(c.output)
+	id := c.itemID()
+	text := c.text.String()
+
+	var item map[string]interface{}
+	switch c.openItem {
+	case "reasoning":
+		part := map[string]interface{}{"type": "summary_text", "text": text}
+		events = append(events,
+			c.event("response.reasoning_summary_text.done", map[string]interface{}{
+				"item_id": id, "output_index": index, "summary_index": 0, "text": text,
+			}),
+			c.event("response.reasoning_summary_part.done", map[string]interface{}{
+				"item_id": id, "output_index": index, "summary_index": 0, "part": part,
+			}))
+		item = reasoningItem(id, text)
+	case "message":
+		events = append(events,
+			c.event("response.output_text.done", map[string]interface{}{
+				"item_id": id, "output_index": index, "content_index": 0, "text": text,
+			}),
+			c.event("response.content_part.done", map[string]interface{}{
+				"item_id": id, "output_index": index, "content_index": 0, "part": outputText(text),
+			}))
+		item = messageItem(id, "completed", []interface{}{outputText(text)})
+	default:
+		c.call.Function.Arguments = text
+		events = append(events, c.event("response.function_call_arguments.done", map[string]interface{}{
+			"item_id": id, "output_index": index, "arguments": text,
+		}))
+		item = functionCallItem(id, "completed", c.call)
+	}
+
+	c.openItem = ""
+	c.output = append(c.output, item)
+	return append(events, c.event("response.output_item.done", map[string]interface{}{"output_index": index, "item": item}))
+}
+
+// Convert 转换一个上游事件，只处理第一个候选
+func (c *ResponsesStreamConverter) Convert(event *SSEEvent) []*SSEEvent {
+	if c.finished || !event.HasData || event.IsDone() {
+		return nil
+	}
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil
+	}
+
+	var events []*SSEEvent
+	if !c.started {
+		events = append(events, c.start(chunk.ID, chunk.Model)...)
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		delta := choice.Delta
+		if delta.ReasoningContent != "" {
+			if c.openItem != "reasoning" {
+				events = c.openNew(events, "reasoning")
+			}
+			events = c.delta(events, delta.ReasoningContent)
+		}
+		if delta.Content != "" {
+			if c.openItem != "message" {
+				events = c.openNew(events, "message")
+			}
+			events = c.delta(events, delta.Content)
+		}
+		for i, call := range delta.ToolCalls {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if c.openItem != "function_call" || index != c.toolIndex || call.ID != "" {
+				events = c.closeItem(events)
+				c.toolIndex = index
+				c.call = ToolCall{ID: call.ID, Type: "function", Function: FunctionCall{Name: call.Function.Name}}
+				events = c.openNew(events, "function_call")
+			}
+			if call.Function.Arguments != "" {
+				events = c.delta(events, call.Function.Arguments)
+			}
+		}
+		if choice.FinishReason != "" {
+			c.finishReason = choice.FinishReason
+			events = c.closeItem(events)
+		}
+	}
+	return events
+}
+
+// Finish 结束所有输出项并输出包含完整输出和最终用量的 response.completed（截断时为 response.incomplete）
+func (c *ResponsesStreamConverter) Finish(usage Usage) []*SSEEvent {
+	if c.finished {
+		return nil
+	}
+	c.finished = true
+
+	var events []*SSEEvent
+	if !c.started {
+		events = append(events, c.start("", "")...)
+	}
+	events = c.closeItem(events)
+
+	resp := c.response("")
+	resp.Usage = toResponsesUsage(usage)
+	name := "response.completed"
+	if resp.Status == "incomplete" {
+		name = "response.incomplete"
+	}
+	return append(events, c.event(name, map[string]interface{}{"response": resp}))
+}
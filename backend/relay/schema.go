@@ -0,0 +1,292 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaDepth $ref 展开的最大深度，防止循环引用
+const maxSchemaDepth = 32
+
+// ValidateJSONSchema 校验 JSON 值是否符合 JSON Schema
+// 支持结构化输出常用的关键字：type、enum、const、properties、required、additionalProperties、items、
+// 长度和数值范围、pattern、anyOf/oneOf/allOf/not，以及指向 #/$defs 或 #/definitions 的 $ref
+// 错误信息以 $ 开头的路径指出第一个不符合的位置
+func ValidateJSONSchema(schema map[string]interface{}, value interface{}) error {
+	v := &schemaValidator{root: schema}
+	return v.validate(schema, value, "$", 0)
+}
+
+type schemaValidator struct {
+	root map[string]interface{}
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string, depth int) error {
+	if depth > maxSchemaDepth {
+		return fmt.Errorf("%s: schema nesting too deep", path)
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := v.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if err := checkType(schema["type"], value, path); err != nil {
+		return err
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsJSON(enum, value) {
+		return fmt.Errorf("%s: value is not one of the allowed values", path)
+	}
+	if constant, ok := schema["const"]; ok && !equalJSON(constant, value) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if err := v.validateObject(schema, typed, path, depth); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := v.validateArray(schema, typed, path, depth); err != nil {
+			return err
+		}
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if min, ok := schemaInt(schema, "minLength"); ok && length < min {
+			return fmt.Errorf("%s: string shorter than %d characters", path, min)
+		}
+		if max, ok := schemaInt(schema, "maxLength"); ok && length > max {
+			return fmt.Errorf("%s: string longer than %d characters", path, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern %q: %w", path, pattern, err)
+			}
+			if !re.MatchString(typed) {
+				return fmt.Errorf("%s: string does not match pattern %q", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && typed < min {
+			return fmt.Errorf("%s: %v is less than minimum %v", path, typed, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && typed > max {
+			return fmt.Errorf("%s: %v is greater than maximum %v", path, typed, max)
+		}
+		if min, ok := schema["exclusiveMinimum"].(float64); ok && typed <= min {
+			return fmt.Errorf("%s: %v is not greater than %v", path, typed, min)
+		}
+		if max, ok := schema["exclusiveMaximum"].(float64); ok && typed >= max {
+			return fmt.Errorf("%s: %v is not less than %v", path, typed, max)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				if err := v.validate(subSchema, value, path, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && v.countMatches(anyOf, value, path, depth) == 0 {
+		return fmt.Errorf("%s: value does not match any of the anyOf schemas", path)
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if matches := v.countMatches(oneOf, value, path, depth); matches != 1 {
+			return fmt.Errorf("%s: value matches %d of the oneOf schemas, expected exactly one", path, matches)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && v.validate(not, value, path, depth+1) == nil {
+		return fmt.Errorf("%s: value must not match the 'not' schema", path)
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateObject(schema, object map[string]interface{}, path string, depth int) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, exists := object[key]; !exists {
+					return fmt.Errorf("%s: missing required property '%s'", path, key)
+				}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	for key, field := range object {
+		fieldPath := path + "." + key
+		if propSchema, ok := properties[key].(map[string]interface{}); ok {
+			if err := v.validate(propSchema, field, fieldPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: additional property '%s' is not allowed", path, key)
+			}
+		case map[string]interface{}:
+			if err := v.validate(additional, field, fieldPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) validateArray(schema map[string]interface{}, array []interface{}, path string, depth int) error {
+	if min, ok := schemaInt(schema, "minItems"); ok && len(array) < min {
+		return fmt.Errorf("%s: array has fewer than %d items", path, min)
+	}
+	if max, ok := schemaInt(schema, "maxItems"); ok && len(array) > max {
+		return fmt.Errorf("%s: array has more than %d items", path, max)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range array {
+			if err := v.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *schemaValidator) countMatches(schemas []interface{}, value interface{}, path string, depth int) int {
+	matches := 0
+	for _, sub := range schemas {
+		if subSchema, ok := sub.(map[string]interface{}); ok && v.validate(subSchema, value, path, depth+1) == nil {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolve 解析文档内的 $ref，只支持 # 开头的 JSON Pointer
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var node interface{} = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot resolve $ref %q", ref)
+		}
+		node = object[part]
+	}
+	target, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot resolve $ref %q", ref)
+	}
+	return target, nil
+}
+
+// checkType 校验 type 关键字，支持字符串和字符串数组两种写法
+func checkType(typeSpec, value interface{}, path string) error {
+	var types []string
+	switch t := typeSpec.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+	default:
+		return nil
+	}
+	for _, t := range types {
+		if matchesType(t, value) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonTypeName(value))
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaInt(schema map[string]interface{}, key string) (int, bool) {
+	n, ok := schema[key].(float64)
+	return int(n), ok
+}
+
+func containsJSON(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equalJSON(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON 按 JSON 语义比较两个值
+func equalJSON(a, b interface{}) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(left) == string(right)
+}
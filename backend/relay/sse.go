@@ -0,0 +1,247 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SSEEvent 一个完整的 Server-Sent Events 事件
+// 字段含义见 https://html.spec.whatwg.org/multipage/server-sent-events.html
+type SSEEvent struct {
+	Comments []string // 以 ":" 开头的注释行（常用于保活）
+	ID       string
+	HasID    bool // id 允许为空字符串（表示重置 Last-Event-ID），需单独标记
+	Event    string
+	Data     string // 多行 data 以 "\n" 连接
+	HasData  bool
+	Retry    int // 重连间隔（毫秒），-1 表示未设置
+}
+
+// IsDone 是否为 OpenAI 风格的 [DONE] 结束标记
+func (e *SSEEvent) IsDone() bool {
+	return e.HasData && strings.TrimSpace(e.Data) == "[DONE]"
+}
+
+// empty 事件中不包含任何字段
+func (e *SSEEvent) empty() bool {
+	return len(e.Comments) == 0 && !e.HasID && e.Event == "" && !e.HasData && e.Retry < 0
+}
+
+// SSEReader 按规范解析 SSE 流，不限制单行长度
+type SSEReader struct {
+	br     *bufio.Reader
+	skipLF bool // 上一行以 "\r" 结束，紧随其后的 "\n" 与它组成同一个换行符
+	eof    bool
+}
+
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{br: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// readLine 读取一行，支持 "\n"、"\r\n" 和 "\r" 三种换行符
+// 读到换行符即返回，不等待后续数据；"\r" 之后的 "\n" 在读取下一行时跳过
+func (r *SSEReader) readLine() (string, error) {
+	if r.eof {
+		return "", io.EOF
+	}
+	if r.skipLF {
+		r.skipLF = false
+		next, err := r.br.Peek(1)
+		if err != nil {
+			r.eof = err == io.EOF
+			return "", err
+		}
+		if next[0] == '\n' {
+			r.br.Discard(1)
+		}
+	}
+
+	var line []byte
+	for {
+		// 至少等到一个字节，再在已缓冲的数据中查找换行符
+		if _, err := r.br.Peek(1); err != nil {
+			if err != io.EOF {
+				return "", err
+			}
+			r.eof = true
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			return string(line), nil
+		}
+		buffered, _ := r.br.Peek(r.br.Buffered())
+		if i := bytes.IndexAny(buffered, "\r\n"); i >= 0 {
+			line = append(line, buffered[:i]...)
+			r.skipLF = buffered[i] == '\r'
+			r.br.Discard(i + 1)
+			return string(line), nil
+		}
+		line = append(line, buffered...)
+		r.br.Discard(len(buffered))
+	}
+}
+
+// Next 读取下一个事件，流结束时返回 io.EOF
+// 与规范不同，流末尾缺少空行的事件也会返回，以免丢失最后一个数据块
+func (r *SSEReader) Next() (*SSEEvent, error) {
+	event := &SSEEvent{Retry: -1}
+	var data strings.Builder
+
+	finish := func() *SSEEvent {
+		event.Data = data.String()
+		return event
+	}
+
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			if err == io.EOF && !event.empty() {
+				return finish(), nil
+			}
+			return nil, err
+		}
+
+		// 空行分隔事件
+		if line == "" {
+			if event.empty() {
+				continue
+			}
+			return finish(), nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			event.Comments = append(event.Comments, line[1:])
+			continue
+		}
+
+		field, value := line, ""
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			field = line[:idx]
+			value = strings.TrimPrefix(line[idx+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			if event.HasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			event.HasData = true
+		case "event":
+			event.Event = value
+		case "id":
+			// 规范要求忽略包含 NUL 的 id
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+				event.HasID = true
+			}
+		case "retry":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				event.Retry = n
+			}
+		}
+		// 其他字段按规范忽略
+	}
+}
+
+// SSEWriter 将事件按规范序列化写出，每个事件写完后立即 flush
+type SSEWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func NewSSEWriter(w io.Writer) *SSEWriter {
+	flusher, _ := w.(http.Flusher)
+	return &SSEWriter{w: w, flusher: flusher}
+}
+
+// WriteEvent 写出一个完整事件（以空行结尾）
+func (w *SSEWriter) WriteEvent(event *SSEEvent) error {
+	var b strings.Builder
+	for _, comment := range event.Comments {
+		b.WriteString(":")
+		b.WriteString(comment)
+		b.WriteString("\n")
+	}
+	if event.HasID {
+		b.WriteString("id: ")
+		b.WriteString(event.ID)
+		b.WriteString("\n")
+	}
+	if event.Event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event.Event)
+		b.WriteString("\n")
+	}
+	if event.Retry >= 0 {
+		b.WriteString("retry: ")
+		b.WriteString(strconv.Itoa(event.Retry))
+		b.WriteString("\n")
+	}
+	if event.HasData {
+		for _, line := range strings.Split(event.Data, "\n") {
+			b.WriteString("data: ")
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n")
+
+	if _, err := io.WriteString(w.w, b.String()); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// WriteData 写出只包含 data 字段的事件
+func (w *SSEWriter) WriteData(data string) error {
+	return w.WriteEvent(&SSEEvent{Data: data, HasData: true, Retry: -1})
+}
+
+// WriteNamed 写出带事件类型的 data 事件
+func (w *SSEWriter) WriteNamed(event, data string) error {
+	return w.WriteEvent(&SSEEvent{Event: event, Data: data, HasData: true, Retry: -1})
+}
+
+func (w *SSEWriter) Flush() {
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+}
+
+// ForwardStreamResponse 逐事件转发 SSE 流式响应，保持事件边界不变
+// handle 可在转发前检查或修改事件，返回 false 则丢弃该事件；为 nil 时原样转发
+// 转发 [DONE] 后即结束，resp.Body 由本函数关闭
+func ForwardStreamResponse(resp *http.Response, writer *SSEWriter, handle func(event *SSEEvent) bool) error {
+	defer resp.Body.Close()
+	return ForwardEvents(NewSSEReader(resp.Body).Next, writer, handle)
+}
+
+// ForwardEvents 从 next 逐个读取事件并转发，next 返回 io.EOF 表示正常结束
+// handle 的行为与 ForwardStreamResponse 相同
+func ForwardEvents(next func() (*SSEEvent, error), writer *SSEWriter, handle func(event *SSEEvent) bool) error {
+	for {
+		event, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if handle != nil && !handle(event) {
+			continue
+		}
+		if err := writer.WriteEvent(event); err != nil {
+			return err
+		}
+		if event.IsDone() {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvents 读取全部事件，以 "事件类型|数据" 表示
+func readEvents(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	reader := NewSSEReader(r)
+	var events []string
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		events = append(events, event.Event+"|"+event.Data)
+	}
+}
+
+func TestSSEReaderLineEndings(t *testing.T) {
+	// 以 "\n" 书写的流，按各种换行符替换后解析结果应相同
+	stream := ": keep-alive\n\n" +
+		"data: {\"a\":1}\n\n" +
+		"event: delta\ndata: line1\ndata: line2\n\n" +
+		"id: 7\nretry: 100\ndata:\n\n" +
+		"data: [DONE]\n\n" +
+		"data: tail"
+	want := []string{"|", `|{"a":1}`, "delta|line1\nline2", "|", "|[DONE]", "|tail"}
+
+	tests := []struct {
+		name       string
+		terminator string
+	}{
+		{name: "LF", terminator: "\n"},
+		{name: "CRLF", terminator: "\r\n"},
+		{name: "CR", terminator: "\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := strings.ReplaceAll(stream, "\n", tt.terminator)
+			if got := readEvents(t, strings.NewReader(input)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("events = %q, want %q", got, want)
+			}
+			// 逐字节读取时换行符可能被拆开
+			if got := readEvents(t, &oneByteReader{input}); !reflect.DeepEqual(got, want) {
+				t.Fatalf("events read byte by byte = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestSSEReaderMixedLineEndings(t *testing.T) {
+	input := "data: a\r\ndata: b\rdata: c\n\r\n\rdata: d\r\r\n"
+	want := []string{"|a\nb\nc", "|d"}
+	if got := readEvents(t, strings.NewReader(input)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+func TestSSEReaderLongLine(t *testing.T) {
+	data := strings.Repeat("x", 200*1024)
+	for _, terminator := range []string{"\n", "\r\n", "\r"} {
+		input := "data: " + data + terminator + terminator
+		if got := readEvents(t, strings.NewReader(input)); len(got) != 1 || got[0] != "|"+data {
+			t.Fatalf("terminator %q: long line not read intact", terminator)
+		}
+	}
+}
+
+// 事件在空行到达时立即返回，不等待后续数据或流结束
+func TestSSEReaderIncremental(t *testing.T) {
+	for _, terminator := range []string{"\n", "\r\n", "\r"} {
+		pr, pw := io.Pipe()
+		reader := NewSSEReader(pr)
+		events := make(chan string)
+		go func() {
+			for {
+				event, err := reader.Next()
+				if err != nil {
+					close(events)
+					return
+				}
+				events <- event.Data
+			}
+		}()
+
+		for _, data := range []string{"first", "second"} {
+			go pw.Write([]byte("data: " + data + terminator + terminator))
+			select {
+			case got := <-events:
+				if got != data {
+					t.Fatalf("terminator %q: event = %q, want %q", terminator, got, data)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("terminator %q: event %q not delivered before more data arrived", terminator, data)
+			}
+		}
+		pw.Close()
+		if _, ok := <-events; ok {
+			t.Fatalf("terminator %q: unexpected event after close", terminator)
+		}
+	}
+}
+
+// oneByteReader 每次只返回一个字节
+type oneByteReader struct {
+	s string
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = r.s[0]
+	r.s = r.s[1:]
+	return 1, nil
+}
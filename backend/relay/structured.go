@@ -0,0 +1,264 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StructuredOutputTool 不支持 response_format 的平台上用于强制结构化输出的工具名
+const StructuredOutputTool = "json_response"
+
+// ErrInvalidStructuredOutput 返回内容不是合法 JSON 或不符合 JSON Schema
+var ErrInvalidStructuredOutput = errors.New("invalid structured output")
+
+// IsJSON 是否要求模型返回 JSON（json_object 或 json_schema）
+func (f *ResponseFormat) IsJSON() bool {
+	return f != nil && (f.Type == "json_object" || f.Type == "json_schema")
+}
+
+// Schema 返回 json_schema 中的 JSON Schema，没有时返回 nil
+func (f *ResponseFormat) Schema() map[string]interface{} {
+	if f == nil || f.Type != "json_schema" {
+		return nil
+	}
+	schema, _ := f.JSONSchema["schema"].(map[string]interface{})
+	return schema
+}
+
+// UsesStructuredOutputTool 发往 platform 的请求是否通过强制调用 StructuredOutputTool 实现结构化输出
+// 此时上游返回的工具调用需要用 UnwrapStructuredOutput 或 StructuredOutputStream 还原为文本
+func UsesStructuredOutputTool(unified *UnifiedRequest, platform Platform) bool {
+	return platform == PlatformAnthropic && unified.ResponseFormat.IsJSON()
+}
+
+// structuredOutputTools 在工具列表中加入 StructuredOutputTool 并返回对应的 tool_choice
+// 客户端没有其他工具时强制调用该工具，否则要求调用任一工具
+func structuredOutputTools(unified *UnifiedRequest) ([]Tool, interface{}) {
+	params := unified.ResponseFormat.Schema()
+	if params == nil {
+		params = map[string]interface{}{"type": "object"}
+	}
+	description := "Respond to the user by calling this tool with the final answer as its arguments."
+	if name, ok := unified.ResponseFormat.JSONSchema["name"].(string); ok && name != "" {
+		description += " The arguments are the '" + name + "' object."
+	}
+	if desc, ok := unified.ResponseFormat.JSONSchema["description"].(string); ok && desc != "" {
+		description += " " + desc
+	}
+
+	tools := append(append([]Tool{}, unified.Tools...), Tool{
+		Type:     "function",
+		Function: FunctionDefinition{Name: StructuredOutputTool, Description: description, Parameters: params},
+	})
+	if len(unified.Tools) > 0 {
+		return tools, "required"
+	}
+	return tools, map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": StructuredOutputTool}}
+}
+
+// UnwrapStructuredOutput 将 StructuredOutputTool 的调用参数还原为消息文本
+// 只调用了该工具时 finish_reason 由 tool_calls 改为 stop
+func UnwrapStructuredOutput(resp *OpenAIResponse) {
+	for i := range resp.Choices {
+		choice := &resp.Choices[i]
+		var kept []ToolCall
+		found := false
+		for _, call := range choice.Message.ToolCalls {
+			if call.Function.Name != StructuredOutputTool {
+				kept = append(kept, call)
+				continue
+			}
+			found = true
+			choice.Message.Content = call.Function.Arguments
+		}
+		if !found {
+			continue
+		}
+		choice.Message.ToolCalls = kept
+		if len(kept) == 0 && choice.FinishReason == "tool_calls" {
+			choice.FinishReason = "stop"
+		}
+	}
+}
+
+// StructuredOutputStream 返回流式响应块的转换函数，将 StructuredOutputTool 的参数增量改写为文本增量
+// 工具名只出现在首个增量中，之后按 choice 和工具调用的 index 对应
+func StructuredOutputStream() func(*SSEEvent) *SSEEvent {
+	structured := make(map[string]bool)  // "choice/tool" -> 是否为结构化输出工具
+	otherCalls := make(map[float64]bool) // 调用了其他工具的 choice
+	return func(event *SSEEvent) *SSEEvent {
+		if !event.HasData || event.IsDone() {
+			return event
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return event
+		}
+		choices, _ := chunk["choices"].([]interface{})
+		changed := false
+		for _, item := range choices {
+			choice, _ := item.(map[string]interface{})
+			if choice == nil {
+				continue
+			}
+			index, _ := choice["index"].(float64)
+			delta, _ := choice["delta"].(map[string]interface{})
+			calls, _ := delta["tool_calls"].([]interface{})
+			var kept []interface{}
+			var text strings.Builder
+			unwrapped := false
+			for _, raw := range calls {
+				call, _ := raw.(map[string]interface{})
+				function, _ := call["function"].(map[string]interface{})
+				key := fmt.Sprintf("%v/%v", index, call["index"])
+				if name, _ := function["name"].(string); name == StructuredOutputTool {
+					structured[key] = true
+				}
+				if !structured[key] {
+					otherCalls[index] = true
+					kept = append(kept, raw)
+					continue
+				}
+				unwrapped = true
+				arguments, _ := function["arguments"].(string)
+				text.WriteString(arguments)
+			}
+			if unwrapped {
+				changed = true
+				if len(kept) > 0 {
+					delta["tool_calls"] = kept
+				} else {
+					delete(delta, "tool_calls")
+				}
+				if text.Len() > 0 {
+					content, _ := delta["content"].(string)
+					delta["content"] = content + text.String()
+				}
+			}
+			if reason, _ := choice["finish_reason"].(string); reason == "tool_calls" && !otherCalls[index] {
+				choice["finish_reason"] = "stop"
+				changed = true
+			}
+		}
+		if !changed {
+			return event
+		}
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return event
+		}
+		converted := *event
+		converted.Data = string(data)
+		return &converted
+	}
+}
+
+// ValidateStructuredOutput 校验各 choice 的文本是否为合法 JSON，json_schema 时还需符合 Schema
+// 调用了其他工具而没有文本的 choice 不校验
+func ValidateStructuredOutput(format *ResponseFormat, resp *OpenAIResponse) error {
+	if !format.IsJSON() {
+		return nil
+	}
+	schema := format.Schema()
+	for _, choice := range resp.Choices {
+		text := extractTextFromContent(choice.Message.Content)
+		if strings.TrimSpace(text) == "" && len(choice.Message.ToolCalls) > 0 {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return fmt.Errorf("%w: choice %d is not valid JSON: %v", ErrInvalidStructuredOutput, choice.Index, err)
+		}
+		if _, ok := value.(map[string]interface{}); !ok && schema == nil {
+			return fmt.Errorf("%w: choice %d is not a JSON object", ErrInvalidStructuredOutput, choice.Index)
+		}
+		if schema != nil {
+			if err := ValidateJSONSchema(schema, value); err != nil {
+				return fmt.Errorf("%w: choice %d: %v", ErrInvalidStructuredOutput, choice.Index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// geminiSchemaKeys Gemini responseSchema（OpenAPI 子集）支持的关键字
+var geminiSchemaKeys = fieldSet("type", "format", "title", "description", "nullable", "enum", "maxItems",
+	"minItems", "properties", "required", "minProperties", "maxProperties", "minLength", "maxLength",
+	"pattern", "anyOf", "propertyOrdering", "default", "items", "minimum", "maximum")
+
+// geminiResponseSchema 将 JSON Schema 转换为 Gemini responseSchema
+// 展开文档内的 $ref，类型数组中的 null 改为 nullable，const 改为单值 enum，oneOf 按 anyOf 处理，其他不支持的关键字被删除
+func geminiResponseSchema(schema map[string]interface{}) map[string]interface{} {
+	return convertGeminiSchema(&schemaValidator{root: schema}, schema, 0)
+}
+
+func convertGeminiSchema(v *schemaValidator, schema map[string]interface{}, depth int) map[string]interface{} {
+	if depth > maxSchemaDepth {
+		return map[string]interface{}{}
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, err := v.resolve(ref); err == nil {
+			merged := make(map[string]interface{}, len(target)+len(schema))
+			for key, value := range target {
+				merged[key] = value
+			}
+			for key, value := range schema {
+				if key != "$ref" {
+					merged[key] = value
+				}
+			}
+			return convertGeminiSchema(v, merged, depth+1)
+		}
+	}
+
+	result := make(map[string]interface{})
+	for key, value := range schema {
+		switch key {
+		case "type":
+			if types, ok := value.([]interface{}); ok {
+				for _, t := range types {
+					if t == "null" {
+						result["nullable"] = true
+					} else if _, set := result["type"]; !set {
+						result["type"] = t
+					}
+				}
+				continue
+			}
+			result[key] = value
+		case "const":
+			result["enum"] = []interface{}{value}
+		case "properties":
+			if properties, ok := value.(map[string]interface{}); ok {
+				converted := make(map[string]interface{}, len(properties))
+				for name, prop := range properties {
+					if propSchema, ok := prop.(map[string]interface{}); ok {
+						converted[name] = convertGeminiSchema(v, propSchema, depth+1)
+					}
+				}
+				result[key] = converted
+			}
+		case "items":
+			if items, ok := value.(map[string]interface{}); ok {
+				result[key] = convertGeminiSchema(v, items, depth+1)
+			}
+		case "anyOf", "oneOf":
+			if variants, ok := value.([]interface{}); ok {
+				converted := make([]interface{}, 0, len(variants))
+				for _, variant := range variants {
+					if variantSchema, ok := variant.(map[string]interface{}); ok {
+						converted = append(converted, convertGeminiSchema(v, variantSchema, depth+1))
+					}
+				}
+				result["anyOf"] = converted
+			}
+		default:
+			if geminiSchemaKeys[key] {
+				result[key] = value
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,164 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeouts 上游请求的分阶段超时，0 表示不限制
+type Timeouts struct {
+	Dial         time.Duration // TCP 连接超时
+	TLSHandshake time.Duration // TLS 握手超时
+	FirstByte    time.Duration // 流式请求：从发出请求到收到首个数据块
+	Idle         time.Duration // 流式请求：相邻数据块之间的最大间隔
+	Total        time.Duration // 非流式请求的整体超时
+}
+
+var (
+	// ErrFirstByteTimeout 流式请求在首块超时内未收到任何数据
+	ErrFirstByteTimeout = errors.New("upstream first byte timeout")
+	// ErrStreamIdleTimeout 流式响应在空闲超时内没有新的数据块
+	ErrStreamIdleTimeout = errors.New("upstream stream idle timeout")
+)
+
+// transportKey 按连接阶段超时区分 Transport，相同配置复用连接池
+type transportKey struct {
+	dial         time.Duration
+	tlsHandshake time.Duration
+}
+
+// clientFor 返回与给定超时配置匹配的 HTTP 客户端
+// 客户端本身不设置 Timeout，整体超时和流式超时由 context 控制
+func (a *OpenAIAdapter) clientFor(t Timeouts) *http.Client {
+	key := transportKey{dial: t.Dial, tlsHandshake: t.TLSHandshake}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if client, ok := a.clients[key]; ok {
+		return client
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   t.Dial,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout: t.TLSHandshake,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+	a.clients[key] = client
+	return client
+}
+
+// streamWatchdog 监控流式响应的首块与空闲超时
+// 超时后取消请求 context，使阻塞中的 Read 立即返回
+type streamWatchdog struct {
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	idle   time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	gen     int // 每次重新计时递增，避免过期的定时回调误触发
+	expired error
+	closed  bool
+}
+
+// newStreamWatchdog 在发出请求前创建，首块计时从此刻开始
+func newStreamWatchdog(cancel context.CancelFunc, t Timeouts) *streamWatchdog {
+	w := &streamWatchdog{cancel: cancel, idle: t.Idle}
+	w.mu.Lock()
+	w.arm(t.FirstByte, ErrFirstByteTimeout)
+	w.mu.Unlock()
+	return w
+}
+
+// arm 重新开始计时，d 为 0 时仅停止计时；调用方需持有锁
+func (w *streamWatchdog) arm(d time.Duration, cause error) {
+	w.gen++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if d <= 0 {
+		return
+	}
+	gen := w.gen
+	w.timer = time.AfterFunc(d, func() { w.expire(gen, cause) })
+}
+
+func (w *streamWatchdog) expire(gen int, cause error) {
+	w.mu.Lock()
+	if w.closed || gen != w.gen {
+		w.mu.Unlock()
+		return
+	}
+	w.expired = cause
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// err 返回已触发的超时错误，未超时返回 nil
+func (w *streamWatchdog) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.expired
+}
+
+// attach 绑定响应体，之后的读取由看门狗接管
+func (w *streamWatchdog) attach(body io.ReadCloser) io.ReadCloser {
+	w.body = body
+	return w
+}
+
+func (w *streamWatchdog) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 {
+		w.touch()
+	}
+	if err != nil {
+		if expired := w.err(); expired != nil {
+			return n, expired
+		}
+	}
+	return n, err
+}
+
+// touch 收到数据后切换为空闲计时
+func (w *streamWatchdog) touch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.expired != nil {
+		return
+	}
+	w.arm(w.idle, ErrStreamIdleTimeout)
+}
+
+// stop 停止计时但不关闭响应体
+func (w *streamWatchdog) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.arm(0, nil)
+}
+
+func (w *streamWatchdog) Close() error {
+	w.stop()
+	w.cancel()
+	if w.body == nil {
+		return nil
+	}
+	return w.body.Close()
+}
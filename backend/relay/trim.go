@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"fmt"
+
+	"github.com/elysia-api/backend/tokenizer"
+)
+
+// 上下文裁剪策略，同时也是模型组 contextPolicy.mode 的取值
+const (
+	TrimDropOldest = "drop-oldest" // 从最早的对话轮次开始丢弃
+	TrimMiddleOut  = "middle-out"  // 保留首轮和最近轮次，从中间开始丢弃
+)
+
+// TrimResult 上下文裁剪结果
+type TrimResult struct {
+	Strategy        string
+	DroppedMessages int
+	PromptTokens    int // 裁剪后的提示词 token 数
+}
+
+// TrimMessages 按轮次丢弃历史消息，使提示词不超过 budget 个 token
+// 系统消息和最近 keepLastTurns 轮对话始终保留；一轮从 user 消息开始，
+// 包含其后的 assistant 与 tool 消息，整轮丢弃可避免留下孤立的工具调用结果
+func TrimMessages(req *UnifiedRequest, strategy string, keepLastTurns, budget int) (TrimResult, error) {
+	result := TrimResult{Strategy: strategy, PromptTokens: EstimatePromptTokens(req)}
+	if result.PromptTokens <= budget {
+		return result, nil
+	}
+	if keepLastTurns < 1 {
+		keepLastTurns = 1
+	}
+
+	// 每条消息单独的 token 数（不含对话格式的固定开销）
+	overhead := tokenizer.CountMessages(req.Model, nil)
+	messageTokens := make([]int, len(req.Messages))
+	for i, msg := range req.Messages {
+		messageTokens[i] = tokenizer.CountMessages(req.Model, []tokenizer.ChatMessage{toChatMessage(msg)}) - overhead
+	}
+
+	// 按 user 消息划分对话轮次，系统消息不参与划分
+	var turns [][]int
+	for i, msg := range req.Messages {
+		if msg.Role == "system" {
+			continue
+		}
+		if msg.Role == "user" || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], i)
+	}
+
+	// 可丢弃的轮次
+	first, last := 0, len(turns)-keepLastTurns
+	if strategy == TrimMiddleOut {
+		first = 1
+	}
+	var droppable []int
+	for t := first; t < last; t++ {
+		droppable = append(droppable, t)
+	}
+
+	dropped := make(map[int]bool)
+	for result.PromptTokens > budget && len(droppable) > 0 {
+		pick := 0
+		if strategy == TrimMiddleOut {
+			pick = len(droppable) / 2
+		}
+		turn := droppable[pick]
+		droppable = append(droppable[:pick], droppable[pick+1:]...)
+
+		for _, idx := range turns[turn] {
+			dropped[idx] = true
+			result.PromptTokens -= messageTokens[idx]
+			result.DroppedMessages++
+		}
+	}
+
+	if result.PromptTokens > budget {
+		return result, fmt.Errorf("context length exceeded: prompt still uses %d tokens after trimming, budget is %d tokens",
+			result.PromptTokens, budget)
+	}
+
+	kept := make([]UnifiedMessage, 0, len(req.Messages)-len(dropped))
+	for i, msg := range req.Messages {
+		if !dropped[i] {
+			kept = append(kept, msg)
+		}
+	}
+	req.Messages = kept
+	// 消息已修改，原始请求体不能再直接转发
+	req.Raw = nil
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/elysia-api/backend/tokenizer"
+)
+
+// SupportsStreamUsage 目标平台是否支持 stream_options.include_usage
+func SupportsStreamUsage(platform Platform) bool {
+	switch platform {
+	case PlatformOpenAI, PlatformAzure:
+		return true
+	}
+	return false
+}
+
+// EstimatePromptTokens 使用本地分词器估算请求的提示词 token 数
+func EstimatePromptTokens(req *UnifiedRequest) int {
+	messages := make([]tokenizer.ChatMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, toChatMessage(msg))
+	}
+	total := tokenizer.CountMessages(req.Model, messages)
+
+	// 工具定义同样计入提示词
+	if len(req.Tools) > 0 {
+		if toolsJSON, err := json.Marshal(req.Tools); err == nil {
+			total += tokenizer.CountText(req.Model, string(toolsJSON))
+		}
+	}
+	return total
+}
+
+// toChatMessage 提取消息文本用于计数
+func toChatMessage(msg UnifiedMessage) tokenizer.ChatMessage {
+	content := extractTextFromContent(msg.Content)
+	for _, call := range msg.ToolCalls {
+		content += call.Function.Name + call.Function.Arguments
+	}
+	return tokenizer.ChatMessage{
+		Role:    msg.Role,
+		Content: content,
+	}
+}
+
+// EstimateResponseUsage 为未返回 usage 的非流式响应估算用量
+func EstimateResponseUsage(req *UnifiedRequest, promptTokens int, resp *OpenAIResponse) Usage {
+	usage := Usage{PromptTokens: promptTokens}
+	for _, choice := range resp.Choices {
+		usage.CompletionTokens += tokenizer.CountText(req.Model, extractTextFromContent(choice.Message.Content))
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// streamChunk OpenAI 流式响应块中用于统计的字段
+type streamChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []struct {
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// StreamUsageTracker 从 OpenAI 格式的流式响应中统计用量
+// 上游返回 usage 块时以其为准，否则根据累计输出文本估算
+type StreamUsageTracker struct {
+	model        string
+	promptTokens int // 本地估算的提示词 token 数
+	completion   strings.Builder
+	upstream     *Usage
+
+	// 最近一个数据块的元信息，用于构造补发的 usage 块
+	chunkID      string
+	chunkModel   string
+	chunkCreated int64
+}
+
+func NewStreamUsageTracker(model string, estimatedPromptTokens int) *StreamUsageTracker {
+	return &StreamUsageTracker{model: model, promptTokens: estimatedPromptTokens}
+}
+
+// Observe 记录一个 SSE 事件，返回该事件是否为仅包含 usage 的统计块
+func (t *StreamUsageTracker) Observe(event *SSEEvent) bool {
+	if !event.HasData || event.IsDone() {
+		return false
+	}
+
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return false
+	}
+	if chunk.ID != "" {
+		t.chunkID, t.chunkModel, t.chunkCreated = chunk.ID, chunk.Model, chunk.Created
+	}
+
+	for _, choice := range chunk.Choices {
+		t.completion.WriteString(choice.Delta.ReasoningContent)
+		t.completion.WriteString(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			t.completion.WriteString(call.Function.Name)
+			t.completion.WriteString(call.Function.Arguments)
+		}
+	}
+
+	if chunk.Usage != nil && chunk.Usage.TotalTokens+chunk.Usage.PromptTokens+chunk.Usage.CompletionTokens > 0 {
+		usage := *chunk.Usage
+		t.upstream = &usage
+		return len(chunk.Choices) == 0
+	}
+	return false
+}
+
+// Usage 返回最终用量，estimated 表示是否为本地估算结果
+func (t *StreamUsageTracker) Usage() (usage Usage, estimated bool) {
+	if t.upstream != nil {
+		usage = *t.upstream
+		if usage.TotalTokens == 0 {
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+		return usage, false
+	}
+
+	usage = Usage{
+		PromptTokens:     t.promptTokens,
+		CompletionTokens: tokenizer.CountText(t.model, t.completion.String()),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage, true
+}
+
+// HasUpstreamUsage 上游是否返回了 usage 块
+func (t *StreamUsageTracker) HasUpstreamUsage() bool {
+	return t.upstream != nil
+}
+
+// UsageChunk 构造一个仅包含最终用量的 OpenAI 流式响应块
+// 用于客户端请求了 include_usage 但上游未返回 usage 的情况
+func (t *StreamUsageTracker) UsageChunk() ([]byte, error) {
+	usage, _ := t.Usage()
+	return json.Marshal(map[string]interface{}{
+		"id":      t.chunkID,
+		"object":  "chat.completion.chunk",
+		"created": t.chunkCreated,
+		"model":   t.chunkModel,
+		"choices": []interface{}{},
+		"usage":   usage,
+	})
+}
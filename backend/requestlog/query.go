@@ -0,0 +1,178 @@
+package requestlog
+
+import (
+	"sort"
+	"time"
+)
+
+// Filter 记录查询条件，零值字段不参与过滤
+type Filter struct {
+	From       time.Time
+	To         time.Time
+	Token      string
+	Group      string
+	Model      string
+	Status     int
+	OnlyErrors bool
+	// 排除被限额、权限拒绝的请求
+	OnlyAdmitted bool
+}
+
+// Match 记录是否满足条件
+func (f *Filter) Match(r *Record) bool {
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+	if f.Token != "" && r.Token != f.Token {
+		return false
+	}
+	if f.Group != "" && r.Group != f.Group {
+		return false
+	}
+	if f.Model != "" && r.Model != f.Model {
+		return false
+	}
+	if f.Status != 0 && r.Status != f.Status {
+		return false
+	}
+	if f.OnlyErrors && !r.Failed() {
+		return false
+	}
+	if f.OnlyAdmitted && r.Rejected {
+		return false
+	}
+	return true
+}
+
+// Query 按时间倒序返回满足条件的记录，同时返回匹配总数
+// 倒序分页：offset 从最新的记录开始计算；扫描时只保留最近的 offset+limit 条匹配记录
+func (s *Store) Query(filter Filter, offset, limit int) ([]Record, int, error) {
+	keep := offset + limit
+	var recent []Record // 环形缓冲区，第 total 条匹配记录存放在 (total-1)%keep
+	total := 0
+	err := s.Scan(func(r *Record) bool {
+		if !filter.Match(r) {
+			return true
+		}
+		total++
+		if keep <= 0 {
+			return true
+		}
+		if len(recent) < keep {
+			recent = append(recent, *r)
+		} else {
+			recent[(total-1)%keep] = *r
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if offset >= len(recent) {
+		return []Record{}, total, nil
+	}
+	page := make([]Record, 0, len(recent)-offset)
+	for i := offset; i < len(recent); i++ {
+		page = append(page, recent[(total-1-i)%keep])
+	}
+	return page, total, nil
+}
+
+// 聚合维度
+const (
+	DimensionDay   = "day"
+	DimensionToken = "token"
+	DimensionGroup = "group"
+	DimensionModel = "model"
+)
+
+// UsageRow 一组聚合结果，未参与分组的维度为空
+type UsageRow struct {
+	Day              string  `json:"day,omitempty"`
+	Token            string  `json:"token,omitempty"`
+	Group            string  `json:"group,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+	// 合并请求的用量，已包含在上面的合计中；这部分没有产生额外的上游调用
+	SharedTokens int     `json:"sharedTokens,omitempty"`
+	SharedCost   float64 `json:"sharedCost,omitempty"`
+}
+
+// Add 累加一条记录
+func (u *UsageRow) Add(r *Record) {
+	u.Requests++
+	if r.Failed() {
+		u.Errors++
+	}
+	u.PromptTokens += r.PromptTokens
+	u.CompletionTokens += r.CompletionTokens
+	u.TotalTokens += r.TotalTokens
+	u.Cost += r.Cost
+	if r.Coalesced {
+		u.SharedTokens += r.TotalTokens
+		u.SharedCost += r.Cost
+	}
+}
+
+// Aggregate 按指定维度汇总用量，日期按 loc 时区划分
+func (s *Store) Aggregate(filter Filter, dimensions []string, loc *time.Location) ([]UsageRow, error) {
+	rows := make(map[UsageRow]*UsageRow)
+	err := s.Scan(func(r *Record) bool {
+		if !filter.Match(r) {
+			return true
+		}
+
+		var key UsageRow
+		for _, dim := range dimensions {
+			switch dim {
+			case DimensionDay:
+				key.Day = r.Time.In(loc).Format("2006-01-02")
+			case DimensionToken:
+				key.Token = r.Token
+			case DimensionGroup:
+				key.Group = r.Group
+			case DimensionModel:
+				key.Model = r.Model
+			}
+		}
+
+		row, ok := rows[key]
+		if !ok {
+			row = &UsageRow{Day: key.Day, Token: key.Token, Group: key.Group, Model: key.Model}
+			rows[key] = row
+		}
+		row.Add(r)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]UsageRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Token != b.Token {
+			return a.Token < b.Token
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Model < b.Model
+	})
+	return result, nil
+}
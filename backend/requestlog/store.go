@@ -0,0 +1,224 @@
+package requestlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认的轮转参数
+const (
+	defaultMaxFileSize = 50 * 1024 * 1024
+	defaultMaxFiles    = 10
+)
+
+// 日志文件命名：当前文件为 requests.jsonl，轮转后为 requests-<时间>.jsonl
+const (
+	currentFileName = "requests.jsonl"
+	filePrefix      = "requests-"
+	fileSuffix      = ".jsonl"
+)
+
+// Record 一条已完成请求的记录
+type Record struct {
+	Time             time.Time `json:"time"`
+	RequestID        string    `json:"requestId,omitempty"`
+	Token            string    `json:"token,omitempty"`
+	Group            string    `json:"group,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Platform         string    `json:"platform,omitempty"`
+	Format           string    `json:"format,omitempty"`
+	Path             string    `json:"path"`
+	Stream           bool      `json:"stream,omitempty"`
+	Cached           bool      `json:"cached,omitempty"`    // 由响应缓存返回
+	Coalesced        bool      `json:"coalesced,omitempty"` // 与进行中的相同请求合并
+	Rejected         bool      `json:"rejected,omitempty"`  // 被访问令牌或模型组的限额、权限拒绝，未转发
+	Status           int       `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	TotalTokens      int       `json:"totalTokens"`
+	Cost             float64   `json:"cost,omitempty"` // 美元
+	LatencyMs        int64     `json:"latencyMs"`
+	Retries          int       `json:"retries"`
+}
+
+// Failed 请求是否失败（错误状态码或流式响应中途出错）
+func (r *Record) Failed() bool {
+	return r.Status >= 400 || r.Error != ""
+}
+
+// Options 存储配置
+type Options struct {
+	Dir         string
+	MaxFileSize int64 // 单个文件最大字节数，超出后轮转
+	MaxFiles    int   // 保留的轮转文件数（不含当前文件）
+}
+
+// Store 追加写入的 JSONL 请求日志，按文件大小轮转
+type Store struct {
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open 打开（必要时创建）日志目录和当前日志文件
+func Open(opts Options) (*Store, error) {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultMaxFileSize
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultMaxFiles
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create request log directory: %w", err)
+	}
+
+	s := &Store{opts: opts}
+	if err := s.openCurrent(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) openCurrent() error {
+	file, err := os.OpenFile(filepath.Join(s.opts.Dir, currentFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open request log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Append 追加一条记录，当前文件超出大小限制时先轮转
+func (s *Store) Append(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && s.size+int64(len(line)) > s.opts.MaxFileSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate 将当前文件重命名为带时间戳的文件，并清理超出数量的旧文件
+// 调用方需持有锁
+func (s *Store) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := filePrefix + time.Now().UTC().Format("20060102T150405.000000000") + fileSuffix
+	if err := os.Rename(filepath.Join(s.opts.Dir, currentFileName), filepath.Join(s.opts.Dir, rotated)); err != nil {
+		return err
+	}
+
+	files, err := s.rotatedFiles()
+	if err == nil && len(files) > s.opts.MaxFiles {
+		for _, old := range files[:len(files)-s.opts.MaxFiles] {
+			os.Remove(old)
+		}
+	}
+
+	return s.openCurrent()
+}
+
+// rotatedFiles 返回按时间升序排列的轮转文件
+func (s *Store) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			files = append(files, filepath.Join(s.opts.Dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Scan 按时间顺序遍历所有记录，fn 返回 false 时停止
+func (s *Store) Scan(fn func(record *Record) bool) error {
+	s.mu.Lock()
+	files, err := s.rotatedFiles()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	files = append(files, filepath.Join(s.opts.Dir, currentFileName))
+
+	for _, path := range files {
+		cont, err := scanFile(path, fn)
+		if err != nil {
+			return err
+		}
+		if !cont {
+			return nil
+		}
+	}
+	return nil
+}
+
+func scanFile(path string, fn func(record *Record) bool) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 轮转过程中文件可能已被清理
+			return true, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record Record
+			// 写入中断产生的残缺行直接跳过
+			if json.Unmarshal(line, &record) == nil {
+				if !fn(&record) {
+					return false, nil
+				}
+			}
+		}
+		if err != nil {
+			return true, nil
+		}
+	}
+}
+
+// Close 关闭当前日志文件
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elysia-api/backend/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// 分页参数
+const (
+	defaultLogPageSize = 100
+	maxLogPageSize     = 1000
+)
+
+// parseTimeParam 解析时间参数，支持 RFC3339、YYYY-MM-DD（本地时区）和 Unix 秒
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected RFC3339, YYYY-MM-DD or unix seconds", value)
+}
+
+// parseLogFilter 从查询参数构造过滤条件
+func parseLogFilter(c *gin.Context) (requestlog.Filter, error) {
+	filter := requestlog.Filter{
+		Token:      c.Query("token"),
+		Group:      c.Query("group"),
+		Model:      c.Query("model"),
+		OnlyErrors: c.Query("errors") == "true",
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c.Query("from")); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(c.Query("to")); err != nil {
+		return filter, err
+	}
+	// 仅指定日期时，to 包含当天
+	if to := c.Query("to"); len(to) == len("2006-01-02") && !filter.To.IsZero() {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	if status := c.Query("status"); status != "" {
+		if filter.Status, err = strconv.Atoi(status); err != nil {
+			return filter, fmt.Errorf("invalid status '%s'", status)
+		}
+	}
+	return filter, nil
+}
+
+// adminLogs 分页查询请求记录（按时间倒序）
+func (s *Server) adminLogs(c *gin.Context) {
+	if s.requestLog == nil {
+		c.JSON(404, gin.H{"error": "request log is not enabled"})
+		return
+	}
+
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultLogPageSize
+	}
+	if limit > maxLogPageSize {
+		limit = maxLogPageSize
+	}
+
+	records, total, err := s.requestLog.Query(filter, offset, limit)
+	if err != nil {
+		s.logError(c, "Failed to query request log: %v", err)
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to query request log: %v", err)})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"object": "list",
+		"data":   records,
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+	})
+}
+
+// adminUsage 按日期、令牌、模型组（可选模型）汇总用量
+// by 参数为逗号分隔的维度列表，默认 day,token,group
+func (s *Server) adminUsage(c *gin.Context) {
+	if s.requestLog == nil {
+		c.JSON(404, gin.H{"error": "request log is not enabled"})
+		return
+	}
+
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	dimensions := []string{requestlog.DimensionDay, requestlog.DimensionToken, requestlog.DimensionGroup}
+	if by := c.Query("by"); by != "" {
+		dimensions = nil
+		for _, dim := range strings.Split(by, ",") {
+			switch dim = strings.TrimSpace(dim); dim {
+			case requestlog.DimensionDay, requestlog.DimensionToken, requestlog.DimensionGroup, requestlog.DimensionModel:
+				dimensions = append(dimensions, dim)
+			default:
+				c.JSON(400, gin.H{"error": fmt.Sprintf("invalid dimension '%s', expected day, token, group or model", dim)})
+				return
+			}
+		}
+	}
+
+	rows, err := s.requestLog.Aggregate(filter, dimensions, time.Local)
+	if err != nil {
+		s.logError(c, "Failed to aggregate request log: %v", err)
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to aggregate request log: %v", err)})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"object": "list",
+		"by":     dimensions,
+		"data":   rows,
+	})
+}
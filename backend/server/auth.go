@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elysia-api/backend/config"
+	"github.com/gin-gonic/gin"
+)
+
+// extractAPIKey 从请求中提取访问令牌
+// 支持 OpenAI（Authorization: Bearer）、Anthropic（x-api-key）和 Gemini（x-goog-api-key / ?key=）的传递方式
+func extractAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if strings.HasPrefix(strings.ToLower(auth), "bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return strings.TrimSpace(auth)
+	}
+	if key := r.Header.Get("x-api-key"); key != "" {
+		return key
+	}
+	if key := r.Header.Get("x-goog-api-key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("key")
+}
+
+// authenticate 校验调用方使用的访问令牌，并将令牌信息保存到请求上下文
+// 未配置任何令牌时不做校验
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens := s.config.GetTokens()
+		if len(tokens) == 0 {
+			c.Next()
+			return
+		}
+
+		key := extractAPIKey(c.Request)
+		if key == "" {
+			c.AbortWithStatusJSON(401, gin.H{"error": "access token required"})
+			return
+		}
+
+		var token *config.AccessToken
+		for i := range tokens {
+			if tokens[i].Token == key {
+				token = &tokens[i]
+				break
+			}
+		}
+		if token == nil || !token.Enabled {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid access token"})
+			return
+		}
+
+		c.Set(ctxKeyToken, token.Name)
+		if token.Expired(time.Now()) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "access token expired"})
+			return
+		}
+
+		c.Set(ctxKeyAccessToken, *token)
+		c.Set(ctxKeyAdmin, token.Admin)
+		c.Next()
+	}
+}
+
+// accessToken 返回当前请求使用的访问令牌，未配置令牌时返回 false
+func accessToken(c *gin.Context) (config.AccessToken, bool) {
+	if value, ok := c.Get(ctxKeyAccessToken); ok {
+		token, ok := value.(config.AccessToken)
+		return token, ok
+	}
+	return config.AccessToken{}, false
+}
+
+// allowGroup 检查访问令牌是否可以使用模型组，不可以时返回 403 并返回 false
+func allowGroup(c *gin.Context, group string) bool {
+	if token, ok := accessToken(c); ok && !token.AllowsGroup(group) {
+		c.Set(ctxKeyRejected, true)
+		c.JSON(403, gin.H{"error": fmt.Sprintf("access token is not allowed to use model group '%s'", group)})
+		return false
+	}
+	return true
+}
+
+// isAdmin 调用方是否可以访问管理功能：未配置任何令牌，或使用启用的管理员令牌
+func (s *Server) isAdmin(c *gin.Context) bool {
+	return len(s.config.GetTokens()) == 0 || c.GetBool(ctxKeyAdmin)
+}
+
+// requireAdmin 管理接口鉴权：配置了访问令牌时，只允许启用的管理员令牌访问
+// 未配置任何令牌时与其他接口一致，不做限制
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.isAdmin(c) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin token required"})
+			return
+		}
+		c.Next()
+	}
+}
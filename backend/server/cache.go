@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/elysia-api/backend/cache"
+	"github.com/elysia-api/backend/config"
+	"github.com/elysia-api/backend/metrics"
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// headerCache 响应缓存结果头，仅在模型组启用缓存且请求可缓存时返回
+const headerCache = "X-Elysia-Cache"
+
+// 缓存查找结果
+const (
+	cacheHit  = "HIT"
+	cacheMiss = "MISS"
+)
+
+// cacheKeyVersion 缓存键格式版本，键的计算方式变化时递增以使旧条目失效
+const cacheKeyVersion = "v1"
+
+// cachePruneInterval 定期清理磁盘层过期条目的间隔
+const cachePruneInterval = 10 * time.Minute
+
+// openCache 创建响应缓存，配置了磁盘目录时同时启用磁盘层，并在启动时和之后定期清理过期条目
+func (s *Server) openCache() *cache.Cache {
+	respCache, err := cache.New(cache.Options{
+		MaxEntries:   s.config.Cache.MaxEntries,
+		Dir:          s.config.Cache.Dir,
+		MaxDiskBytes: int64(s.config.Cache.MaxDiskSize) << 20,
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to open response cache directory, using memory only: %v", err))
+		respCache, _ = cache.New(cache.Options{MaxEntries: s.config.Cache.MaxEntries})
+		return respCache
+	}
+
+	if s.config.Cache.Dir != "" {
+		pruneCache(respCache)
+		go func() {
+			for range time.Tick(cachePruneInterval) {
+				pruneCache(respCache)
+			}
+		}()
+	}
+	return respCache
+}
+
+// pruneCache 清理磁盘层的过期条目和超出容量的条目
+func pruneCache(respCache *cache.Cache) {
+	if removed, err := respCache.Prune(time.Now()); err != nil {
+		slog.Error(fmt.Sprintf("Failed to prune response cache: %v", err))
+	} else if removed > 0 {
+		slog.Info(fmt.Sprintf("Pruned %d expired or evicted response cache entries", removed))
+	}
+}
+
+// cacheable 请求是否可以使用缓存：默认只缓存 temperature 为 0 的确定性请求
+func cacheable(policy *config.GroupCacheConfig, req *relay.UnifiedRequest) bool {
+	if policy == nil || !policy.Enabled {
+		return false
+	}
+	if policy.AnyTemperature {
+		return true
+	}
+	return req.Temperature != nil && *req.Temperature == 0
+}
+
+// responseCacheKey 计算请求指纹
+// 忽略不影响响应内容的字段（流式、用户标识、提示词缓存提示），流式与非流式请求共用缓存
+func responseCacheKey(group string, req *relay.UnifiedRequest) (string, error) {
+	canonical := *req
+	canonical.Model = group
+	canonical.Stream = false
+	canonical.StreamOptions = nil
+	canonical.User = ""
+	canonical.PromptCacheKey = ""
+	canonical.PromptCacheRetention = nil
+
+	body, err := json.Marshal(&canonical)
+	if err != nil {
+		return "", err
+	}
+	// ExtraFields 不参与结构体序列化，单独计入（map 按键排序输出）
+	extra, err := json.Marshal(canonical.ExtraFields)
+	if err != nil {
+		return "", err
+	}
+	return cache.Key([]byte(cacheKeyVersion), []byte(group), body, extra), nil
+}
+
+// requestFingerprint 计算响应缓存和请求合并共用的请求指纹，两者都未启用时返回空字符串
+func (s *Server) requestFingerprint(c *gin.Context, group *config.ModelGroupConfig, req *relay.UnifiedRequest) string {
+	if !cacheable(group.Cache, req) && !group.Coalesce {
+		return ""
+	}
+
+	key, err := responseCacheKey(group.Name, req)
+	if err != nil {
+		s.logError(c, "Failed to compute request fingerprint: %v", err)
+		return ""
+	}
+	return key
+}
+
+// lookupCache 以请求指纹查找缓存，命中时按客户端格式直接返回缓存的响应并返回 true
+// 未命中时返回用于写入缓存的键；请求不可缓存时键为空
+func (s *Server) lookupCache(c *gin.Context, group *config.ModelGroupConfig, req *relay.UnifiedRequest, key string, format responseFormat) (string, bool) {
+	if key == "" || !cacheable(group.Cache, req) {
+		return "", false
+	}
+
+	entry, tier, ok := s.cache.Get(key, time.Now())
+	if !ok {
+		metrics.ObserveCache(group.Name, "miss", "")
+		c.Header(headerCache, cacheMiss)
+		return key, false
+	}
+
+	var resp relay.OpenAIResponse
+	if err := json.Unmarshal(entry.Response, &resp); err != nil {
+		s.logError(c, "Discarding unreadable cache entry: %v", err)
+		metrics.ObserveCache(group.Name, "miss", "")
+		c.Header(headerCache, cacheMiss)
+		return key, false
+	}
+
+	metrics.ObserveCache(group.Name, "hit", tier)
+	s.logDebug(c, "Response cache hit (%s), cached at %s", tier, entry.CreatedAt.Format(time.RFC3339))
+	c.Header(headerCache, cacheHit)
+	c.Set(ctxKeyCache, cacheHit)
+	c.Set(ctxKeyModel, resp.Model)
+	c.Set(ctxKeyStream, req.Stream)
+
+	if !req.Stream {
+		if format == responseOpenAI {
+			c.Data(200, "application/json; charset=utf-8", entry.Response)
+		} else {
+			writeResponse(c, format, req, &resp)
+		}
+		return key, true
+	}
+
+	// 流式请求按 OpenAI 流式格式回放缓存的响应，其他格式经转换器输出
+	wantUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	converter := newStreamConverter(format, req, wantUsage, resp.Model, resp.Usage.PromptTokens)
+	chunks, err := relay.ResponseToChunks(&resp, wantUsage)
+	if err != nil {
+		s.logError(c, "Failed to replay cached response: %v", err)
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to replay cached response: %v", err)})
+		return key, true
+	}
+
+	setSSEHeaders(c)
+	writer := relay.NewSSEWriter(c.Writer)
+	if converter != nil {
+		for _, chunk := range chunks {
+			writeEvents(writer, converter.Convert(&relay.SSEEvent{Data: string(chunk), HasData: true, Retry: -1}))
+		}
+		writeEvents(writer, converter.Finish(resp.Usage))
+		return key, true
+	}
+	for _, chunk := range chunks {
+		writer.WriteData(string(chunk))
+	}
+	writer.WriteData("[DONE]")
+	return key, true
+}
+
+// storeCache 将成功的响应写入缓存
+func (s *Server) storeCache(c *gin.Context, rr *relayRequest, resp *relay.OpenAIResponse) {
+	if rr.cacheKey == "" || len(resp.Choices) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logError(c, "Failed to encode response for cache: %v", err)
+		return
+	}
+
+	now := time.Now()
+	entry := &cache.Entry{
+		Response:  data,
+		CreatedAt: now,
+		ExpiresAt: now.Add(rr.group.Cache.CacheTTL()),
+	}
+	if err := s.cache.Set(rr.cacheKey, entry); err != nil {
+		s.logError(c, "Failed to write response cache to disk: %v", err)
+	}
+}
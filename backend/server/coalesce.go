@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/elysia-api/backend/metrics"
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// headerCoalesced 请求与进行中的相同请求合并时返回
+const headerCoalesced = "X-Elysia-Coalesced"
+
+// coalescer 合并并发的相同请求：同一时刻只向上游发送一次，结果分发给所有等待者
+// 上游请求使用独立的 context，发起者断开不影响其他等待者；所有等待者都离开后才中止上游请求
+type coalescer struct {
+	mu      sync.Mutex
+	calls   map[string]*flight
+	streams map[string]*streamFlight
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		calls:   make(map[string]*flight),
+		streams: make(map[string]*streamFlight),
+	}
+}
+
+// flight 一个进行中的非流式请求
+type flight struct {
+	owner   *relayRequest // 实际处理请求的上游，完成后为最终胜出的一方
+	done    chan struct{}
+	resp    *relay.OpenAIResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do 执行或加入 key 对应的非流式请求，shared 表示结果来自其他请求发起的上游调用
+// fn 返回实际处理请求的上游；返回的响应和请求由所有等待者共享，调用方不能修改
+func (g *coalescer) do(ctx context.Context, key string, owner *relayRequest,
+	fn func(ctx context.Context, rr *relayRequest) (*relay.OpenAIResponse, *relayRequest, error)) (resp *relay.OpenAIResponse, actual *relayRequest, shared bool, err error) {
+	g.mu.Lock()
+	// 所有等待者都已离开的请求即将被中止，不再加入
+	if f, ok := g.calls[key]; ok && f.waiters > 0 {
+		f.waiters++
+		initial := f.owner
+		g.mu.Unlock()
+		resp, actual, err := g.wait(ctx, f)
+		if actual == nil {
+			actual = initial
+		}
+		return resp, actual, true, err
+	}
+
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &flight{owner: owner, done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = f
+	g.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		resp, actual, err := fn(flightCtx, owner)
+
+		g.mu.Lock()
+		f.resp, f.owner, f.err = resp, actual, err
+		if g.calls[key] == f {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(f.done)
+	}()
+
+	resp, actual, err = g.wait(ctx, f)
+	if actual == nil {
+		actual = owner
+	}
+	return resp, actual, false, err
+}
+
+// wait 等待请求完成，返回结果和实际处理请求的上游
+// ctx 先结束时离开并返回 nil，最后一个等待者离开时中止上游请求
+func (g *coalescer) wait(ctx context.Context, f *flight) (*relay.OpenAIResponse, *relayRequest, error) {
+	select {
+	case <-f.done:
+		return f.resp, f.owner, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+		}
+		g.mu.Unlock()
+		return nil, nil, ctx.Err()
+	}
+}
+
+// streamFlight 一个进行中的流式请求，缓存已收到的全部事件供后加入的订阅者回放
+type streamFlight struct {
+	mu          sync.Mutex
+	owner       *relayRequest // 实际处理请求的上游，建立连接后为最终胜出的一方
+	events      []*relay.SSEEvent
+	done        bool
+	err         error
+	notify      chan struct{} // 有新事件或流结束时关闭并替换
+	subscribers int
+	cancel      context.CancelFunc
+}
+
+// subscribe 加入 key 对应的流式请求，不存在时通过 start 发起
+// start 在独立的 context 中运行，将事件写入 streamFlight 并在结束时调用 finish
+// 返回的事件由所有订阅者共享，调用方不能修改
+func (g *coalescer) subscribe(ctx context.Context, key string, owner *relayRequest, start func(ctx context.Context, f *streamFlight)) (sub *streamSubscription, shared bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.streams[key]; ok {
+		f.mu.Lock()
+		active := f.subscribers > 0
+		if active {
+			f.subscribers++
+		}
+		f.mu.Unlock()
+		if active {
+			return &streamSubscription{ctx: ctx, flight: f}, true
+		}
+	}
+
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &streamFlight{owner: owner, notify: make(chan struct{}), subscribers: 1, cancel: cancel}
+	g.streams[key] = f
+
+	go func() {
+		defer cancel()
+		start(flightCtx, f)
+
+		g.mu.Lock()
+		if g.streams[key] == f {
+			delete(g.streams, key)
+		}
+		g.mu.Unlock()
+	}()
+	return &streamSubscription{ctx: ctx, flight: f}, false
+}
+
+// Owner 返回实际处理请求的上游
+func (f *streamFlight) Owner() *relayRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.owner
+}
+
+func (f *streamFlight) setOwner(rr *relayRequest) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.owner = rr
+}
+
+// publish 追加一个事件并唤醒订阅者
+func (f *streamFlight) publish(event *relay.SSEEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// finish 标记流结束，err 为 nil 表示正常结束
+func (f *streamFlight) finish(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	f.done, f.err = true, err
+	close(f.notify)
+}
+
+// leave 订阅者离开，最后一个订阅者离开时中止上游请求
+func (f *streamFlight) leave() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers--
+	if f.subscribers == 0 {
+		f.cancel()
+	}
+}
+
+// streamSubscription 单个订阅者的读取位置
+type streamSubscription struct {
+	ctx    context.Context
+	flight *streamFlight
+	next   int
+	left   bool
+}
+
+// Next 返回下一个事件：先回放已缓存的事件，再等待新事件；流正常结束时返回 io.EOF
+func (s *streamSubscription) Next() (*relay.SSEEvent, error) {
+	f := s.flight
+	for {
+		f.mu.Lock()
+		if s.next < len(f.events) {
+			event := f.events[s.next]
+			s.next++
+			f.mu.Unlock()
+			return event, nil
+		}
+		if f.done {
+			err := f.err
+			f.mu.Unlock()
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		notify := f.notify
+		f.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+// Close 离开流式请求，可重复调用
+func (s *streamSubscription) Close() {
+	if !s.left {
+		s.left = true
+		s.flight.leave()
+	}
+}
+
+// pumpStream 发起上游流式请求，将事件写入 streamFlight 直到结束
+func (s *Server) pumpStream(ctx context.Context, rr *relayRequest, f *streamFlight) {
+	stream, winner, err := s.openStream(ctx, rr)
+	f.setOwner(winner)
+	if err != nil {
+		f.finish(err)
+		return
+	}
+	defer stream.Close()
+
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			f.finish(nil)
+			return
+		}
+		if err != nil {
+			f.finish(err)
+			return
+		}
+		f.publish(event)
+		if event.IsDone() {
+			f.finish(nil)
+			return
+		}
+	}
+}
+
+// markCoalesced 标记请求已与进行中的相同请求合并
+func (s *Server) markCoalesced(c *gin.Context, owner *relayRequest) {
+	c.Set(ctxKeyCoalesced, true)
+	c.Set(ctxKeyModel, owner.model.Name)
+	c.Set(ctxKeyPlatform, string(owner.platform))
+	c.Header(headerCoalesced, "true")
+
+	stream := c.GetBool(ctxKeyStream)
+	metrics.ObserveCoalesced(c.GetString(ctxKeyGroup), stream)
+	s.logDebug(c, "Coalesced with in-flight request to %s (stream=%t)", owner.model.Name, stream)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// completions 处理旧版文本补全请求（/v1/completions）
+// 模型支持旧版接口时原样转发，否则将提示词包装为一条用户消息发送到聊天接口，响应再转换回 text_completion 格式
+func (s *Server) completions(c *gin.Context) {
+	startTime := time.Now()
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.logError(c, "Error reading request body: %v", err)
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	s.logVerbose(c, "=== Incoming Completions Request (raw) ===")
+	s.logVerbose(c, "%s", redactedBody(bodyBytes))
+	c.Set(ctxKeyFormat, string(relay.FormatCompletions))
+
+	unifiedReq, err := relay.CompletionsToUnified(bodyBytes)
+	if err != nil {
+		s.logError(c, "Error converting request: %v", err)
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+
+	// 多个提示词或 token 形式的提示词无法包装为聊天请求，要求组内所有模型都支持旧版接口
+	if _, ok := unifiedReq.Completion.ChatPrompt(); !ok {
+		if group := s.config.GetGroupByName(unifiedReq.Model); group != nil {
+			// 错误信息包含组内的模型名称，先检查访问令牌能否使用该模型组
+			if !allowGroup(c, group.Name) {
+				return
+			}
+			for _, model := range group.Models {
+				if !model.Completions {
+					c.JSON(400, gin.H{"error": fmt.Sprintf("%v: model '%s' in group '%s' only supports chat", relay.ErrNativeCompletionRequired, model.Name, group.Name)})
+					return
+				}
+			}
+		}
+	}
+
+	s.relayUnified(c, unifiedReq, responseCompletions, startTime)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// concurrencyLimiter 按模型组限制同时进行的上游请求数（MaxConcurrency），对冲请求同样占用名额
+type concurrencyLimiter struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newConcurrencyLimiter() *concurrencyLimiter {
+	return &concurrencyLimiter{slots: make(map[string]chan struct{})}
+}
+
+// semaphore 返回模型组的信号量，配置变化时重建（已占用的名额仍归还到旧信号量）
+func (l *concurrencyLimiter) semaphore(group string, max int) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.slots[group]
+	if !ok || cap(sem) != max {
+		sem = make(chan struct{}, max)
+		l.slots[group] = sem
+	}
+	return sem
+}
+
+// acquire 等待模型组的空闲名额，max 不大于 0 时不限制
+// 返回的函数用于归还名额，只能调用一次
+func (l *concurrencyLimiter) acquire(ctx context.Context, group string, max int) (func(), error) {
+	if max <= 0 {
+		return func() {}, nil
+	}
+	sem := l.semaphore(group, max)
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tryAcquire 不等待地获取名额，已满时返回 false
+func (l *concurrencyLimiter) tryAcquire(group string, max int) (func(), bool) {
+	if max <= 0 {
+		return func() {}, true
+	}
+	sem := l.semaphore(group, max)
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, true
+	default:
+		return nil, false
+	}
+}
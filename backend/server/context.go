@@ -0,0 +1,37 @@
+package server
+
+import (
+	"github.com/elysia-api/backend/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// gin.Context 中保存请求级信息的键，供中间件在请求结束后读取
+const (
+	ctxKeyRequestID   = "elysia.request_id"   // 请求 ID（string）
+	ctxKeyToken       = "elysia.token"        // 访问令牌名称（string）
+	ctxKeyAccessToken = "elysia.access_token" // 访问令牌配置（config.AccessToken）
+	ctxKeyAdmin       = "elysia.admin"        // 是否为管理员令牌（bool）
+	ctxKeyGroup       = "elysia.group"        // 模型组名称（string）
+	ctxKeyModel       = "elysia.model"        // 实际使用的模型名称（string）
+	ctxKeyPlatform    = "elysia.platform"     // 目标平台（string）
+	ctxKeyFormat      = "elysia.format"       // 客户端请求格式（string）
+	ctxKeyStream      = "elysia.stream"       // 是否为流式请求（bool）
+	ctxKeyStreamError = "elysia.stream_error" // 流式响应中途出错（error）
+	ctxKeyUsage       = "elysia.usage"        // 本次请求最终用量（relay.Usage）
+	ctxKeyCost        = "elysia.cost"         // 本次请求费用，美元（float64）
+	ctxKeyRetries     = "elysia.retries"      // 额外尝试的上游请求次数（int）
+	ctxKeyCache       = "elysia.cache"        // 响应缓存命中时为 "HIT"（string）
+	ctxKeyCoalesced   = "elysia.coalesced"    // 与进行中的相同请求合并（bool）
+	ctxKeyRejected    = "elysia.rejected"     // 被访问令牌或模型组的限额、权限拒绝（bool）
+)
+
+// relayLabels 从请求上下文中收集指标标签
+func relayLabels(c *gin.Context) metrics.Labels {
+	return metrics.Labels{
+		Group:    c.GetString(ctxKeyGroup),
+		Model:    c.GetString(ctxKeyModel),
+		Platform: c.GetString(ctxKeyPlatform),
+		Format:   c.GetString(ctxKeyFormat),
+		Token:    c.GetString(ctxKeyToken),
+	}
+}
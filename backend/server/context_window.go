@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultReserveTokens 客户端未指定输出上限时，裁剪上下文为输出预留的 token 数
+const defaultReserveTokens = 1024
+
+// headerContextTrimmed 上下文被裁剪时返回给客户端的响应头
+const headerContextTrimmed = "X-Elysia-Context-Trimmed"
+
+// checkContextWindow 在请求上游前检查上下文长度
+// 模型组配置了裁剪策略时按策略丢弃历史消息；否则提示词超出窗口直接返回错误
+// 提示词加上输出预留超出窗口时压缩输出上限
+func (s *Server) checkContextWindow(c *gin.Context, rr *relayRequest) error {
+	window := rr.group.ContextWindow(&rr.model)
+	if window <= 0 {
+		return nil
+	}
+
+	policy := rr.group.ContextPolicy
+	if policy != nil && (policy.Mode == relay.TrimDropOldest || policy.Mode == relay.TrimMiddleOut) {
+		reserve := requestedOutputTokens(rr.unified)
+		if reserve == 0 {
+			reserve = policy.ReserveTokens
+			if reserve <= 0 {
+				reserve = defaultReserveTokens
+			}
+		}
+		if reserve > window/2 {
+			reserve = window / 2
+		}
+
+		if rr.promptTokens+reserve > window {
+			result, err := relay.TrimMessages(rr.unified, policy.Mode, policy.KeepLastTurns, window-reserve)
+			if err != nil {
+				return err
+			}
+			if result.DroppedMessages > 0 {
+				s.logDebug(c, "Context trimmed (%s): dropped %d messages, prompt %d -> %d tokens",
+					result.Strategy, result.DroppedMessages, rr.promptTokens, result.PromptTokens)
+				c.Header(headerContextTrimmed, fmt.Sprintf("strategy=%s, dropped-messages=%d, prompt-tokens=%d",
+					result.Strategy, result.DroppedMessages, result.PromptTokens))
+				rr.promptTokens = result.PromptTokens
+			}
+		}
+	}
+
+	if rr.promptTokens >= window {
+		return fmt.Errorf("context length exceeded: prompt uses %d tokens, but the context window of '%s' is %d tokens",
+			rr.promptTokens, rr.model.Name, window)
+	}
+
+	available := window - rr.promptTokens
+	if rr.unified.MaxTokens > available {
+		s.logDebug(c, "Clamping max_tokens from %d to %d to fit context window %d",
+			rr.unified.MaxTokens, available, window)
+		rr.unified.MaxTokens = available
+	}
+	if rr.unified.MaxCompletionTokens > available {
+		s.logDebug(c, "Clamping max_completion_tokens from %d to %d to fit context window %d",
+			rr.unified.MaxCompletionTokens, available, window)
+		rr.unified.MaxCompletionTokens = available
+	}
+	return nil
+}
+
+// requestedOutputTokens 客户端请求的输出上限，未指定时为 0
+func requestedOutputTokens(req *relay.UnifiedRequest) int {
+	if req.MaxCompletionTokens > 0 {
+		return req.MaxCompletionTokens
+	}
+	return req.MaxTokens
+}
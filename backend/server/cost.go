@@ -0,0 +1,95 @@
+package server
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/elysia-api/backend/config"
+	"github.com/elysia-api/backend/pricing"
+	"github.com/elysia-api/backend/quota"
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// modelPrice 返回模型的价格：模型配置中的价格优先，未配置的部分使用内置价格表
+// 两者都没有时返回 false，此时不计算费用
+func modelPrice(model *config.ModelRef) (pricing.Price, bool) {
+	price, known := pricing.Default(model.Name)
+	if model.InputPrice != nil {
+		price.Input, known = *model.InputPrice, true
+	}
+	if model.OutputPrice != nil {
+		price.Output, known = *model.OutputPrice, true
+	}
+	if model.CachedInputPrice != nil {
+		price.CachedInput, known = *model.CachedInputPrice, true
+	}
+	return price, known
+}
+
+// usageCost 按模型价格计算一次请求的费用（美元）
+func usageCost(model *config.ModelRef, usage relay.Usage) float64 {
+	price, ok := modelPrice(model)
+	if !ok {
+		return 0
+	}
+	return price.Cost(usage.PromptTokens, usage.CachedTokens(), usage.CompletionTokens)
+}
+
+// requestUsage 返回请求上下文中记录的用量和费用
+func requestUsage(c *gin.Context) (relay.Usage, float64, bool) {
+	value, ok := c.Get(ctxKeyUsage)
+	if !ok {
+		return relay.Usage{}, 0, false
+	}
+	usage, ok := value.(relay.Usage)
+	if !ok {
+		return relay.Usage{}, 0, false
+	}
+	return usage, c.GetFloat64(ctxKeyCost), true
+}
+
+// upstreamUsage 返回本次请求实际产生的上游用量和费用
+// 合并的请求共用其他请求的上游调用，用量只计入访问令牌限额和请求记录，这里返回 false
+func upstreamUsage(c *gin.Context) (relay.Usage, float64, bool) {
+	if c.GetBool(ctxKeyCoalesced) {
+		return relay.Usage{}, 0, false
+	}
+	return requestUsage(c)
+}
+
+// groupLimits 模型组的每日限额，未启用时返回 false
+func groupLimits(group *config.ModelGroupConfig) (quota.Limits, bool) {
+	if !group.DailyLimit.Enabled {
+		return quota.Limits{}, false
+	}
+	return quota.Limits{
+		DailyRequests: group.DailyLimit.MaxRequest,
+		DailyTokens:   int64(group.DailyLimit.MaxTokens),
+		DailyCost:     group.DailyLimit.MaxCost,
+	}, true
+}
+
+// acquireGroupQuota 检查模型组的每日限额，超出时返回 429 并返回 false
+// 通过时返回的函数用于在请求结束后记录实际用量
+func (s *Server) acquireGroupQuota(c *gin.Context, group *config.ModelGroupConfig) (func(), bool) {
+	limits, ok := groupLimits(group)
+	if !ok {
+		return func() {}, true
+	}
+
+	if _, err := s.groupQuotas.Acquire(group.Name, limits); err != nil {
+		if exceeded, ok := err.(*quota.ExceededError); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+		}
+		c.Set(ctxKeyRejected, true)
+		c.JSON(429, gin.H{"error": "model group " + err.Error()})
+		return nil, false
+	}
+
+	return func() {
+		if usage, cost, ok := upstreamUsage(c); ok {
+			s.groupQuotas.Record(group.Name, limits, int64(usage.TotalTokens), cost)
+		}
+	}, true
+}
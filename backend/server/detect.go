@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// headerFormat 显式指定请求格式的请求头，取值见 parseFormatName
+const headerFormat = "X-Elysia-Format"
+
+// routeFormat 返回路由固定的请求格式，/v1/chat/completions 等通用路由返回 false
+func routeFormat(path string) (relay.FormatType, bool) {
+	switch {
+	case path == "/v1/messages" || path == "/v1/messages/count_tokens":
+		return relay.FormatClaude, true
+	case path == "/v1/responses":
+		return relay.FormatResponses, true
+	case path == "/v1/completions":
+		return relay.FormatCompletions, true
+	case strings.HasPrefix(path, "/v1beta/models/"):
+		return relay.FormatGemini, true
+	}
+	return "", false
+}
+
+// parseFormatName 解析 X-Elysia-Format 的取值
+func parseFormatName(name string) (relay.FormatType, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "openai", "deepseek":
+		return relay.FormatOpenAI, true
+	case "claude", "anthropic":
+		return relay.FormatClaude, true
+	case "gemini", "google":
+		return relay.FormatGemini, true
+	}
+	return "", false
+}
+
+// resolveInputFormat 确定请求格式：依次按路由、请求头（X-Elysia-Format、anthropic-version、x-goog-api-key）和请求体内容判断
+// X-Elysia-Format 取值无效时返回错误
+func resolveInputFormat(path string, header http.Header, body []byte) (relay.Detection, error) {
+	if format, ok := routeFormat(path); ok {
+		return relay.Detection{Format: format, Source: relay.DetectByRoute, Reason: fmt.Sprintf("route %s only accepts %s requests", path, format)}, nil
+	}
+	if name := header.Get(headerFormat); name != "" {
+		format, ok := parseFormatName(name)
+		if !ok {
+			return relay.Detection{}, fmt.Errorf("unsupported %s '%s', expected openai, claude or gemini", headerFormat, name)
+		}
+		return relay.Detection{Format: format, Source: relay.DetectByHeader, Reason: fmt.Sprintf("%s: %s", headerFormat, name)}, nil
+	}
+	if header.Get("anthropic-version") != "" {
+		return relay.Detection{Format: relay.FormatClaude, Source: relay.DetectByHeader, Reason: "anthropic-version header present"}, nil
+	}
+	if header.Get("x-goog-api-key") != "" {
+		return relay.Detection{Format: relay.FormatGemini, Source: relay.DetectByHeader, Reason: "x-goog-api-key header present"}, nil
+	}
+	return relay.ClassifyInputFormat(body), nil
+}
+
+// debugDetect 说明请求格式的判断过程，请求体为待判断的请求
+// 按调用本接口时的请求头判断，?path= 可指定模拟的路由，默认为 /v1/chat/completions
+func (s *Server) debugDetect(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	path := c.DefaultQuery("path", "/v1/chat/completions")
+	detection, err := resolveInputFormat(path, c.Request.Header, bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"path":      path,
+		"detection": detection,
+	})
+}
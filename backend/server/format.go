@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// responseFormat 客户端期望的响应格式，由请求入口决定
+// 上游统一返回 OpenAI 格式，写出时再按此转换
+type responseFormat string
+
+const (
+	responseOpenAI      responseFormat = "openai"
+	responseClaude      responseFormat = "claude"
+	responseGemini      responseFormat = "gemini"
+	responseGeminiArray responseFormat = "gemini-array" // streamGenerateContent 未指定 alt=sse 时以 JSON 数组返回
+	responseResponses   responseFormat = "responses"    // OpenAI Responses API
+	responseCompletions responseFormat = "completions"  // 旧版文本补全
+)
+
+// writeResponse 按客户端格式写出非流式响应
+func writeResponse(c *gin.Context, format responseFormat, req *relay.UnifiedRequest, resp *relay.OpenAIResponse) {
+	switch format {
+	case responseClaude:
+		c.JSON(200, relay.OpenAIToClaudeResponse(resp))
+	case responseGemini:
+		c.JSON(200, relay.OpenAIToGeminiResponse(resp))
+	case responseGeminiArray:
+		c.JSON(200, []*relay.GeminiResponse{relay.OpenAIToGeminiResponse(resp)})
+	case responseResponses:
+		c.JSON(200, relay.OpenAIToResponsesResponse(resp))
+	case responseCompletions:
+		c.JSON(200, relay.OpenAIToCompletionResponse(resp, req.Completion))
+	default:
+		c.JSON(200, resp)
+	}
+}
+
+// newStreamConverter 返回将 OpenAI 流式事件转换为客户端格式的转换器，OpenAI 格式时返回 nil（原样转发）
+// wantUsage 为客户端是否请求了 stream_options.include_usage
+func newStreamConverter(format responseFormat, req *relay.UnifiedRequest, wantUsage bool, model string, promptTokens int) relay.StreamConverter {
+	switch format {
+	case responseClaude:
+		return relay.NewClaudeStreamConverter(model, promptTokens)
+	case responseGemini:
+		return relay.NewGeminiStreamConverter(model)
+	case responseResponses:
+		return relay.NewResponsesStreamConverter(model)
+	case responseCompletions:
+		return relay.NewCompletionStreamConverter(req.Completion, model, wantUsage)
+	default:
+		return nil
+	}
+}
+
+// writeEvents 依次写出转换后的事件
+func writeEvents(writer *relay.SSEWriter, events []*relay.SSEEvent) {
+	for _, event := range events {
+		writer.WriteEvent(event)
+	}
+}
+
+// writeStreamError 在流式响应中写出错误事件
+func writeStreamError(writer *relay.SSEWriter, format responseFormat, message string) {
+	switch format {
+	case responseClaude:
+		writer.WriteNamed("error", string(relay.ClaudeErrorBody("api_error", message)))
+	case responseGemini:
+		writer.WriteData(string(relay.GeminiErrorBody(500, message)))
+	case responseResponses:
+		writer.WriteNamed("error", string(relay.ResponsesErrorEvent(message)))
+	default:
+		writer.WriteNamed("error", message)
+	}
+}
+
+// rewriteErrors 将路由上的 {"error": "..."} 错误响应改写为其他 API 的错误格式
+// 需放在鉴权等会返回错误的中间件之前
+func rewriteErrors(render func(status int, message string) []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &errorRewriter{ResponseWriter: c.Writer, render: render}
+		c.Next()
+	}
+}
+
+// claudeErrors 使用 Claude 的错误格式
+func claudeErrors() gin.HandlerFunc {
+	return rewriteErrors(func(status int, message string) []byte {
+		return relay.ClaudeErrorBody(relay.ClaudeErrorType(status), message)
+	})
+}
+
+// geminiErrors 使用 Gemini 的错误格式
+func geminiErrors() gin.HandlerFunc {
+	return rewriteErrors(relay.GeminiErrorBody)
+}
+
+// errorRewriter 拦截错误状态码下的 JSON 响应体
+type errorRewriter struct {
+	gin.ResponseWriter
+	render func(status int, message string) []byte
+}
+
+func (w *errorRewriter) Write(data []byte) (int, error) {
+	if w.Status() >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &body) == nil && body.Error != "" {
+			if _, err := w.ResponseWriter.Write(w.render(w.Status(), body.Error)); err != nil {
+				return 0, err
+			}
+			return len(data), nil
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorRewriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
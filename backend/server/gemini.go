@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini 原生路由支持的方法
+const (
+	geminiGenerate       = "generateContent"
+	geminiStreamGenerate = "streamGenerateContent"
+	geminiCountTokens    = "countTokens"
+)
+
+// geminiTarget 从 /v1beta/models/{group}:{method} 中解析模型组和方法
+func geminiTarget(c *gin.Context) (group, method string) {
+	target := strings.TrimPrefix(c.Param("target"), "/")
+	index := strings.LastIndex(target, ":")
+	if index < 0 {
+		return target, ""
+	}
+	return target[:index], target[index+1:]
+}
+
+// geminiGenerateOnly 只对生成请求执行中间件，countTokens 不计入请求指标、记录和限额
+func geminiGenerateOnly(middleware gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, method := geminiTarget(c); method == geminiCountTokens {
+			c.Next()
+			return
+		}
+		middleware(c)
+	}
+}
+
+// geminiModels 处理 Gemini 原生路由，模型组取自路径，响应以 Gemini 格式返回
+func (s *Server) geminiModels(c *gin.Context) {
+	group, method := geminiTarget(c)
+	switch method {
+	case geminiGenerate:
+		s.geminiGenerateContent(c, group, false)
+	case geminiStreamGenerate:
+		s.geminiGenerateContent(c, group, true)
+	case geminiCountTokens:
+		s.geminiCountTokens(c, group)
+	default:
+		c.JSON(404, gin.H{"error": fmt.Sprintf("unsupported method '%s'", method)})
+	}
+}
+
+// geminiGenerateContent 处理 generateContent 和 streamGenerateContent
+// 流式请求指定 alt=sse 时以 SSE 返回，否则与 Gemini 一致返回响应块数组（此时整体返回一个响应块）
+func (s *Server) geminiGenerateContent(c *gin.Context, group string, stream bool) {
+	startTime := time.Now()
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.logError(c, "Error reading request body: %v", err)
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	s.logVerbose(c, "=== Incoming Gemini Request (raw) ===")
+	s.logVerbose(c, "%s", redactedBody(bodyBytes))
+	c.Set(ctxKeyFormat, string(relay.FormatGemini))
+
+	unifiedReq, err := relay.GeminiToUnified(bodyBytes)
+	if err != nil {
+		s.logError(c, "Error converting request: %v", err)
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+	unifiedReq.Model = group
+
+	format := responseGemini
+	if stream {
+		if c.Query("alt") == "sse" {
+			unifiedReq.Stream = true
+		} else {
+			format = responseGeminiArray
+		}
+	}
+
+	s.relayUnified(c, unifiedReq, format, startTime)
+}
+
+// geminiCountTokens 兼容 Gemini 的 countTokens，本地计算提示词 token 数
+// 请求体可以直接包含 contents，也可以包装在 generateContentRequest 中
+func (s *Server) geminiCountTokens(c *gin.Context, group string) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var wrapper struct {
+		GenerateContentRequest json.RawMessage `json:"generateContentRequest"`
+	}
+	if err := json.Unmarshal(bodyBytes, &wrapper); err == nil && len(wrapper.GenerateContentRequest) > 0 {
+		bodyBytes = wrapper.GenerateContentRequest
+	}
+
+	unifiedReq, err := relay.GeminiToUnified(bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+	model, ok := s.resolveTokenizerModel(c, group)
+	if !ok {
+		return
+	}
+	unifiedReq.Model = model
+
+	c.JSON(200, gin.H{"totalTokens": relay.EstimatePromptTokens(unifiedReq)})
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/elysia-api/backend/metrics"
+	"github.com/elysia-api/backend/relay"
+	"github.com/elysia-api/backend/transform"
+)
+
+// 对冲结果，用于指标
+const (
+	hedgeLaunched = "launched"
+	hedgeSkipped  = "skipped"
+	hedgeWon      = "won"
+	hedgeLost     = "lost"
+)
+
+// prepareUpstream 将统一格式的请求转换为目标平台格式
+// 流式请求尽量让上游在末尾返回 usage 块，用于用量统计
+// 模型的 overrides 在选择模型时已经应用（见 relayUnified 和 hedgeRequest），模型组和模型的 transforms 依次作用于最终的请求体
+func prepareUpstream(rr *relayRequest) error {
+	if rr.unified.Stream && relay.SupportsStreamUsage(rr.platform) {
+		rr.unified.StreamOptions = &relay.StreamOptions{IncludeUsage: true}
+	}
+	rr.completion = rr.unified.Completion != nil && rr.model.Completions
+	rr.structuredTool = relay.UsesStructuredOutputTool(rr.unified, rr.platform)
+
+	body, err := upstreamBody(rr, rr.unified)
+	if err != nil {
+		return err
+	}
+	for _, rules := range [][]transform.Rule{rr.group.Transforms, rr.model.Transforms} {
+		if body, err = transform.ApplyJSON(body, rules); err != nil {
+			return fmt.Errorf("failed to apply transforms: %w", err)
+		}
+	}
+	rr.body = body
+	return nil
+}
+
+// upstreamBody 生成发往上游的请求体
+// 文本补全请求在模型支持旧版接口时原样转发，否则包装为聊天请求
+// OpenAI 格式的请求发往兼容 OpenAI 的上游时只修改原始请求体中的少量字段
+func upstreamBody(rr *relayRequest, unified *relay.UnifiedRequest) ([]byte, error) {
+	if rr.completion {
+		return relay.UnifiedToCompletion(unified)
+	}
+	if unified.Completion != nil {
+		if _, ok := unified.Completion.ChatPrompt(); !ok {
+			return nil, relay.ErrNativeCompletionRequired
+		}
+	}
+	if body, ok := relay.OpenAIFastPath(unified, rr.platform); ok {
+		return body, nil
+	}
+	return relay.ConvertFromUnified(unified, rr.platform)
+}
+
+// hedgeRequest 为对冲选择组内的另一个模型并构造请求，从原模型之后依次选择
+// 请求沿用原请求裁剪后的消息，在未应用原模型 overrides 的请求上应用对冲模型的 overrides 并重新计算提示词 token 数
+// 没有其他模型或其他模型的上下文窗口放不下提示词时返回 nil
+func (s *Server) hedgeRequest(primary *relayRequest) *relayRequest {
+	group := primary.group
+	models := group.Models
+	start := 0
+	for i, model := range models {
+		if model.Name == primary.model.Name && model.BaseURL == primary.model.BaseURL {
+			start = i
+			break
+		}
+	}
+
+	for i := 1; i < len(models); i++ {
+		model := models[(start+i)%len(models)]
+		if model.Name == primary.model.Name && model.BaseURL == primary.model.BaseURL {
+			continue
+		}
+
+		base := *primary.base
+		base.Model = model.Name
+		// 原模型有 overrides 时两者是不同的对象，沿用原请求（可能已裁剪）的消息，原始请求体不再对应这些消息，不能走 OpenAIFastPath
+		if primary.unified != primary.base {
+			base.Messages = primary.unified.Messages
+			base.Raw = nil
+		}
+		if !primary.wantUsage {
+			base.StreamOptions = nil
+		}
+		unified, err := relay.ApplyOverrides(&base, model.Overrides)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Failed to apply overrides of hedge model %s: %v", model.Name, err))
+			continue
+		}
+		promptTokens := relay.EstimatePromptTokens(unified)
+		if window := group.ContextWindow(&model); window > 0 {
+			if promptTokens >= window {
+				continue
+			}
+			// 输出上限压缩到对冲模型的上下文窗口内
+			unified.MaxTokens = min(unified.MaxTokens, window-promptTokens)
+			unified.MaxCompletionTokens = min(unified.MaxCompletionTokens, window-promptTokens)
+		}
+
+		hedge := *primary
+		hedge.model = model
+		hedge.platform = relay.DetectPlatform(model.BaseURL, model.Platform)
+		hedge.timeouts = s.resolveTimeouts(group, &model)
+		hedge.unified = unified
+		hedge.promptTokens = promptTokens
+		if err := prepareUpstream(&hedge); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to prepare hedge request to %s: %v", model.Name, err))
+			continue
+		}
+		return &hedge
+	}
+	return nil
+}
+
+// hedgeOverhead 被取消的一方在上游通常已处理完提示词，按提示词 token 数计入用量和费用
+func hedgeOverhead(loser *relayRequest) (relay.Usage, float64) {
+	usage := relay.Usage{PromptTokens: loser.promptTokens, TotalTokens: loser.promptTokens}
+	return usage, usageCost(&loser.model, usage)
+}
+
+// attemptResult 一次上游尝试的结果
+type attemptResult[T any] struct {
+	index int
+	value T
+	err   error
+}
+
+// raceUpstream 占用模型组的并发名额后向上游发起请求
+// 模型组启用对冲时，若 attempt 在等待时间内没有返回，或在此之前就已失败，则向另一个模型再发起一次，
+// 先成功返回的一方胜出，另一方被取消
+// attempt 负责在结果用完时调用 release 归还名额，release 同时取消该次尝试的 context；胜出后仍返回的结果交给 discard 释放
+// 返回实际使用的请求，发生对冲时为带有对冲信息的副本
+func raceUpstream[T any](s *Server, ctx context.Context, primary *relayRequest,
+	attempt func(ctx context.Context, rr *relayRequest, release func()) (T, error), discard func(T)) (T, *relayRequest, error) {
+	var zero T
+	group := primary.group
+	release, err := s.slots.acquire(ctx, group.Name, group.MaxConcurrency)
+	if err != nil {
+		return zero, primary, err
+	}
+	if group.Hedge == nil || !group.Hedge.Enabled || len(group.Models) < 2 {
+		value, err := attempt(ctx, primary, release)
+		return value, primary, err
+	}
+
+	attempts := []*relayRequest{primary, nil}
+	cancels := make([]context.CancelFunc, len(attempts))
+	failed := make([]bool, len(attempts))
+	results := make(chan attemptResult[T], len(attempts))
+	launch := func(index int, release func()) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[index] = cancel
+		go func() {
+			value, err := attempt(attemptCtx, attempts[index], func() {
+				cancel()
+				release()
+			})
+			results <- attemptResult[T]{index: index, value: value, err: err}
+		}()
+	}
+	pending := 1
+	// hedge 向另一个模型发起对冲，没有可用模型或并发名额时返回 false
+	hedge := func(reason string) bool {
+		if attempts[1] != nil {
+			return false
+		}
+		hedge := s.hedgeRequest(primary)
+		if hedge == nil {
+			return false
+		}
+		hedgeRelease, ok := s.slots.tryAcquire(group.Name, group.MaxConcurrency)
+		if !ok {
+			metrics.ObserveHedge(group.Name, hedgeSkipped)
+			slog.Debug(fmt.Sprintf("Hedge skipped for group '%s': concurrency limit reached", group.Name))
+			return false
+		}
+		attempts[1] = hedge
+		launch(1, hedgeRelease)
+		pending++
+		metrics.ObserveHedge(group.Name, hedgeLaunched)
+		slog.Debug(fmt.Sprintf("%s from %s, hedging with %s", reason, primary.model.Name, hedge.model.Name))
+		return true
+	}
+
+	launch(0, release)
+	timer := time.NewTimer(group.Hedge.HedgeDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			hedge(fmt.Sprintf("No response after %s", group.Hedge.HedgeDelay()))
+
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				failed[result.index] = true
+				// 尚未对冲时立即对冲，客户端已断开时除外
+				if result.index == 0 && ctx.Err() == nil && hedge("Request failed") {
+					continue
+				}
+				if pending > 0 {
+					continue
+				}
+				return zero, hedgedRequest(attempts, result.index, failed), result.err
+			}
+
+			// 取消另一方，仍在进行的请求在后台收尾
+			for index, cancel := range cancels {
+				if index != result.index && cancel != nil {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.err == nil {
+							discard(late.value)
+						}
+					}
+				}(pending)
+			}
+
+			if attempts[1] != nil {
+				outcome := hedgeLost
+				if result.index == 1 {
+					outcome = hedgeWon
+				}
+				metrics.ObserveHedge(group.Name, outcome)
+			}
+			return result.value, hedgedRequest(attempts, result.index, failed), nil
+		}
+	}
+}
+
+// hedgedRequest 返回结果对应的请求；发生对冲时复制一份并记录对冲信息，不修改调用方持有的请求
+func hedgedRequest(attempts []*relayRequest, index int, failed []bool) *relayRequest {
+	if attempts[1] == nil {
+		return attempts[index]
+	}
+	rr := *attempts[index]
+	rr.hedged = true
+	// 未失败的另一方是被取消的
+	if other := 1 - index; !failed[other] {
+		rr.overhead, rr.overheadCost = hedgeOverhead(attempts[other])
+	}
+	return &rr
+}
+
+// sendNormal 发送非流式请求，对冲时以先返回完整响应的一方为准
+func (s *Server) sendNormal(ctx context.Context, rr *relayRequest) (*relay.OpenAIResponse, *relayRequest, error) {
+	return raceUpstream(s, ctx, rr, func(ctx context.Context, rr *relayRequest, release func()) (*relay.OpenAIResponse, error) {
+		defer release()
+		if rr.completion {
+			return s.openaiAdapter.SendCompletionRaw(ctx, upstreamOf(&rr.model), rr.body, rr.timeouts)
+		}
+		resp, err := s.openaiAdapter.SendRequestRaw(ctx, upstreamOf(&rr.model), rr.body, rr.timeouts)
+		if err == nil && rr.structuredTool {
+			relay.UnwrapStructuredOutput(resp)
+		}
+		return resp, err
+	}, func(*relay.OpenAIResponse) {})
+}
+
+// upstreamStream 已收到首个事件的上游流式响应，关闭时归还并发名额
+type upstreamStream struct {
+	first   *relay.SSEEvent
+	reader  *relay.SSEReader
+	body    io.Closer
+	release func()
+	once    sync.Once
+	convert func(*relay.SSEEvent) *relay.SSEEvent // 将上游事件转换为聊天格式，为 nil 时原样返回
+}
+
+// Next 依次返回首个事件和之后的事件
+func (u *upstreamStream) Next() (*relay.SSEEvent, error) {
+	if u.first != nil {
+		event := u.first
+		u.first = nil
+		return event, nil
+	}
+	event, err := u.reader.Next()
+	if err == nil && u.convert != nil {
+		event = u.convert(event)
+	}
+	return event, err
+}
+
+// Close 关闭响应体并归还并发名额，可重复调用
+func (u *upstreamStream) Close() {
+	u.once.Do(func() {
+		u.body.Close()
+		u.release()
+	})
+}
+
+// openStream 发送流式请求并等待首个事件，对冲时以先收到首个事件的一方为准
+// 上游未发送任何事件就结束时返回的流直接结束
+func (s *Server) openStream(ctx context.Context, rr *relayRequest) (*upstreamStream, *relayRequest, error) {
+	return raceUpstream(s, ctx, rr, func(ctx context.Context, rr *relayRequest, release func()) (*upstreamStream, error) {
+		send := s.openaiAdapter.SendRequestStream
+		if rr.completion {
+			send = s.openaiAdapter.SendCompletionStream
+		}
+		resp, err := send(ctx, upstreamOf(&rr.model), rr.body, rr.timeouts)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		stream := &upstreamStream{reader: relay.NewSSEReader(resp.Body), body: resp.Body, release: release}
+		if rr.completion {
+			stream.convert = relay.CompletionChunkToChat
+		} else if rr.structuredTool {
+			stream.convert = relay.StructuredOutputStream()
+		}
+		stream.first, err = stream.Next()
+		if err != nil && err != io.EOF {
+			stream.Close()
+			return nil, err
+		}
+		return stream, nil
+	}, (*upstreamStream).Close)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/elysia-api/backend/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// headerRequestID 请求 ID 头，客户端提供时沿用，否则由网关生成
+const headerRequestID = "X-Request-ID"
+
+// maxRequestIDLength 客户端提供的请求 ID 最大长度，超出时重新生成
+const maxRequestIDLength = 128
+
+// requestLogger 返回携带请求 ID 的日志记录器
+func requestLogger(c *gin.Context) *slog.Logger {
+	if id := c.GetString(ctxKeyRequestID); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// logDebug 输出调试信息（模型组、选中模型、耗时），仅在 debug 级别可见
+func (s *Server) logDebug(c *gin.Context, format string, args ...interface{}) {
+	requestLogger(c).Debug(fmt.Sprintf(format, args...))
+}
+
+// verboseEnabled 详细日志模式已开启且 debug 级别日志会实际输出
+func (s *Server) verboseEnabled(c *gin.Context) bool {
+	return s.config.VerboseLog && requestLogger(c).Enabled(c.Request.Context(), slog.LevelDebug)
+}
+
+// logVerbose 仅在详细日志模式下输出完整请求/响应结构，日志不会输出时不格式化参数
+func (s *Server) logVerbose(c *gin.Context, format string, args ...interface{}) {
+	if s.verboseEnabled(c) {
+		requestLogger(c).Debug(fmt.Sprintf(format, args...), "verbose", true)
+	}
+}
+
+// redactedBody 按脱敏配置输出的请求/响应体，用于详细日志
+// 通过 logVerbose 输出时，只有日志实际输出才会进行解析和脱敏
+type redactedBody []byte
+
+func (b redactedBody) String() string {
+	return logging.CurrentRedactor().JSON(b)
+}
+
+// logError 输出请求处理中的错误
+func (s *Server) logError(c *gin.Context, format string, args ...interface{}) {
+	requestLogger(c).Error(fmt.Sprintf(format, args...))
+}
+
+// validRequestID 客户端提供的请求 ID 只允许可打印 ASCII 字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 生成随机请求 ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestID 为每个请求分配请求 ID，并在响应头中回显
+func (s *Server) requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(ctxKeyRequestID, id)
+		c.Header(headerRequestID, id)
+		c.Next()
+	}
+}
+
+// accessLog 每个请求结束后输出一条访问日志
+// 心跳、健康检查和指标抓取较为频繁，仅在 debug 级别输出
+func (s *Server) accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+		if token := c.GetString(ctxKeyToken); token != "" {
+			attrs = append(attrs, "token", token)
+		}
+		if group := c.GetString(ctxKeyGroup); group != "" {
+			attrs = append(attrs,
+				"group", group,
+				"model", c.GetString(ctxKeyModel),
+				"platform", c.GetString(ctxKeyPlatform),
+				"format", c.GetString(ctxKeyFormat),
+				"stream", c.GetBool(ctxKeyStream),
+				"retries", c.GetInt(ctxKeyRetries),
+			)
+		}
+		if cached := c.GetString(ctxKeyCache); cached != "" {
+			attrs = append(attrs, "cache", cached)
+		}
+		if c.GetBool(ctxKeyCoalesced) {
+			attrs = append(attrs, "coalesced", true)
+		}
+		if usage, cost, ok := requestUsage(c); ok {
+			attrs = append(attrs,
+				"prompt_tokens", usage.PromptTokens,
+				"completion_tokens", usage.CompletionTokens,
+				"total_tokens", usage.TotalTokens,
+				"cost", cost,
+			)
+		}
+		if value, ok := c.Get(ctxKeyStreamError); ok {
+			attrs = append(attrs, "stream_error", fmt.Sprint(value))
+		}
+
+		logger := requestLogger(c)
+		path := c.Request.URL.Path
+		switch {
+		case path == "/__heartbeat" || path == "/health" || path == "/metrics":
+			logger.Debug("access", attrs...)
+		case status >= 500:
+			logger.Error("access", attrs...)
+		case status >= 400:
+			logger.Warn("access", attrs...)
+		default:
+			logger.Info("access", attrs...)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// claudeMessages 处理 Anthropic Messages API 请求（/v1/messages）
+// 请求始终按 Claude 格式解析，响应和流式事件也以 Claude 格式返回
+func (s *Server) claudeMessages(c *gin.Context) {
+	startTime := time.Now()
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.logError(c, "Error reading request body: %v", err)
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	s.logVerbose(c, "=== Incoming Claude Request (raw) ===")
+	s.logVerbose(c, "%s", redactedBody(bodyBytes))
+	c.Set(ctxKeyFormat, string(relay.FormatClaude))
+
+	unifiedReq, err := relay.ClaudeToUnified(bodyBytes)
+	if err != nil {
+		s.logError(c, "Error converting request: %v", err)
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+	if unifiedReq.MaxTokens <= 0 {
+		c.JSON(400, gin.H{"error": "max_tokens: Field required"})
+		return
+	}
+
+	s.relayUnified(c, unifiedReq, responseClaude, startTime)
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"time"
+
+	"github.com/elysia-api/backend/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// 错误类型标签
+const (
+	errorKindClient   = "client"   // 4xx：请求无效、模型组不存在等
+	errorKindUpstream = "upstream" // 5xx：上游请求失败
+	errorKindStream   = "stream"   // 流式响应已开始后中途失败
+)
+
+// metricsMiddleware 在请求结束后记录请求数、错误、耗时和 token 用量
+func (s *Server) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		labels := relayLabels(c)
+		status := c.Writer.Status()
+		metrics.ObserveRequest(labels, status, c.GetBool(ctxKeyStream), time.Since(start))
+
+		switch {
+		case status >= 500:
+			metrics.ObserveError(labels, errorKindUpstream)
+		case status >= 400:
+			metrics.ObserveError(labels, errorKindClient)
+		default:
+			if _, failed := c.Get(ctxKeyStreamError); failed {
+				metrics.ObserveError(labels, errorKindStream)
+			}
+		}
+
+		if usage, cost, ok := upstreamUsage(c); ok {
+			metrics.AddTokens(labels, usage.PromptTokens, usage.CompletionTokens)
+			metrics.AddCost(labels, cost)
+		}
+	}
+}
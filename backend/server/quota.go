@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/elysia-api/backend/config"
+	"github.com/elysia-api/backend/quota"
+	"github.com/elysia-api/backend/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// 限额响应头，请求/分钟 token 部分沿用 OpenAI 的命名
+const (
+	headerLimitRequests     = "X-RateLimit-Limit-Requests"
+	headerRemainingRequests = "X-RateLimit-Remaining-Requests"
+	headerResetRequests     = "X-RateLimit-Reset-Requests"
+	headerLimitTokens       = "X-RateLimit-Limit-Tokens"
+	headerRemainingTokens   = "X-RateLimit-Remaining-Tokens"
+	headerResetTokens       = "X-RateLimit-Reset-Tokens"
+	headerDailyRemaining    = "X-Elysia-Quota-Daily-Remaining"
+	headerMonthlyRemaining  = "X-Elysia-Quota-Monthly-Remaining"
+	headerDailyBudget       = "X-Elysia-Budget-Daily-Remaining"
+	headerMonthlyBudget     = "X-Elysia-Budget-Monthly-Remaining"
+)
+
+// tokenLimits 从访问令牌配置中提取限额
+func tokenLimits(token *config.AccessToken) quota.Limits {
+	return quota.Limits{
+		RPM:           token.RPM,
+		TPM:           token.TPM,
+		DailyTokens:   token.DailyTokens,
+		MonthlyTokens: token.MonthlyTokens,
+		DailyCost:     token.DailyBudget,
+		MonthlyCost:   token.MonthlyBudget,
+	}
+}
+
+// enforceQuota 按访问令牌的限额放行请求，请求结束后扣除实际消耗的 token 和费用
+func (s *Server) enforceQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := accessToken(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		limits := tokenLimits(&token)
+		status, err := s.quotas.Acquire(token.Name, limits)
+		setQuotaHeaders(c, status)
+		if err != nil {
+			if exceeded, ok := err.(*quota.ExceededError); ok {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+			}
+			c.Set(ctxKeyRejected, true)
+			c.AbortWithStatusJSON(429, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Next()
+
+		if usage, cost, ok := requestUsage(c); ok {
+			s.quotas.Record(token.Name, limits, int64(usage.TotalTokens), cost)
+		}
+	}
+}
+
+// setQuotaHeaders 在响应头中返回已配置限额的剩余量
+func setQuotaHeaders(c *gin.Context, status quota.Status) {
+	if status.RPM > 0 {
+		c.Header(headerLimitRequests, strconv.Itoa(status.RPM))
+		c.Header(headerRemainingRequests, strconv.Itoa(status.RemainingRequests))
+		c.Header(headerResetRequests, formatReset(status.ResetRequests))
+	}
+	if status.TPM > 0 {
+		c.Header(headerLimitTokens, strconv.Itoa(status.TPM))
+		c.Header(headerRemainingTokens, strconv.Itoa(status.RemainingTokens))
+		c.Header(headerResetTokens, formatReset(status.ResetTokens))
+	}
+	if status.DailyTokens > 0 {
+		c.Header(headerDailyRemaining, strconv.FormatInt(status.DailyRemaining, 10))
+	}
+	if status.MonthlyTokens > 0 {
+		c.Header(headerMonthlyRemaining, strconv.FormatInt(status.MonthlyRemaining, 10))
+	}
+	if status.DailyCost > 0 {
+		c.Header(headerDailyBudget, formatCost(status.DailyCostRemaining))
+	}
+	if status.MonthlyCost > 0 {
+		c.Header(headerMonthlyBudget, formatCost(status.MonthlyCostRemaining))
+	}
+}
+
+// formatCost 以美元输出费用，保留 6 位小数
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 6, 64)
+}
+
+// formatReset 以 "1.5s" 形式输出恢复时间
+func formatReset(d time.Duration) string {
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// dashboardUsage 返回调用方令牌的限额、用量和剩余量
+func (s *Server) dashboardUsage(c *gin.Context) {
+	token, ok := accessToken(c)
+	if !ok {
+		c.JSON(404, gin.H{"error": "no access tokens are configured"})
+		return
+	}
+
+	status := s.quotas.Status(token.Name, tokenLimits(&token))
+
+	var expiresAt interface{}
+	if expiry, err := token.ExpiryTime(); err == nil && !expiry.IsZero() {
+		expiresAt = expiry.Format(time.RFC3339)
+	}
+
+	c.JSON(200, gin.H{
+		"object":        "dashboard.usage",
+		"token":         token.Name,
+		"expiresAt":     expiresAt,
+		"allowedGroups": token.AllowedGroups,
+		"deniedGroups":  token.DeniedGroups,
+		"limits": gin.H{
+			"rpm":           status.RPM,
+			"tpm":           status.TPM,
+			"dailyTokens":   status.DailyTokens,
+			"monthlyTokens": status.MonthlyTokens,
+			"dailyBudget":   status.DailyCost,
+			"monthlyBudget": status.MonthlyCost,
+		},
+		"usage": gin.H{
+			"dailyRequests":   status.Daily.Requests,
+			"dailyTokens":     status.Daily.Tokens,
+			"dailyCost":       status.Daily.Cost,
+			"monthlyRequests": status.Monthly.Requests,
+			"monthlyTokens":   status.Monthly.Tokens,
+			"monthlyCost":     status.Monthly.Cost,
+		},
+		"remaining": gin.H{
+			"requests":      limitedValue(status.RPM > 0, int64(status.RemainingRequests)),
+			"tokens":        limitedValue(status.TPM > 0, int64(status.RemainingTokens)),
+			"dailyTokens":   limitedValue(status.DailyTokens > 0, status.DailyRemaining),
+			"monthlyTokens": limitedValue(status.MonthlyTokens > 0, status.MonthlyRemaining),
+			"dailyBudget":   limitedValue(status.DailyCost > 0, status.DailyCostRemaining),
+			"monthlyBudget": limitedValue(status.MonthlyCost > 0, status.MonthlyCostRemaining),
+		},
+		"reset": gin.H{
+			"requests":      status.ResetRequests.Seconds(),
+			"tokens":        status.ResetTokens.Seconds(),
+			"dailyTokens":   status.DailyReset.Format(time.RFC3339),
+			"monthlyTokens": status.MonthlyReset.Format(time.RFC3339),
+		},
+	})
+}
+
+// limitedValue 未配置的限额返回 null，表示不限制
+func limitedValue[T int64 | float64](limited bool, value T) interface{} {
+	if !limited {
+		return nil
+	}
+	return value
+}
+
+// seedQuotas 从请求记录恢复访问令牌本月和当天、模型组当天的用量，避免重启后限额被重置
+func (s *Server) seedQuotas() {
+	if s.requestLog == nil {
+		return
+	}
+
+	// 被限额或权限拒绝的请求不计入用量
+	filter := requestlog.Filter{From: s.quotas.MonthStart(), OnlyAdmitted: true}
+	dimensions := []string{requestlog.DimensionDay, requestlog.DimensionToken, requestlog.DimensionGroup}
+	rows, err := s.requestLog.Aggregate(filter, dimensions, time.Local)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to restore quotas from request log: %v", err))
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	tokenDaily := make(map[string]quota.Usage)
+	tokenMonthly := make(map[string]quota.Usage)
+	groupDaily := make(map[string]quota.Usage)
+	for _, row := range rows {
+		usage := quota.Usage{Requests: row.Requests, Tokens: int64(row.TotalTokens), Cost: row.Cost}
+		if row.Token != "" {
+			tokenMonthly[row.Token] = addUsage(tokenMonthly[row.Token], usage)
+			if row.Day == today {
+				tokenDaily[row.Token] = addUsage(tokenDaily[row.Token], usage)
+			}
+		}
+		// 模型组只计实际的上游用量，见 upstreamUsage
+		if row.Group != "" && row.Day == today {
+			upstream := quota.Usage{Requests: row.Requests, Tokens: int64(row.TotalTokens - row.SharedTokens), Cost: row.Cost - row.SharedCost}
+			groupDaily[row.Group] = addUsage(groupDaily[row.Group], upstream)
+		}
+	}
+	for name, monthly := range tokenMonthly {
+		s.quotas.Seed(name, tokenDaily[name], monthly)
+	}
+	// 模型组只有每日限额
+	for name, daily := range groupDaily {
+		s.groupQuotas.Seed(name, daily, quota.Usage{})
+	}
+}
+
+func addUsage(a, b quota.Usage) quota.Usage {
+	return quota.Usage{Requests: a.Requests + b.Requests, Tokens: a.Tokens + b.Tokens, Cost: a.Cost + b.Cost}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/elysia-api/backend/requestlog"
+	"github.com/gin-gonic/gin"
+)
+
+// openRequestLog 按配置打开请求记录存储，未启用时返回 nil
+func (s *Server) openRequestLog() *requestlog.Store {
+	if !s.config.RequestLog.Enabled {
+		return nil
+	}
+
+	dir := s.config.GetRequestLogDir()
+	store, err := requestlog.Open(requestlog.Options{
+		Dir:         dir,
+		MaxFileSize: int64(s.config.RequestLog.MaxFileSize) * 1024 * 1024,
+		MaxFiles:    s.config.RequestLog.MaxFiles,
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to open request log store: %v", err))
+		return nil
+	}
+	slog.Info(fmt.Sprintf("Request log store opened at %s", dir))
+	return store
+}
+
+// requestLogMiddleware 请求结束后将记录写入请求记录存储
+func (s *Server) requestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if s.requestLog == nil {
+			return
+		}
+
+		record := &requestlog.Record{
+			Time:      start,
+			RequestID: c.GetString(ctxKeyRequestID),
+			Token:     c.GetString(ctxKeyToken),
+			Group:     c.GetString(ctxKeyGroup),
+			Model:     c.GetString(ctxKeyModel),
+			Platform:  c.GetString(ctxKeyPlatform),
+			Format:    c.GetString(ctxKeyFormat),
+			Path:      c.Request.URL.Path,
+			Stream:    c.GetBool(ctxKeyStream),
+			Cached:    c.GetString(ctxKeyCache) == cacheHit,
+			Coalesced: c.GetBool(ctxKeyCoalesced),
+			Rejected:  c.GetBool(ctxKeyRejected),
+			Status:    c.Writer.Status(),
+			LatencyMs: time.Since(start).Milliseconds(),
+			Retries:   c.GetInt(ctxKeyRetries),
+		}
+		if usage, cost, ok := requestUsage(c); ok {
+			record.PromptTokens = usage.PromptTokens
+			record.CompletionTokens = usage.CompletionTokens
+			record.TotalTokens = usage.TotalTokens
+			record.Cost = cost
+		}
+		if value, ok := c.Get(ctxKeyStreamError); ok {
+			record.Error = fmt.Sprint(value)
+		}
+
+		if err := s.requestLog.Append(record); err != nil {
+			s.logError(c, "Failed to append request log: %v", err)
+		}
+	}
+}
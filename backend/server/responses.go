@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/gin-gonic/gin"
+)
+
+// openAIResponses 处理 OpenAI Responses API 请求（/v1/responses）
+// 网关不保存响应，每个请求都需要携带完整的上下文；响应和流式事件以 Responses 格式返回
+func (s *Server) openAIResponses(c *gin.Context) {
+	startTime := time.Now()
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		s.logError(c, "Error reading request body: %v", err)
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	s.logVerbose(c, "=== Incoming Responses Request (raw) ===")
+	s.logVerbose(c, "%s", redactedBody(bodyBytes))
+	c.Set(ctxKeyFormat, string(relay.FormatResponses))
+
+	unifiedReq, err := relay.ResponsesToUnified(bodyBytes)
+	if err != nil {
+		s.logError(c, "Error converting request: %v", err)
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+
+	s.relayUnified(c, unifiedReq, responseResponses, startTime)
+}
@@ -1,7 +1,8 @@
 package server
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,8 +12,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/elysia-api/backend/cache"
 	"github.com/elysia-api/backend/config"
+	"github.com/elysia-api/backend/metrics"
+	"github.com/elysia-api/backend/quota"
 	"github.com/elysia-api/backend/relay"
+	"github.com/elysia-api/backend/requestlog"
 	"github.com/gin-gonic/gin"
 )
 
@@ -20,6 +25,12 @@ type Server struct {
 	config        *config.Config
 	engine        *gin.Engine
 	openaiAdapter *relay.OpenAIAdapter
+	requestLog    *requestlog.Store // 未启用请求记录时为 nil
+	quotas        *quota.Manager // 访问令牌限额
+	groupQuotas   *quota.Manager // 模型组每日限额
+	cache         *cache.Cache   // 响应缓存，各模型组单独启用
+	flights       *coalescer     // 进行中的可合并请求
+	slots         *concurrencyLimiter // 模型组并发名额
 	// 轮询状态跟踪：模型组ID -> 当前模型索引
 	roundRobinIndex map[string]int
 	roundRobinMutex sync.Mutex
@@ -27,44 +38,63 @@ type Server struct {
 
 func New(cfg *config.Config) *Server {
 	gin.SetMode(gin.ReleaseMode)
-	engine := gin.Default()
+	// 使用结构化访问日志代替 gin 默认的 Logger 中间件
+	engine := gin.New()
 
-	// 获取 HTTP 超时配置，默认 120 秒
-	httpTimeout := time.Duration(cfg.HTTPTimeout) * time.Second
-	if cfg.HTTPTimeout == 0 {
-		httpTimeout = 0 // 0 表示不限制
-	}
-
-	return &Server{
+	s := &Server{
 		config:          cfg,
 		engine:          engine,
-		openaiAdapter:   relay.NewOpenAIAdapter(httpTimeout),
+		openaiAdapter:   relay.NewOpenAIAdapter(),
+		quotas:          quota.NewManager(),
+		groupQuotas:     quota.NewManager(),
+		flights:         newCoalescer(),
+		slots:           newConcurrencyLimiter(),
 		roundRobinIndex: make(map[string]int),
 	}
+	engine.Use(gin.Recovery(), s.requestID(), s.accessLog())
+	s.requestLog = s.openRequestLog()
+	s.seedQuotas()
+	s.cache = s.openCache()
+
+	return s
 }
 
-// logDebug 仅在调试模式下输出基本信息（模型组、选中模型、耗时）
-func (s *Server) logDebug(format string, args ...interface{}) {
-	if s.config.DebugMode {
-		log.Printf(format, args...)
+func (s *Server) setupRoutes() {
+	v1 := s.engine.Group("/v1", s.authenticate())
+	{
+		v1.POST("/chat/completions", s.metricsMiddleware(), s.requestLogMiddleware(), s.enforceQuota(), s.chatCompletions)
+		v1.POST("/responses", s.metricsMiddleware(), s.requestLogMiddleware(), s.enforceQuota(), s.openAIResponses)
+		v1.POST("/completions", s.metricsMiddleware(), s.requestLogMiddleware(), s.enforceQuota(), s.completions)
+		v1.GET("/models", s.listModels)
+		v1.POST("/tokenize", s.tokenize)
+		v1.GET("/dashboard/usage", s.dashboardUsage)
 	}
-}
 
-// logVerbose 仅在详细日志模式下输出完整请求/响应结构
-func (s *Server) logVerbose(format string, args ...interface{}) {
-	if s.config.DebugMode && s.config.VerboseLog {
-		log.Printf(format, args...)
+	// Anthropic 兼容路由，错误响应使用 Claude 格式
+	claude := s.engine.Group("/v1", claudeErrors(), s.authenticate())
+	{
+		claude.POST("/messages", s.metricsMiddleware(), s.requestLogMiddleware(), s.enforceQuota(), s.claudeMessages)
+		claude.POST("/messages/count_tokens", s.countMessageTokens)
 	}
-}
 
-func (s *Server) setupRoutes() {
-	v1 := s.engine.Group("/v1")
+	// Gemini 兼容路由：/v1beta/models/{group}:generateContent | :streamGenerateContent | :countTokens
+	gemini := s.engine.Group("/v1beta", geminiErrors(), s.authenticate())
 	{
-		v1.POST("/chat/completions", s.chatCompletions)
-		v1.GET("/models", s.listModels)
+		gemini.POST("/models/*target",
+			geminiGenerateOnly(s.metricsMiddleware()), geminiGenerateOnly(s.requestLogMiddleware()), geminiGenerateOnly(s.enforceQuota()),
+			s.geminiModels)
 	}
 
 	s.engine.GET("/health", s.healthCheck)
+	// 指标按访问令牌名和模型组分类，仅对管理员开放，Prometheus 抓取时使用 bearer_token 认证
+	s.engine.GET("/metrics", s.authenticate(), s.requireAdmin(), gin.WrapH(metrics.Handler()))
+
+	admin := s.engine.Group("/__admin", s.authenticate(), s.requireAdmin())
+	{
+		admin.GET("/logs", s.adminLogs)
+		admin.GET("/usage", s.adminUsage)
+		admin.POST("/debug/detect", s.debugDetect)
+	}
 }
 
 func (s *Server) chatCompletions(c *gin.Context) {
@@ -73,29 +103,42 @@ func (s *Server) chatCompletions(c *gin.Context) {
 	// 读取原始请求体
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		s.logError(c, "Error reading request body: %v", err)
 		c.JSON(400, gin.H{"error": "Failed to read request body"})
 		return
 	}
 
-	s.logVerbose("=== Incoming Request (raw) ===")
-	s.logVerbose("%s", string(bodyBytes))
+	s.logVerbose(c, "=== Incoming Request (raw) ===")
+	s.logVerbose(c, "%s", redactedBody(bodyBytes))
 
-	// 检测请求格式
-	inputFormat := relay.DetectInputFormat(bodyBytes)
-	s.logVerbose("Detected input format: %s", inputFormat)
+	// 确定请求格式：路由、请求头，最后按请求体内容判断
+	detection, err := resolveInputFormat(c.Request.URL.Path, c.Request.Header, bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	s.logVerbose(c, "Detected input format: %s (%s: %s)", detection.Format, detection.Source, detection.Reason)
+	c.Set(ctxKeyFormat, string(detection.Format))
 
 	// 转换为统一格式
-	unifiedReq, err := relay.ConvertToUnified(bodyBytes)
+	unifiedReq, err := relay.ConvertFormatToUnified(detection.Format, bodyBytes)
 	if err != nil {
-		log.Printf("Error converting request: %v", err)
+		s.logError(c, "Error converting request: %v", err)
 		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
 		return
 	}
 
-	s.logVerbose("=== Unified Request ===")
-	if unifiedReqJSON, err := relay.MarshalUnifiedRequest(unifiedReq); err == nil {
-		s.logVerbose("%s", string(unifiedReqJSON))
+	s.relayUnified(c, unifiedReq, responseOpenAI, startTime)
+}
+
+// relayUnified 将统一格式的请求转发到模型组中的上游，并按 format 写出响应
+// 各入口解析请求后都经由这里完成鉴权后的限额、缓存、选模型和转发
+func (s *Server) relayUnified(c *gin.Context, unifiedReq *relay.UnifiedRequest, format responseFormat, startTime time.Time) {
+	if s.verboseEnabled(c) {
+		s.logVerbose(c, "=== Unified Request ===")
+		if unifiedReqJSON, err := relay.MarshalUnifiedRequest(unifiedReq); err == nil {
+			s.logVerbose(c, "%s", redactedBody(unifiedReqJSON))
+		}
 	}
 
 	// 验证并获取模型组
@@ -111,102 +154,424 @@ func (s *Server) chatCompletions(c *gin.Context) {
 		return
 	}
 
+	c.Set(ctxKeyGroup, group.Name)
+	if !allowGroup(c, group.Name) {
+		return
+	}
+	recordGroupUsage, ok := s.acquireGroupQuota(c, group)
+	if !ok {
+		return
+	}
+	defer recordGroupUsage()
+
+	// 按模型组配置过滤透传给上游的未知字段
+	if dropped := unifiedReq.FilterExtraFields(group.Passthrough.Allows); len(dropped) > 0 {
+		s.logDebug(c, "Dropped passthrough fields not allowed for group '%s': %s", group.Name, strings.Join(dropped, ", "))
+	}
+
+	// 模型组的 overrides 在计算缓存键和提示词 token 数之前应用
+	if len(group.Overrides) > 0 {
+		overridden, err := relay.ApplyOverrides(unifiedReq, group.Overrides)
+		if err != nil {
+			s.logError(c, "Error applying overrides: %v", err)
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply overrides of group '%s': %v", group.Name, err)})
+			return
+		}
+		unifiedReq = overridden
+	}
+
 	// 根据策略选择具体模型
 	selectedModel := s.selectModel(group)
-	s.logDebug("Request model group: '%s', selected: %s", group.Name, selectedModel.Name)
+	s.logDebug(c, "Request model group: '%s', selected: %s", group.Name, selectedModel.Name)
+
+	// 模型的 overrides 在计算请求指纹、提示词 token 数和检查上下文窗口之前应用，
+	// 这些步骤都以实际发往上游的请求为准；未应用模型 overrides 的请求保留用于对冲
+	modelReq, err := relay.ApplyOverrides(unifiedReq, selectedModel.Overrides)
+	if err != nil {
+		s.logError(c, "Error applying overrides: %v", err)
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to apply overrides of model '%s': %v", selectedModel.Name, err)})
+		return
+	}
+
+	// 命中响应缓存时直接返回，不再请求上游
+	// 指纹中的模型名仍为模型组名，没有 overrides 的模型共用缓存
+	fingerprint := s.requestFingerprint(c, group, modelReq)
+	cacheKey, served := s.lookupCache(c, group, modelReq, fingerprint, format)
+	if served {
+		return
+	}
+	defer metrics.TrackInflight(group.Name, group.MaxConcurrency)()
 
 	// 更新模型名称
 	unifiedReq.Model = selectedModel.Name
+	modelReq.Model = selectedModel.Name
 
 	// 检测目标平台
 	targetPlatform := relay.DetectPlatform(selectedModel.BaseURL, selectedModel.Platform)
-	s.logVerbose("Target platform: %s", targetPlatform)
+	s.logVerbose(c, "Target platform: %s", targetPlatform)
+	c.Set(ctxKeyModel, selectedModel.Name)
+	c.Set(ctxKeyPlatform, string(targetPlatform))
+
+	rr := &relayRequest{
+		group:     group,
+		model:     selectedModel,
+		platform:  targetPlatform,
+		unified:   modelReq,
+		base:      unifiedReq,
+		timeouts:  s.resolveTimeouts(group, &selectedModel),
+		startTime: startTime,
+		wantUsage: unifiedReq.StreamOptions != nil && unifiedReq.StreamOptions.IncludeUsage,
+		cacheKey:  cacheKey,
+		format:    format,
+	}
+	if group.Coalesce {
+		rr.coalesceKey = fingerprint
+	}
+
+	// 本地计算提示词 token 数，超出上下文窗口时按模型组策略裁剪或直接拒绝，避免无效的上游请求
+	rr.promptTokens = relay.EstimatePromptTokens(modelReq)
+	if err := s.checkContextWindow(c, rr); err != nil {
+		s.logDebug(c, "Rejecting request: %v", err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 从统一格式转换为目标平台格式
-	targetBody, err := relay.ConvertFromUnified(unifiedReq, targetPlatform)
-	if err != nil {
-		log.Printf("Error converting to target format: %v", err)
+	if err := prepareUpstream(rr); err != nil {
+		s.logError(c, "Error converting to target format: %v", err)
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
 		return
 	}
+	targetBody := rr.body
 
-	s.logVerbose("=== Outgoing Request to %s ===", selectedModel.BaseURL)
-	s.logVerbose("%s", string(targetBody))
-
-	// 检查是否为流式请求
-	isStream := relay.IsStreamRequest(targetBody)
+	s.logVerbose(c, "=== Outgoing Request to %s ===", selectedModel.BaseURL)
+	s.logVerbose(c, "%s", redactedBody(targetBody))
 
+	// 检查是否为流式请求，以统一格式的请求为准，不再解析转换后的请求体
+	isStream := rr.unified.Stream
+	c.Set(ctxKeyStream, isStream)
 	if isStream {
 		// 流式请求处理
-		s.handleStreamRequest(c, selectedModel, targetBody, startTime)
+		s.handleStreamRequest(c, rr)
 	} else {
 		// 非流式请求处理
-		s.handleNormalRequest(c, selectedModel, targetBody, startTime)
+		s.handleNormalRequest(c, rr)
+	}
+}
+
+// relayRequest 单次转发所需的上下文
+type relayRequest struct {
+	group     *config.ModelGroupConfig
+	model     config.ModelRef
+	platform  relay.Platform
+	unified   *relay.UnifiedRequest // 已应用模型 overrides 的请求
+	base      *relay.UnifiedRequest // 应用模型 overrides 之前的请求，对冲时在此基础上应用对冲模型的 overrides
+	body      []byte                // 已转换为目标平台格式的请求体
+	timeouts  relay.Timeouts
+	startTime time.Time
+	wantUsage bool           // 客户端是否请求了 stream_options.include_usage
+	format    responseFormat // 客户端期望的响应格式
+
+	promptTokens int    // 本地计算的提示词 token 数
+	cacheKey     string // 响应缓存键，为空时不写入缓存
+	coalesceKey  string // 请求合并键，为空时不合并
+	completion   bool   // 请求体为旧版 /completions 格式，发送到上游的 /completions 接口
+	structuredTool bool // 结构化输出通过强制调用工具实现，上游返回的工具调用需要还原为文本
+
+	hedged       bool        // 是否发起了对冲请求
+	overhead     relay.Usage // 被取消的对冲一方计入的用量，以及结构化输出校验失败被丢弃的响应的用量
+	overheadCost float64     // 被取消的对冲一方计入的费用，以及结构化输出校验失败被丢弃的响应的费用
+	retries      int         // 结构化输出校验失败后的重试次数
+}
+
+// resolveTimeouts 将配置中的超时转换为 relay 使用的超时设置
+func (s *Server) resolveTimeouts(group *config.ModelGroupConfig, model *config.ModelRef) relay.Timeouts {
+	resolved := s.config.ResolveTimeouts(group, model)
+	return relay.Timeouts{
+		Dial:         resolved.Dial,
+		TLSHandshake: resolved.TLSHandshake,
+		FirstByte:    resolved.FirstByte,
+		Idle:         resolved.Idle,
+		Total:        resolved.Total,
+	}
+}
+
+// upstreamOf 返回模型的上游地址、认证方式和附加的请求头、查询参数
+// authScheme 已在加载配置时校验
+func upstreamOf(model *config.ModelRef) relay.Upstream {
+	upstream := relay.Upstream{
+		BaseURL: model.BaseURL,
+		APIKey:  model.APIKey,
+		Headers: model.Headers,
+		Query:   model.Query,
+	}
+	scheme, name, _ := model.Auth()
+	switch scheme {
+	case config.AuthBearer:
+		upstream.AuthHeader, upstream.AuthPrefix = "Authorization", "Bearer "
+	case config.AuthHeader:
+		upstream.AuthHeader = name
+	case config.AuthQuery:
+		upstream.AuthQuery = name
+	}
+	return upstream
+}
+
+// recordUsage 保存本次请求的用量和费用，供配额统计和日志使用
+// 发生对冲时被取消一方的用量和费用一并计入
+func (s *Server) recordUsage(c *gin.Context, rr *relayRequest, usage relay.Usage, estimated bool) {
+	cost := usageCost(&rr.model, usage)
+	if rr.overhead.TotalTokens > 0 {
+		s.logDebug(c, "Overhead of cancelled or discarded attempts: prompt=%d, completion=%d, cost=$%.6f",
+			rr.overhead.PromptTokens, rr.overhead.CompletionTokens, rr.overheadCost)
+		usage.PromptTokens += rr.overhead.PromptTokens
+		usage.CompletionTokens += rr.overhead.CompletionTokens
+		usage.TotalTokens += rr.overhead.TotalTokens
+		cost += rr.overheadCost
+	}
+	s.setUsage(c, usage, cost, estimated)
+}
+
+// recordSharedUsage 保存合并请求的用量和费用：按实际处理请求的上游计费，计入本请求访问令牌的限额和请求记录
+// 上游只调用了一次，模型组限额和指标只在发起请求的一方计入，见 upstreamUsage
+func (s *Server) recordSharedUsage(c *gin.Context, owner *relayRequest, usage relay.Usage, estimated bool) {
+	s.setUsage(c, usage, usageCost(&owner.model, usage), estimated)
+}
+
+func (s *Server) setUsage(c *gin.Context, usage relay.Usage, cost float64, estimated bool) {
+	c.Set(ctxKeyUsage, usage)
+	c.Set(ctxKeyCost, cost)
+
+	source := "upstream"
+	if estimated {
+		source = "estimated"
+	}
+	s.logDebug(c, "Usage: prompt=%d (cached=%d), completion=%d, total=%d, cost=$%.6f (%s)",
+		usage.PromptTokens, usage.CachedTokens(), usage.CompletionTokens, usage.TotalTokens, cost, source)
+}
+
+// setUpstream 记录实际处理请求的模型，发生对冲时可能与最初选择的模型不同
+func (s *Server) setUpstream(c *gin.Context, rr *relayRequest) {
+	c.Set(ctxKeyModel, rr.model.Name)
+	c.Set(ctxKeyPlatform, string(rr.platform))
+	retries := rr.retries
+	if rr.hedged {
+		retries++
+		s.logDebug(c, "Hedged request served by %s", rr.model.Name)
+	}
+	if retries > 0 {
+		c.Set(ctxKeyRetries, retries)
 	}
 }
 
-func (s *Server) handleNormalRequest(c *gin.Context, selectedModel config.ModelRef, targetBody []byte, startTime time.Time) {
-	// 转发请求到选定的模型
-	resp, err := s.openaiAdapter.SendRequestRaw(selectedModel.BaseURL, selectedModel.APIKey, targetBody)
+func (s *Server) handleNormalRequest(c *gin.Context, rr *relayRequest) {
+	// 转发请求到选定的模型，启用请求合并时与进行中的相同请求共用一次上游调用
+	var resp *relay.OpenAIResponse
+	var owner *relayRequest
+	var err error
+	shared := false
+	if rr.coalesceKey != "" {
+		resp, owner, shared, err = s.flights.do(c.Request.Context(), rr.coalesceKey, rr, s.sendValidated)
+		if shared {
+			s.markCoalesced(c, owner)
+		} else {
+			rr = owner
+		}
+	} else {
+		resp, rr, err = s.sendValidated(c.Request.Context(), rr)
+	}
+	if !shared {
+		s.setUpstream(c, rr)
+	}
 	if err != nil {
-		log.Printf("Error forwarding request: %v", err)
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to forward request: %v", err)})
+		s.logError(c, "Error forwarding request: %v", err)
+		// 失败前上游已处理的尝试（未通过校验的响应、被取消的对冲）仍然计费
+		if !shared && (rr.overhead.TotalTokens > 0 || rr.overheadCost > 0) {
+			s.recordUsage(c, rr, relay.Usage{}, false)
+		}
+		status := 500
+		if errors.Is(err, relay.ErrInvalidStructuredOutput) {
+			status = 502
+		}
+		c.JSON(status, gin.H{"error": fmt.Sprintf("Failed to forward request: %v", err)})
 		return
 	}
 
-	s.logVerbose("=== Response ===")
-	if respJSON, err := relay.MarshalResponse(resp); err == nil {
-		s.logVerbose("%s", string(respJSON))
+	if s.verboseEnabled(c) {
+		s.logVerbose(c, "=== Response ===")
+		if respJSON, err := relay.MarshalResponse(resp); err == nil {
+			s.logVerbose(c, "%s", redactedBody(respJSON))
+		}
 	}
 
 	// 记录请求耗时
-	duration := time.Since(startTime)
-	s.logDebug("Request completed in %dms", duration.Milliseconds())
+	duration := time.Since(rr.startTime)
+	s.logDebug(c, "Request completed in %dms", duration.Milliseconds())
+
+	// 合并的请求同样计入访问令牌的用量，但没有产生额外的上游调用
+	usage, estimated := responseUsage(rr, resp)
+	if shared {
+		s.recordSharedUsage(c, owner, usage, estimated)
+	} else {
+		s.recordUsage(c, rr, usage, estimated)
+		s.storeCache(c, rr, resp)
+	}
 
 	// 返回模型的响应
-	c.JSON(200, resp)
+	writeResponse(c, rr.format, rr.unified, resp)
 }
 
-func (s *Server) handleStreamRequest(c *gin.Context, selectedModel config.ModelRef, targetBody []byte, startTime time.Time) {
-	// 设置 SSE 响应头
+// responseUsage 返回非流式响应的用量，上游未返回 usage 时使用本地估算
+func responseUsage(rr *relayRequest, resp *relay.OpenAIResponse) (relay.Usage, bool) {
+	usage := resp.Usage
+	if usage.TotalTokens == 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return relay.EstimateResponseUsage(rr.unified, rr.promptTokens, resp), true
+	}
+	return usage, false
+}
+
+// setSSEHeaders 设置 SSE 响应头
+func setSSEHeaders(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
 	c.Writer.Header().Set("X-Accel-Buffering", "no")
+}
 
-	// 发送流式请求
-	resp, err := s.openaiAdapter.SendRequestStream(selectedModel.BaseURL, selectedModel.APIKey, targetBody)
-	if err != nil {
-		log.Printf("Error forwarding stream request: %v", err)
-		c.SSEvent("error", fmt.Sprintf("Failed to forward request: %v", err))
-		return
-	}
-	defer resp.Body.Close()
+func (s *Server) handleStreamRequest(c *gin.Context, rr *relayRequest) {
+	// 设置 SSE 响应头
+	setSSEHeaders(c)
 
-	// 转发流式响应
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		log.Printf("Streaming not supported")
+	if _, ok := c.Writer.(http.Flusher); !ok {
+		s.logError(c, "Streaming not supported")
 		c.JSON(500, gin.H{"error": "Streaming not supported"})
 		return
 	}
 
-	// 使用 bufio 逐行读取并转发
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// 直接转发 SSE 行
-		c.Writer.Write([]byte(line + "\n\n"))
-		flusher.Flush()
+	// 启用请求合并时加入进行中的相同流式请求（回放已收到的事件），否则直接请求上游
+	// 客户端断开时 context 取消，上游请求随之中止（合并时等所有订阅者都断开）
+	var next func() (*relay.SSEEvent, error)
+	var sub *streamSubscription
+	shared := false
+	if rr.coalesceKey != "" {
+		sub, shared = s.flights.subscribe(c.Request.Context(), rr.coalesceKey, rr, func(ctx context.Context, f *streamFlight) {
+			s.pumpStream(ctx, rr, f)
+		})
+		defer sub.Close()
+		if shared {
+			s.markCoalesced(c, sub.flight.Owner())
+		}
+		next = sub.Next
+	} else {
+		stream, winner, err := s.openStream(c.Request.Context(), rr)
+		rr = winner
+		s.setUpstream(c, rr)
+		if err != nil {
+			// 连接失败交给下面统一处理
+			next = func() (*relay.SSEEvent, error) { return nil, err }
+		} else {
+			defer stream.Close()
+			next = stream.Next
+		}
+	}
+
+	// 按 SSE 事件转发，保留事件边界、多行 data 以及 event/id 字段
+	// 合并的请求共享事件对象，这里只读取不修改
+	writer := relay.NewSSEWriter(c.Writer)
+	tracker := relay.NewStreamUsageTracker(rr.model.Name, rr.promptTokens)
+	var accumulator *relay.StreamAccumulator
+	if rr.cacheKey != "" && !shared {
+		accumulator = relay.NewStreamAccumulator()
+	}
+	converter := newStreamConverter(rr.format, rr.unified, rr.wantUsage, rr.model.Name, rr.promptTokens)
+	firstEvent := true
+	err := relay.ForwardEvents(next, writer, func(event *relay.SSEEvent) bool {
+		if firstEvent && event.HasData {
+			firstEvent = false
+			metrics.ObserveTTFT(relayLabels(c), time.Since(rr.startTime))
+		}
+		if accumulator != nil {
+			accumulator.Observe(event)
+		}
+		usageOnly := tracker.Observe(event)
+		// 其他格式的客户端由转换器输出对应格式的事件
+		if converter != nil {
+			events := converter.Convert(event)
+			if event.IsDone() {
+				usage, _ := tracker.Usage()
+				events = converter.Finish(usage)
+			}
+			writeEvents(writer, events)
+			return false
+		}
+		// usage 块是网关为统计而请求的，客户端未请求时不转发
+		if usageOnly && !rr.wantUsage {
+			return false
+		}
+		// 客户端请求了 usage 但上游没有返回，在结束标记前补发估算值
+		if event.IsDone() && rr.wantUsage && !tracker.HasUpstreamUsage() {
+			if chunk, err := tracker.UsageChunk(); err == nil {
+				writer.WriteData(string(chunk))
+			}
+		}
+		return true
+	})
+
+	// 上游没有发送结束标记时补齐收尾事件
+	if err == nil && converter != nil {
+		usage, _ := tracker.Usage()
+		writeEvents(writer, converter.Finish(usage))
 	}
 
 	// 记录请求耗时
-	duration := time.Since(startTime)
-	s.logDebug("Stream request completed in %dms", duration.Milliseconds())
+	duration := time.Since(rr.startTime)
+	s.logDebug(c, "Stream request completed in %dms", duration.Milliseconds())
+
+	// 合并的流式请求结束后才能确定最终处理请求的上游
+	if sub != nil {
+		if shared {
+			owner := sub.flight.Owner()
+			c.Set(ctxKeyModel, owner.model.Name)
+			c.Set(ctxKeyPlatform, string(owner.platform))
+		} else {
+			rr = sub.flight.Owner()
+			s.setUpstream(c, rr)
+		}
+	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading stream: %v", err)
+	// 合并的请求同样计入访问令牌的用量，但没有产生额外的上游调用
+	// 没有收到任何事件就失败的请求不计用量
+	usage, estimated := tracker.Usage()
+	if !(err != nil && firstEvent) {
+		if shared {
+			s.recordSharedUsage(c, sub.flight.Owner(), usage, estimated)
+		} else {
+			s.recordUsage(c, rr, usage, estimated)
+		}
+	}
+
+	// 完整结束的流式响应拼装后写入缓存，供之后的流式和非流式请求使用
+	if err == nil && accumulator != nil {
+		if resp, ok := accumulator.Response(); ok {
+			resp.Usage = usage
+			s.storeCache(c, rr, resp)
+		}
+	}
+
+	if err != nil {
+		s.logError(c, "Error reading stream: %v", err)
+		c.Set(ctxKeyStreamError, err)
+		switch {
+		case errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil:
+			// 客户端已断开
+		case errors.Is(err, relay.ErrFirstByteTimeout) || errors.Is(err, relay.ErrStreamIdleTimeout):
+			// 上游停滞被中止时通知客户端，避免其一直等待
+			writeStreamError(writer, rr.format, fmt.Sprintf("Upstream stream aborted: %v", err))
+		case firstEvent:
+			// 连接上游时失败
+			writeStreamError(writer, rr.format, fmt.Sprintf("Failed to forward request: %v", err))
+		}
 	}
 }
 
@@ -261,17 +626,32 @@ func (s *Server) validateModelGroup(groupName string) (*config.ModelGroupConfig,
 func (s *Server) listModels(c *gin.Context) {
 	groups := s.config.GetGroups()
 
+	token, hasToken := accessToken(c)
+	admin := s.isAdmin(c)
+
 	// 返回模型组名称作为模型 ID
 	// 客户端看到的是模型组名称，请求时使用模型组名称
 	// 后端根据配置的轮询策略将请求转发给组内的具体模型
-	var models []gin.H
+	// 只列出调用方令牌可以使用的模型组；管理员同时可以看到已停用的模型组
+	models := []gin.H{}
 	for _, group := range groups {
-		models = append(models, gin.H{
+		if hasToken && !token.AllowsGroup(group.Name) {
+			continue
+		}
+		if !group.Enabled && !admin {
+			continue
+		}
+
+		model := gin.H{
 			"id":       group.Name,  // 使用模型组名称
 			"object":   "model",
 			"created":  0,
 			"owned_by": "elysia-api",
-		})
+		}
+		if admin {
+			model["enabled"] = group.Enabled
+		}
+		models = append(models, model)
 	}
 
 	c.JSON(200, gin.H{
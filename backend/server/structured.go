@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/elysia-api/backend/relay"
+)
+
+// sendValidated 发送非流式请求；模型组启用结构化输出校验且请求要求返回 JSON 时，
+// 返回内容不是合法 JSON 或不符合 JSON Schema 则重新请求
+// 被丢弃的响应以及每次对冲中被取消一方的用量都计入返回请求的 overhead，重试耗尽或重新请求失败时同样如此
+func (s *Server) sendValidated(ctx context.Context, rr *relayRequest) (*relay.OpenAIResponse, *relayRequest, error) {
+	resp, winner, err := s.sendNormal(ctx, rr)
+	policy := rr.group.StructuredOutput
+	if err != nil || policy == nil || !policy.Validate || !rr.unified.ResponseFormat.IsJSON() {
+		return resp, winner, err
+	}
+
+	var overhead relay.Usage
+	var overheadCost float64
+	for retry := 0; ; retry++ {
+		invalid := relay.ValidateStructuredOutput(rr.unified.ResponseFormat, resp)
+		if invalid == nil {
+			if retry == 0 {
+				return resp, winner, nil
+			}
+			return resp, withOverhead(winner, retry, overhead, overheadCost), nil
+		}
+		// 被丢弃的响应与最终响应一样，上游未返回 usage 时按本地估算计费
+		discarded, _ := responseUsage(winner, resp)
+		overhead = sumUsage(overhead, discarded)
+		overheadCost += usageCost(&winner.model, discarded)
+		if retry >= policy.Retries() {
+			return nil, withOverhead(winner, retry, overhead, overheadCost), fmt.Errorf("%w (after %d attempts)", invalid, retry+1)
+		}
+		slog.Debug(fmt.Sprintf("Structured output from %s failed validation, retrying: %v", winner.model.Name, invalid))
+
+		// 重新请求会替换 winner，先计入这次对冲中被取消一方的用量
+		overhead = sumUsage(overhead, winner.overhead)
+		overheadCost += winner.overheadCost
+		resp, winner, err = s.sendNormal(ctx, rr)
+		if err != nil {
+			return nil, withOverhead(winner, retry+1, overhead, overheadCost), err
+		}
+	}
+}
+
+// withOverhead 复制请求后记录重试次数并累加 overhead
+// 请求可能是对冲时的副本或调用方持有的请求，不直接修改
+func withOverhead(rr *relayRequest, retries int, overhead relay.Usage, overheadCost float64) *relayRequest {
+	copied := *rr
+	copied.retries = retries
+	copied.overhead = sumUsage(copied.overhead, overhead)
+	copied.overheadCost += overheadCost
+	return &copied
+}
+
+// sumUsage 累加两次请求的 token 用量
+func sumUsage(a, b relay.Usage) relay.Usage {
+	a.PromptTokens += b.PromptTokens
+	a.CompletionTokens += b.CompletionTokens
+	a.TotalTokens += b.TotalTokens
+	return a
+}
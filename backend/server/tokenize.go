@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/elysia-api/backend/relay"
+	"github.com/elysia-api/backend/tokenizer"
+	"github.com/gin-gonic/gin"
+)
+
+// resolveTokenizerModel 将模型组名称解析为组内首个模型，用于选择编码
+// 找不到模型组时按模型名称处理；访问令牌无权使用该模型组时返回 403 并返回 false
+func (s *Server) resolveTokenizerModel(c *gin.Context, name string) (string, bool) {
+	group := s.config.GetGroupByName(name)
+	if group == nil {
+		return name, true
+	}
+	if !allowGroup(c, group.Name) {
+		return "", false
+	}
+	if len(group.Models) > 0 {
+		return group.Models[0].Name, true
+	}
+	return name, true
+}
+
+// tokenize 本地计算 token 数
+// 请求体可以是 {"model": ..., "input": "文本" | ["文本", ...]}，
+// 也可以是任意支持格式的对话请求（按提示词计数）
+func (s *Server) tokenize(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var req struct {
+		Model string      `json:"model"`
+		Input interface{} `json:"input"`
+	}
+	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	model, ok := s.resolveTokenizerModel(c, req.Model)
+	if !ok {
+		return
+	}
+	encoding := tokenizer.EncodingForModel(model)
+
+	if req.Input != nil {
+		var inputs []string
+		switch v := req.Input.(type) {
+		case string:
+			inputs = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					c.JSON(400, gin.H{"error": "input must be a string or an array of strings"})
+					return
+				}
+				inputs = append(inputs, text)
+			}
+		default:
+			c.JSON(400, gin.H{"error": "input must be a string or an array of strings"})
+			return
+		}
+
+		total := 0
+		exact := true
+		tokens := make([][]int, 0, len(inputs))
+		for _, text := range inputs {
+			ids, ok := tokenizer.Encode(encoding, text)
+			if ok {
+				total += len(ids)
+			} else {
+				total += tokenizer.Count(encoding, text)
+			}
+			exact = exact && ok
+			tokens = append(tokens, ids)
+		}
+
+		result := gin.H{
+			"object":   "tokenize",
+			"model":    model,
+			"encoding": encoding,
+			"exact":    exact,
+			"count":    total,
+		}
+		if exact {
+			result["tokens"] = tokens
+		}
+		c.JSON(200, result)
+		return
+	}
+
+	detection, err := resolveInputFormat(c.Request.URL.Path, c.Request.Header, bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	unifiedReq, err := relay.ConvertFormatToUnified(detection.Format, bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+	unifiedReq.Model = model
+
+	c.JSON(200, gin.H{
+		"object":   "tokenize",
+		"model":    model,
+		"encoding": encoding,
+		"exact":    false,
+		"count":    relay.EstimatePromptTokens(unifiedReq),
+	})
+}
+
+// countMessageTokens 兼容 Anthropic 的 /v1/messages/count_tokens
+func (s *Server) countMessageTokens(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	unifiedReq, err := relay.ClaudeToUnified(bodyBytes)
+	if err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Failed to convert request: %v", err)})
+		return
+	}
+	model, ok := s.resolveTokenizerModel(c, unifiedReq.Model)
+	if !ok {
+		return
+	}
+	unifiedReq.Model = model
+
+	c.JSON(200, gin.H{"input_tokens": relay.EstimatePromptTokens(unifiedReq)})
+}
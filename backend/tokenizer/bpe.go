@@ -0,0 +1,42 @@
+package tokenizer
+
+import (
+	"log"
+	"sync"
+
+	tiktoken "github.com/pkoukk/tiktoken-go"
+	loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// BPE 词表随二进制一起打包，不依赖网络下载
+func init() {
+	tiktoken.SetBpeLoader(loader.NewOfflineLoader())
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+	failed      = make(map[string]bool)
+)
+
+// loadEncoding 按需加载 BPE 编码，加载失败返回 nil 并回退到估算
+func loadEncoding(name string) *tiktoken.Tiktoken {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc
+	}
+	if failed[name] {
+		return nil
+	}
+
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		log.Printf("Failed to load tokenizer encoding %s: %v", name, err)
+		failed[name] = true
+		return nil
+	}
+	encodings[name] = enc
+	return enc
+}
@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// 编码名称
+const (
+	EncodingCL100K = "cl100k_base"
+	EncodingO200K  = "o200k_base"
+	EncodingClaude = "claude" // 基于 cl100k 的近似
+	EncodingGemini = "gemini" // 基于 o200k 的近似
+)
+
+// 近似编码相对于基础 BPE 的放大系数
+// Claude 的分词器对英文和代码通常比 cl100k 多 5%~15% 的 token，
+// Gemini 的 SentencePiece 与 o200k 接近
+const (
+	claudeScale = 1.1
+	geminiScale = 1.0
+)
+
+// ChatMessage 用于计数的对话消息（仅保留文本）
+type ChatMessage struct {
+	Role    string
+	Name    string
+	Content string
+}
+
+// 对话格式的额外开销，参考 OpenAI 的计数方式：
+// 每条消息约 3 个 token 的包装，回复前约 3 个 token 的引导
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// EncodingForModel 根据模型名称选择编码
+func EncodingForModel(model string) string {
+	name := strings.ToLower(model)
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:] // 去掉 "openai/gpt-4o" 之类的厂商前缀
+	}
+
+	switch {
+	case strings.Contains(name, "claude"):
+		return EncodingClaude
+	case strings.Contains(name, "gemini"), strings.Contains(name, "gemma"):
+		return EncodingGemini
+	case strings.HasPrefix(name, "gpt-4o"), strings.HasPrefix(name, "gpt-4.1"),
+		strings.HasPrefix(name, "gpt-4.5"), strings.HasPrefix(name, "gpt-5"),
+		strings.HasPrefix(name, "chatgpt-4o"), strings.HasPrefix(name, "gpt-oss"),
+		strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return EncodingO200K
+	}
+	return EncodingCL100K
+}
+
+// Encode 使用指定编码切分文本，exact 表示结果为真实 BPE token（而非近似值）
+// 近似编码不返回 token ID
+func Encode(encoding, text string) (tokens []int, exact bool) {
+	switch encoding {
+	case EncodingCL100K, EncodingO200K:
+		if enc := loadEncoding(encoding); enc != nil {
+			return enc.EncodeOrdinary(text), true
+		}
+	}
+	return nil, false
+}
+
+// Count 使用指定编码计算文本 token 数
+func Count(encoding, text string) int {
+	if text == "" {
+		return 0
+	}
+
+	switch encoding {
+	case EncodingCL100K, EncodingO200K:
+		if enc := loadEncoding(encoding); enc != nil {
+			return len(enc.EncodeOrdinary(text))
+		}
+	case EncodingClaude:
+		if enc := loadEncoding(EncodingCL100K); enc != nil {
+			return scale(len(enc.EncodeOrdinary(text)), claudeScale)
+		}
+	case EncodingGemini:
+		if enc := loadEncoding(EncodingO200K); enc != nil {
+			return scale(len(enc.EncodeOrdinary(text)), geminiScale)
+		}
+	}
+	return estimate(text)
+}
+
+// CountText 计算一段文本在指定模型下的 token 数
+func CountText(model, text string) int {
+	return Count(EncodingForModel(model), text)
+}
+
+// CountMessages 计算一组对话消息作为提示词时的 token 数
+func CountMessages(model string, messages []ChatMessage) int {
+	encoding := EncodingForModel(model)
+	total := 0
+	for _, msg := range messages {
+		total += tokensPerMessage
+		total += Count(encoding, msg.Role)
+		total += Count(encoding, msg.Content)
+		if msg.Name != "" {
+			total += Count(encoding, msg.Name) + tokensPerName
+		}
+	}
+	return total + tokensPerReply
+}
+
+func scale(n int, factor float64) int {
+	return int(math.Ceil(float64(n) * factor))
+}
+
+// estimate 基于字符类别的近似计数：
+// 连续的字母数字约每 4 个字符一个 token，CJK 等宽字符每个约一个 token，
+// 标点符号单独计为一个 token，空白不计
+func estimate(text string) int {
+	tokens := 0
+	run := 0
+
+	flush := func() {
+		if run > 0 {
+			tokens += (run + 3) / 4
+			run = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			run++
+		case unicode.IsSpace(r):
+			flush()
+		case isWide(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// 其他非 ASCII 文字（西里尔、希腊等）编码效率较低
+			run += 2
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// isWide 是否为 CJK、假名、谚文等通常按字切分的字符
+func isWide(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
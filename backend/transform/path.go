@@ -0,0 +1,169 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segment 路径中的一段：对象键或数组下标，* 匹配所有键或元素
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath 解析 JSON 路径，如 temperature、$.generationConfig.topK、messages[0].content、messages[-1]、messages[*].name
+// 负数下标从末尾开始计数
+func parsePath(path string) ([]segment, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("path '%s' is empty", path)
+	}
+	var segments []segment
+	for rest != "" {
+		switch rest[0] {
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path '%s': missing ']'", path)
+			}
+			inner := rest[1:end]
+			if inner == "*" {
+				segments = append(segments, segment{isIndex: true, wildcard: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path '%s': invalid index '%s'", path, inner)
+				}
+				segments = append(segments, segment{isIndex: true, index: index})
+			}
+			rest = rest[end+1:]
+		case '.':
+			rest = rest[1:]
+			if rest == "" || rest[0] == '.' || rest[0] == '[' {
+				return nil, fmt.Errorf("path '%s': empty key", path)
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			segments = append(segments, segment{key: key, wildcard: key == "*"})
+			rest = rest[end:]
+		}
+	}
+	return segments, nil
+}
+
+// hasWildcard 路径中是否包含通配符
+func hasWildcard(segments []segment) bool {
+	for _, seg := range segments {
+		if seg.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// location 文档中的一个位置，通过闭包读写所在的对象或数组
+type location struct {
+	get func() (interface{}, bool)
+	set func(interface{})
+	del func()
+}
+
+// locate 返回路径匹配的所有位置
+// create 为 true 时沿途缺少的对象会被创建（数组不会自动创建），用于写入
+// 通配符匹配的数组元素按下标从大到小返回，依次删除时不会影响尚未处理的下标
+func locate(loc location, segments []segment, create bool) []location {
+	if len(segments) == 0 {
+		return []location{loc}
+	}
+	seg := segments[0]
+	current, exists := loc.get()
+
+	if seg.isIndex {
+		array, ok := current.([]interface{})
+		if !ok {
+			return nil
+		}
+		var indices []int
+		if seg.wildcard {
+			for i := len(array) - 1; i >= 0; i-- {
+				indices = append(indices, i)
+			}
+		} else {
+			i := seg.index
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 || i >= len(array) {
+				return nil
+			}
+			indices = []int{i}
+		}
+		var found []location
+		for _, i := range indices {
+			i := i
+			child := location{
+				get: func() (interface{}, bool) {
+					array, _ := loc.get()
+					items, _ := array.([]interface{})
+					if i >= len(items) {
+						return nil, false
+					}
+					return items[i], true
+				},
+				set: func(value interface{}) {
+					array, _ := loc.get()
+					if items, ok := array.([]interface{}); ok && i < len(items) {
+						items[i] = value
+					}
+				},
+				del: func() {
+					array, _ := loc.get()
+					if items, ok := array.([]interface{}); ok && i < len(items) {
+						loc.set(append(items[:i:i], items[i+1:]...))
+					}
+				},
+			}
+			found = append(found, locate(child, segments[1:], create)...)
+		}
+		return found
+	}
+
+	object, ok := current.(map[string]interface{})
+	if !ok {
+		if !create || seg.wildcard || (exists && current != nil) {
+			return nil
+		}
+		object = make(map[string]interface{})
+		loc.set(object)
+	}
+	keys := []string{seg.key}
+	if seg.wildcard {
+		keys = keys[:0]
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	var found []location
+	for _, key := range keys {
+		key := key
+		child := location{
+			get: func() (interface{}, bool) {
+				value, ok := object[key]
+				return value, ok
+			},
+			set: func(value interface{}) { object[key] = value },
+			del: func() { delete(object, key) },
+		}
+		found = append(found, locate(child, segments[1:], create)...)
+	}
+	return found
+}
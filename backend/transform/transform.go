@@ -0,0 +1,216 @@
+// Package transform 按声明式规则修改 JSON 请求，用于模型组和模型的 overrides / transforms 配置
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// 规则操作
+const (
+	OpSet     = "set"     // 写入 value，沿途缺少的对象会被创建
+	OpDefault = "default" // 字段不存在或为 null 时写入 value
+	OpRemove  = "remove"  // 删除字段或数组元素
+	OpClamp   = "clamp"   // 将数值限制在 [min, max] 内，字段不存在时不处理
+	OpRename  = "rename"  // 将字段移动到 to 指定的路径，字段不存在时不处理
+	OpPrepend = "prepend" // 在数组开头插入 value，数组不存在时创建
+	OpAppend  = "append"  // 在数组末尾追加 value，数组不存在时创建
+)
+
+// Rule 一条修改规则，path 和 to 使用 JSON 路径，见 parsePath
+type Rule struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"` // set / default / prepend / append
+	Min   *float64        `json:"min,omitempty"`   // clamp
+	Max   *float64        `json:"max,omitempty"`   // clamp
+	To    string          `json:"to,omitempty"`    // rename
+}
+
+// Validate 检查规则是否完整，路径是否合法
+func (r *Rule) Validate() error {
+	segments, err := parsePath(r.Path)
+	if err != nil {
+		return err
+	}
+	switch r.Op {
+	case OpSet, OpDefault, OpPrepend, OpAppend:
+		if len(r.Value) == 0 {
+			return fmt.Errorf("%s '%s': value is required", r.Op, r.Path)
+		}
+		if !json.Valid(r.Value) {
+			return fmt.Errorf("%s '%s': value is not valid JSON", r.Op, r.Path)
+		}
+	case OpRemove:
+	case OpClamp:
+		if r.Min == nil && r.Max == nil {
+			return fmt.Errorf("clamp '%s': min or max is required", r.Path)
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("clamp '%s': min is greater than max", r.Path)
+		}
+	case OpRename:
+		to, err := parsePath(r.To)
+		if err != nil {
+			return fmt.Errorf("rename '%s': %w", r.Path, err)
+		}
+		if hasWildcard(segments) || hasWildcard(to) {
+			return fmt.Errorf("rename '%s': wildcards are not supported", r.Path)
+		}
+	default:
+		return fmt.Errorf("unknown op '%s' for path '%s'", r.Op, r.Path)
+	}
+	return nil
+}
+
+// Validate 检查一组规则
+func Validate(rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply 依次将规则应用到已解码的 JSON 文档上，返回修改后的文档
+// 文档中的数字应使用 json.Number 解码，以免大整数丢失精度
+func Apply(doc interface{}, rules []Rule) (interface{}, error) {
+	root := location{
+		get: func() (interface{}, bool) { return doc, true },
+		set: func(value interface{}) { doc = value },
+		del: func() {},
+	}
+	for i := range rules {
+		if err := apply(root, &rules[i]); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// ApplyJSON 将规则应用到 JSON 请求体上，没有规则时原样返回
+func ApplyJSON(body []byte, rules []Rule) ([]byte, error) {
+	if len(rules) == 0 {
+		return body, nil
+	}
+	doc, err := Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	doc, err = Apply(doc, rules)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// Decode 解码 JSON，数字保留为 json.Number
+func Decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func apply(root location, rule *Rule) error {
+	segments, err := parsePath(rule.Path)
+	if err != nil {
+		return err
+	}
+
+	switch rule.Op {
+	case OpSet, OpDefault, OpPrepend, OpAppend:
+		for _, loc := range locate(root, segments, true) {
+			value, err := Decode(rule.Value)
+			if err != nil {
+				return fmt.Errorf("%s '%s': %w", rule.Op, rule.Path, err)
+			}
+			current, exists := loc.get()
+			switch rule.Op {
+			case OpSet:
+				loc.set(value)
+			case OpDefault:
+				if !exists || current == nil {
+					loc.set(value)
+				}
+			case OpPrepend, OpAppend:
+				items, ok := current.([]interface{})
+				if exists && current != nil && !ok {
+					return fmt.Errorf("%s '%s': target is not an array", rule.Op, rule.Path)
+				}
+				if rule.Op == OpPrepend {
+					loc.set(append([]interface{}{value}, items...))
+				} else {
+					loc.set(append(items, value))
+				}
+			}
+		}
+
+	case OpRemove:
+		for _, loc := range locate(root, segments, false) {
+			if _, exists := loc.get(); exists {
+				loc.del()
+			}
+		}
+
+	case OpClamp:
+		for _, loc := range locate(root, segments, false) {
+			current, exists := loc.get()
+			if !exists || current == nil {
+				continue
+			}
+			number, ok := toFloat(current)
+			if !ok {
+				return fmt.Errorf("clamp '%s': target is not a number", rule.Path)
+			}
+			clamped := number
+			if rule.Min != nil {
+				clamped = math.Max(clamped, *rule.Min)
+			}
+			if rule.Max != nil {
+				clamped = math.Min(clamped, *rule.Max)
+			}
+			if clamped != number {
+				loc.set(json.Number(strconv.FormatFloat(clamped, 'f', -1, 64)))
+			}
+		}
+
+	case OpRename:
+		to, err := parsePath(rule.To)
+		if err != nil {
+			return err
+		}
+		for _, loc := range locate(root, segments, false) {
+			value, exists := loc.get()
+			if !exists {
+				continue
+			}
+			loc.del()
+			for _, target := range locate(root, to, true) {
+				target.set(value)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown op '%s'", rule.Op)
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
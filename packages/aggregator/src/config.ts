@@ -12,6 +12,14 @@ export interface Config {
   debugMode?: boolean
 }
 
+// 上游请求的附加选项，拉取模型列表、校验模型和后端转发请求时都会使用
+// 包含字典字段，所在的列表不使用表格形式
+const upstreamOptionsSchema = Schema.object({
+  headers: Schema.dict(Schema.string()).role('table').description('附加请求头，可覆盖默认请求头和认证头'),
+  query: Schema.dict(Schema.string()).role('table').description('附加查询参数'),
+  authScheme: Schema.string().description('API Key 的传递方式：bearer（默认）、header:<请求头>、query:<参数名> 或 none'),
+})
+
 export const Config: Schema<Config> = Schema.intersect([
   // Auto-fetch sources configuration
   Schema.object({
@@ -29,26 +37,30 @@ export const Config: Schema<Config> = Schema.intersect([
           ]).description('平台类型'),
           enabled: Schema.boolean().default(true).description('启用'),
         }),
+        upstreamOptionsSchema,
       ])
-    ).role('table').description('自动拉取源'),
+    ).description('自动拉取源'),
   }),
 
   // Manual models
   Schema.object({
     manualModels: Schema.array(
-      Schema.object({
-        id: Schema.string().required().description('模型 ID'),
-        name: Schema.string().required().description('模型名称'),
-        sourceName: Schema.string().required().description('源名称'),
-        baseUrl: Schema.string().required().description('API 端点'),
-        apiKey: Schema.string().required().role('secret').description('API Key'),
-        platform: Schema.union([
-          Schema.const('openai' as const).description('OpenAI'),
-          Schema.const('claude' as const).description('Claude'),
-          Schema.const('gemini' as const).description('Gemini'),
-        ]).description('平台类型'),
-      })
-    ).role('table').description('手动添加的模型'),
+      Schema.intersect([
+        Schema.object({
+          id: Schema.string().required().description('模型 ID'),
+          name: Schema.string().required().description('模型名称'),
+          sourceName: Schema.string().required().description('源名称'),
+          baseUrl: Schema.string().required().description('API 端点'),
+          apiKey: Schema.string().required().role('secret').description('API Key'),
+          platform: Schema.union([
+            Schema.const('openai' as const).description('OpenAI'),
+            Schema.const('claude' as const).description('Claude'),
+            Schema.const('gemini' as const).description('Gemini'),
+          ]).description('平台类型'),
+        }),
+        upstreamOptionsSchema,
+      ])
+    ).description('手动添加的模型'),
   }),
 
   // Debug options
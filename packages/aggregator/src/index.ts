@@ -133,6 +133,9 @@ export function apply(ctx: Context, config: Config) {
         baseUrl: m.baseUrl,
         apiKey: m.apiKey,
         platform: m.platform,
+        headers: m.headers,
+        query: m.query,
+        authScheme: m.authScheme,
         // 使用默认值
         type: 'llm' as ModelType,
         maxTokens: 128000,
@@ -1,4 +1,5 @@
-import { Model, AutoFetchSource, ModelSource, ModelType } from '@elysia-api/shared'
+import { Model, AutoFetchSource, ModelSource, ModelType, UpstreamOptions } from '@elysia-api/shared'
+import { upstreamRequest } from './upstream'
 
 export class ModelFetcher {
   constructor(private ctx: import('koishi').Context) {}
@@ -25,9 +26,7 @@ export class ModelFetcher {
   }
 
   private async fetchOpenAIModels(source: AutoFetchSource): Promise<Model[]> {
-    const response = await fetch(`${source.baseUrl}/models`, {
-      headers: { 'Authorization': `Bearer ${source.apiKey}` }
-    })
+    const response = await fetch(...upstreamRequest(source, '/models'))
 
     if (!response.ok) {
       throw new Error(`HTTP ${response.status}: ${response.statusText}`)
@@ -43,6 +42,7 @@ export class ModelFetcher {
       sourceName: source.name,
       baseUrl: source.baseUrl,
       apiKey: source.apiKey,
+      ...this.upstreamOptions(source),
       platform: 'openai' as const,
       type: this.inferModelType(model.id),
       maxTokens: this.inferMaxTokens(model.id),
@@ -71,6 +71,7 @@ export class ModelFetcher {
       sourceName: source.name,
       baseUrl: source.baseUrl,
       apiKey: source.apiKey,
+      ...this.upstreamOptions(source),
       platform: 'claude' as const,
       type: 'llm' as const,
       maxTokens: model.maxTokens,
@@ -84,10 +85,8 @@ export class ModelFetcher {
   }
 
   private async fetchGeminiModels(source: AutoFetchSource): Promise<Model[]> {
-    // Gemini models endpoint
-    const response = await fetch(
-      `${source.baseUrl}/v1beta/models?key=${source.apiKey}`
-    )
+    // Gemini models endpoint，未配置 authScheme 时 API Key 放在 key 参数中
+    const response = await fetch(...upstreamRequest(source, '/v1beta/models', {}, 'query:key'))
 
     if (!response.ok) {
       throw new Error(`HTTP ${response.status}: ${response.statusText}`)
@@ -105,6 +104,7 @@ export class ModelFetcher {
         sourceName: source.name,
         baseUrl: source.baseUrl,
         apiKey: source.apiKey,
+        ...this.upstreamOptions(source),
         platform: 'gemini' as const,
         type: 'llm' as const,
         maxTokens: this.parseGeminiMaxTokens(model),
@@ -117,6 +117,15 @@ export class ModelFetcher {
       }))
   }
 
+  // 拉取到的模型沿用拉取源的附加请求头、查询参数和认证方式
+  private upstreamOptions(source: AutoFetchSource): UpstreamOptions {
+    return {
+      headers: source.headers,
+      query: source.query,
+      authScheme: source.authScheme,
+    }
+  }
+
   private inferModelType(modelId: string): ModelType {
     const id = modelId.toLowerCase()
     if (id.includes('embed') || id.includes('text-embedding')) {
@@ -1,20 +1,18 @@
 import { Model } from '@elysia-api/shared'
+import { upstreamRequest } from './upstream'
 
 export class ModelValidator {
   async validateModel(model: Model): Promise<boolean> {
     try {
-      const response = await fetch(`${model.baseUrl}/chat/completions`, {
+      const response = await fetch(...upstreamRequest(model, '/chat/completions', {
         method: 'POST',
-        headers: {
-          'Authorization': `Bearer ${model.apiKey}`,
-          'Content-Type': 'application/json',
-        },
+        headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           model: model.name,
           messages: [{ role: 'user', content: 'test' }],
           max_tokens: 1,
         }),
-      })
+      }))
 
       return response.ok
     } catch {
@@ -24,17 +22,14 @@ export class ModelValidator {
 
   async validateEmbeddingModel(model: Model): Promise<boolean> {
     try {
-      const response = await fetch(`${model.baseUrl}/embeddings`, {
+      const response = await fetch(...upstreamRequest(model, '/embeddings', {
         method: 'POST',
-        headers: {
-          'Authorization': `Bearer ${model.apiKey}`,
-          'Content-Type': 'application/json',
-        },
+        headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           model: model.name,
           input: 'test',
         }),
-      })
+      }))
 
       return response.ok
     } catch {
@@ -0,0 +1,58 @@
+import { UpstreamOptions } from '@elysia-api/shared'
+
+// 需要请求上游的模型或拉取源
+export type UpstreamTarget = UpstreamOptions & { baseUrl: string; apiKey: string }
+
+// 解析 authScheme，返回传递方式和请求头名或参数名，规则与后端一致
+export function parseAuthScheme(authScheme: string): [string, string] {
+  const index = authScheme.indexOf(':')
+  const scheme = (index < 0 ? authScheme : authScheme.slice(0, index)).trim().toLowerCase()
+  const name = index < 0 ? '' : authScheme.slice(index + 1).trim()
+  switch (scheme) {
+    case '':
+    case 'bearer':
+      return ['bearer', '']
+    case 'none':
+      return ['none', '']
+    case 'header':
+    case 'query':
+      if (!name) {
+        throw new Error(`authScheme '${authScheme}' requires a name, e.g. '${scheme}:<name>'`)
+      }
+      return [scheme, name]
+  }
+  throw new Error(`unknown authScheme '${authScheme}', expected bearer, header:<name>, query:<name> or none`)
+}
+
+// 构造发往上游的请求地址和参数
+// API Key 按 authScheme 放入请求头或查询参数，未配置时使用 defaultScheme；附加请求头最后设置，可覆盖默认请求头和认证头
+export function upstreamRequest(
+  target: UpstreamTarget,
+  path: string,
+  init: RequestInit = {},
+  defaultScheme = 'bearer',
+): [string, RequestInit] {
+  const url = new URL(`${target.baseUrl}${path}`)
+  for (const [key, value] of Object.entries(target.query ?? {})) {
+    url.searchParams.set(key, value)
+  }
+
+  const headers = new Headers(init.headers)
+  const [scheme, name] = parseAuthScheme(target.authScheme || defaultScheme)
+  switch (scheme) {
+    case 'bearer':
+      headers.set('Authorization', `Bearer ${target.apiKey}`)
+      break
+    case 'header':
+      headers.set(name, target.apiKey)
+      break
+    case 'query':
+      url.searchParams.set(name, target.apiKey)
+      break
+  }
+  for (const [key, value] of Object.entries(target.headers ?? {})) {
+    headers.set(key, value)
+  }
+
+  return [url.toString(), { ...init, headers }]
+}
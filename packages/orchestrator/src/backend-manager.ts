@@ -2,16 +2,46 @@ import { Context } from 'koishi'
 import { spawn, ChildProcess } from 'child_process'
 import { writeFileSync, mkdirSync, existsSync } from 'fs'
 import { join, dirname } from 'path'
-import { ModelGroupConfig, ServerConfig, AccessToken, Capability } from './config'
+import {
+  ModelGroupConfig, ServerConfig, AccessToken, Capability,
+  ModelSettings, TimeoutConfig, CacheStoreConfig, TransformRule,
+} from './config'
 import { Model } from '@elysia-api/shared'
 
+// 后端的请求改写规则，value 为 JSON 值
+interface BackendRule {
+  op: string
+  path: string
+  value?: unknown
+  min?: number
+  max?: number
+  to?: string
+}
+
 interface BackendConfig {
   server: { host: string; port: number }
-  tokens: Array<{ token: string; name: string; enabled: boolean }>
+  tokens: Array<{
+    token: string
+    name: string
+    enabled: boolean
+    admin?: boolean
+    rpm?: number
+    tpm?: number
+    dailyTokens?: number
+    monthlyTokens?: number
+    dailyBudget?: number
+    monthlyBudget?: number
+    allowedGroups?: string[]
+    deniedGroups?: string[]
+    expiresAt?: string
+  }>
   heartbeatTimeout?: number  // 心跳超时时间（秒）
   httpTimeout?: number  // HTTP 请求超时时间（秒），0 为不限制
   debugMode?: boolean     // 调试模式
   verboseLog?: boolean    // 详细日志模式
+  logFormat?: 'text' | 'json'  // 后端日志格式
+  timeouts?: TimeoutConfig  // 上游分阶段超时（秒）
+  cache?: CacheStoreConfig  // 响应缓存存储
   modelGroups: Array<{
     id: string
     name: string
@@ -22,19 +52,38 @@ interface BackendConfig {
       baseUrl: string
       apiKey: string
       platform: string
+      timeouts?: TimeoutConfig
+      contextWindow?: number
+      completions?: boolean
+      inputPrice?: number
+      outputPrice?: number
+      cachedInputPrice?: number
+      overrides?: BackendRule[]
+      transforms?: BackendRule[]
+      headers?: Record<string, string>
+      query?: Record<string, string>
+      authScheme?: string
     }>
     strategy: string
     maxRetries: number
     retryInterval: number
     maxConcurrency?: number
-    dailyLimitMaxRequests?: number
-    dailyLimitMaxTokens?: number
+    dailyLimit?: { enabled: boolean; maxRequests: number; maxTokens: number }
     type: string
     maxTokens?: number
     visionCapable?: boolean
     toolsCapable?: boolean
-    structuredOutput?: boolean
     thinkingMode?: string
+    timeouts?: TimeoutConfig
+    contextPolicy?: { mode: string; keepLastTurns?: number; reserveTokens?: number }
+    cache?: { enabled: boolean; ttl?: number; anyTemperature?: boolean }
+    coalesce?: boolean
+    hedge?: { enabled: boolean; delay?: number }
+    passthrough?: { allow?: string[]; deny?: string[] }
+    // 后端的 structuredOutput 是校验配置对象，structuredOutput 能力不写入
+    structuredOutput?: { validate: boolean; maxRetries?: number }
+    overrides?: BackendRule[]
+    transforms?: BackendRule[]
   }>
 }
 
@@ -55,6 +104,9 @@ export class BackendManager {
     private httpTimeout: number = 120,  // HTTP 请求超时时间（秒），0 为不限制
     private debugMode: boolean = false,  // 调试模式
     private verboseLog: boolean = false,  // 详细日志模式
+    private modelSettings: Record<string, ModelSettings> = {},  // 模型设置，键为模型 ID
+    private timeouts?: TimeoutConfig,  // 上游分阶段超时（秒）
+    private cacheStore?: CacheStoreConfig,  // 响应缓存存储
   ) {
     this.configPath = join(ctx.baseDir, 'data/elysia-api/config.json')
     this.heartbeatUrl = `http://${serverConfig.host}:${serverConfig.port}/__heartbeat`
@@ -233,10 +285,48 @@ export class BackendManager {
     return {
       visionCapable: capabilities.includes('visionCapable' as Capability),
       toolsCapable: capabilities.includes('toolsCapable' as Capability),
-      structuredOutput: capabilities.includes('structuredOutput' as Capability),
     }
   }
 
+  /**
+   * 整理超时配置：后端按整数秒读取，全部未设置时不写入
+   */
+  private toTimeouts(timeouts?: TimeoutConfig): TimeoutConfig | undefined {
+    if (!timeouts) return undefined
+    const result: TimeoutConfig = {}
+    for (const key of ['dial', 'tlsHandshake', 'firstByte', 'idle'] as const) {
+      if (timeouts[key]) result[key] = Math.round(timeouts[key]!)
+    }
+    return Object.keys(result).length ? result : undefined
+  }
+
+  /**
+   * 整理响应缓存存储配置，全部未设置时不写入，使用后端默认值
+   */
+  private toCacheStore(cache?: CacheStoreConfig): CacheStoreConfig | undefined {
+    const result: CacheStoreConfig = {
+      maxEntries: cache?.maxEntries || undefined,
+      dir: cache?.dir?.trim() || undefined,
+      maxDiskSize: cache?.maxDiskSize || undefined,
+    }
+    return result.maxEntries || result.dir || result.maxDiskSize ? result : undefined
+  }
+
+  /**
+   * 将规则中 JSON 文本形式的 value 转换为 JSON 值，无法解析时按字符串处理
+   */
+  private toRules(rules?: TransformRule[]): BackendRule[] | undefined {
+    if (!rules?.length) return undefined
+    return rules.map(({ value, ...rule }) => {
+      if (value === undefined || value === '') return rule
+      try {
+        return { ...rule, value: JSON.parse(value) }
+      } catch {
+        return { ...rule, value }
+      }
+    })
+  }
+
   writeConfig() {
     // Ensure directory exists
     if (!existsSync(dirname(this.configPath))) {
@@ -254,11 +344,21 @@ export class BackendManager {
       }
     }
 
-    // 将 tokens dict 转换为数组（供后端使用）
+    // 将 tokens dict 转换为数组（供后端使用），未设置的限制不写入
     const tokensArray = Object.entries(this.tokens).map(([name, token]) => ({
       name,
       token: token.token,
       enabled: token.enabled,
+      admin: token.admin || undefined,
+      rpm: token.rpm || undefined,
+      tpm: token.tpm || undefined,
+      dailyTokens: token.dailyTokens || undefined,
+      monthlyTokens: token.monthlyTokens || undefined,
+      dailyBudget: token.dailyBudget || undefined,
+      monthlyBudget: token.monthlyBudget || undefined,
+      allowedGroups: token.allowedGroups?.length ? token.allowedGroups : undefined,
+      deniedGroups: token.deniedGroups?.length ? token.deniedGroups : undefined,
+      expiresAt: token.expiresAt?.trim() || undefined,
     }))
 
     const backendConfig: BackendConfig = {
@@ -268,6 +368,9 @@ export class BackendManager {
       httpTimeout: this.httpTimeout,
       debugMode: this.debugMode,
       verboseLog: this.verboseLog,
+      logFormat: 'json',  // 使用 JSON 行日志，便于在 pipeLogs 中解析
+      timeouts: this.toTimeouts(this.timeouts),
+      cache: this.toCacheStore(this.cacheStore),
       modelGroups: this.modelGroups
         .filter(g => g.enabled)
         .map(group => {
@@ -289,13 +392,29 @@ export class BackendManager {
               return model
             })
             .filter((m): m is Model => m !== undefined)
-            .map(m => ({
-              id: m.id,
-              name: m.name,
-              baseUrl: m.baseUrl,
-              apiKey: m.apiKey,
-              platform: m.platform,
-            }))
+            .map(m => {
+              const settings = this.modelSettings[m.id] ?? {}
+              return {
+                id: m.id,
+                name: m.name,
+                baseUrl: m.baseUrl,
+                apiKey: m.apiKey,
+                platform: m.platform,
+                timeouts: this.toTimeouts(settings.timeouts),
+                // 未单独设置时使用 aggregator 获取的模型最大上下文
+                contextWindow: settings.contextWindow || m.maxTokens || undefined,
+                completions: settings.completions || undefined,
+                // 价格为 0 表示免费，需要写入
+                inputPrice: settings.inputPrice,
+                outputPrice: settings.outputPrice,
+                cachedInputPrice: settings.cachedInputPrice,
+                overrides: this.toRules(settings.overrides),
+                transforms: this.toRules(settings.transforms),
+                headers: m.headers,
+                query: m.query,
+                authScheme: m.authScheme || undefined,
+              }
+            })
 
           if (this.debugMode || this.verboseLog) {
             this.ctx.logger.info(`[writeConfig] 模型组 "${group.name}" 匹配到 ${groupModels.length} 个有效模型`)
@@ -312,13 +431,50 @@ export class BackendManager {
             strategy: group.strategy,
             maxRetries: group.maxRetries,
             retryInterval: group.retryInterval,
-            maxConcurrency: group.enableRateLimit ? group.maxConcurrency : undefined,
-            dailyLimitMaxRequests: group.enableRateLimit ? group.dailyLimitMaxRequests : undefined,
-            dailyLimitMaxTokens: group.enableRateLimit ? group.dailyLimitMaxTokens : undefined,
+            maxConcurrency: group.maxConcurrency || undefined,
+            // 后端按 dailyLimit 对象读取每日限额，0 表示不限制
+            dailyLimit: group.enableRateLimit
+              ? {
+                  enabled: true,
+                  maxRequests: group.dailyLimitMaxRequests ?? 0,
+                  maxTokens: group.dailyLimitMaxTokens ?? 0,
+                }
+              : undefined,
             type: group.type ?? 'llm',
             maxTokens: group.maxTokens,
             ...capabilityBooleans,
             thinkingMode: group.thinkingMode,
+            timeouts: this.toTimeouts(group.timeouts),
+            contextPolicy: group.contextPolicyMode && group.contextPolicyMode !== 'reject'
+              ? {
+                  mode: group.contextPolicyMode,
+                  keepLastTurns: group.contextKeepLastTurns || undefined,
+                  reserveTokens: group.contextReserveTokens || undefined,
+                }
+              : undefined,
+            cache: group.enableCache
+              ? {
+                  enabled: true,
+                  ttl: group.cacheTtl || undefined,
+                  anyTemperature: group.cacheAnyTemperature || undefined,
+                }
+              : undefined,
+            coalesce: group.coalesce || undefined,
+            hedge: group.enableHedge
+              ? { enabled: true, delay: group.hedgeDelay || undefined }
+              : undefined,
+            passthrough: group.passthroughAllow?.length || group.passthroughDeny?.length
+              ? {
+                  allow: group.passthroughAllow?.length ? group.passthroughAllow : undefined,
+                  deny: group.passthroughDeny?.length ? group.passthroughDeny : undefined,
+                }
+              : undefined,
+            // 重试次数为 0 表示不重试，需要写入
+            structuredOutput: group.validateStructuredOutput
+              ? { validate: true, maxRetries: group.structuredOutputMaxRetries }
+              : undefined,
+            overrides: this.toRules(group.overrides),
+            transforms: this.toRules(group.transforms),
           }
         })
         .filter(g => g.models.length > 0),
@@ -330,7 +486,9 @@ export class BackendManager {
 
   private pipeLogs() {
     this.process?.stdout?.on('data', (data) => {
-      this.ctx.logger.info(`[backend] ${data.toString().trim()}`)
+      for (const line of data.toString().split('\n')) {
+        if (line.trim()) this.logBackendLine(line.trim())
+      }
     })
 
     this.process?.stderr?.on('data', (data) => {
@@ -338,6 +496,40 @@ export class BackendManager {
     })
   }
 
+  /**
+   * 解析后端输出的 JSON 日志行，按日志级别转发到 Koishi logger
+   * 无法解析的行按普通文本输出
+   */
+  private logBackendLine(line: string) {
+    let entry: Record<string, unknown>
+    try {
+      entry = JSON.parse(line)
+    } catch {
+      this.ctx.logger.info(`[backend] ${line}`)
+      return
+    }
+
+    const { time, level, msg, ...attrs } = entry
+    const extra = Object.entries(attrs)
+      .map(([key, value]) => `${key}=${typeof value === 'string' ? value : JSON.stringify(value)}`)
+      .join(' ')
+    const text = `[backend] ${msg}${extra ? ' ' + extra : ''}`
+
+    switch (level) {
+      case 'ERROR':
+        this.ctx.logger.error(text)
+        break
+      case 'WARN':
+        this.ctx.logger.warn(text)
+        break
+      case 'DEBUG':
+        this.ctx.logger.debug(text)
+        break
+      default:
+        this.ctx.logger.info(text)
+    }
+  }
+
   isRunning(): boolean {
     return this.process !== null && this.process.exitCode === null
   }
@@ -9,10 +9,59 @@ export interface ServerConfig {
 export interface AccessToken {
   token: string
   enabled: boolean
+  admin?: boolean
+  // 以下限制为 0 或空时不限制
+  rpm?: number
+  tpm?: number
+  dailyTokens?: number
+  monthlyTokens?: number
+  dailyBudget?: number    // 美元
+  monthlyBudget?: number  // 美元
+  allowedGroups?: string[]
+  deniedGroups?: string[]
+  expiresAt?: string      // RFC3339 或 YYYY-MM-DD
 }
 
 export type Capability = 'visionCapable' | 'toolsCapable' | 'structuredOutput'
 
+// 上游分阶段超时（秒），0 或不填时继承上一级配置，负数表示不限制
+export interface TimeoutConfig {
+  dial?: number
+  tlsHandshake?: number
+  firstByte?: number
+  idle?: number
+}
+
+// 请求改写规则（overrides / transforms），value 为 JSON 文本
+export interface TransformRule {
+  op: 'set' | 'default' | 'remove' | 'clamp' | 'rename' | 'prepend' | 'append'
+  path: string
+  value?: string
+  min?: number
+  max?: number
+  to?: string
+}
+
+// 模型级设置，按模型 ID 配置，在所有使用该模型的模型组中生效
+export interface ModelSettings {
+  contextWindow?: number  // 不填时使用 aggregator 提供的 maxTokens
+  completions?: boolean
+  // 每百万 token 的价格（美元），不填时使用后端内置价格表
+  inputPrice?: number
+  outputPrice?: number
+  cachedInputPrice?: number
+  timeouts?: TimeoutConfig
+  overrides?: TransformRule[]
+  transforms?: TransformRule[]
+}
+
+// 响应缓存的存储配置（各模型组单独启用缓存）
+export interface CacheStoreConfig {
+  maxEntries?: number
+  dir?: string
+  maxDiskSize?: number  // MB
+}
+
 export interface ModelGroupConfig {
   id: string
   name: string
@@ -29,6 +78,22 @@ export interface ModelGroupConfig {
   type?: ModelType
   capabilities?: Capability[]
   thinkingMode?: ThinkingMode
+  timeouts?: TimeoutConfig
+  contextPolicyMode?: 'reject' | 'drop-oldest' | 'middle-out'
+  contextKeepLastTurns?: number
+  contextReserveTokens?: number
+  enableCache?: boolean
+  cacheTtl?: number
+  cacheAnyTemperature?: boolean
+  coalesce?: boolean
+  enableHedge?: boolean
+  hedgeDelay?: number
+  passthroughAllow?: string[]
+  passthroughDeny?: string[]
+  validateStructuredOutput?: boolean
+  structuredOutputMaxRetries?: number
+  overrides?: TransformRule[]
+  transforms?: TransformRule[]
 }
 
 export interface Config {
@@ -36,12 +101,85 @@ export interface Config {
   heartbeatTimeout?: number
   heartbeatInterval?: number
   httpTimeout?: number
+  timeouts?: TimeoutConfig
+  cache?: CacheStoreConfig
   tokens: Record<string, AccessToken>
   modelGroups: ModelGroupConfig[]
+  modelSettings?: Record<string, ModelSettings>
   debugMode?: boolean
   verboseLog?: boolean
 }
 
+// 访问令牌配置 Schema
+const tokenSchema = Schema.object({
+  token: Schema.string().role('secret').description('访问令牌'),
+  enabled: Schema.boolean().default(true).description('启用'),
+  admin: Schema.boolean().default(false).description('管理员令牌（可访问管理接口和 /metrics）'),
+  rpm: Schema.number().min(0).description('每分钟请求数上限，0 为不限制'),
+  tpm: Schema.number().min(0).description('每分钟 token 数上限，0 为不限制'),
+  dailyTokens: Schema.number().min(0).description('每日 token 预算，0 为不限制'),
+  monthlyTokens: Schema.number().min(0).description('每月 token 预算，0 为不限制'),
+  dailyBudget: Schema.number().min(0).step(0.01).description('每日费用预算（美元），0 为不限制'),
+  monthlyBudget: Schema.number().min(0).step(0.01).description('每月费用预算（美元），0 为不限制'),
+  allowedGroups: Schema.array(Schema.string()).description('允许使用的模型组，支持 * 和 ? 通配符，为空时允许全部'),
+  deniedGroups: Schema.array(Schema.string()).description('禁止使用的模型组，支持通配符，优先于允许列表'),
+  expiresAt: Schema.string().description('过期时间：RFC3339，或 YYYY-MM-DD（当天结束时过期）'),
+})
+
+// 分阶段超时 Schema
+const timeoutSchema = Schema.object({
+  dial: Schema.number().description('TCP 连接超时'),
+  tlsHandshake: Schema.number().description('TLS 握手超时'),
+  firstByte: Schema.number().description('流式请求首个数据块超时'),
+  idle: Schema.number().description('流式请求数据块间的空闲超时'),
+})
+
+// 请求改写规则 Schema
+const ruleSchema = Schema.object({
+  op: Schema.union([
+    Schema.const('set' as const).description('写入'),
+    Schema.const('default' as const).description('缺省时写入'),
+    Schema.const('remove' as const).description('删除'),
+    Schema.const('clamp' as const).description('限制范围'),
+    Schema.const('rename' as const).description('重命名'),
+    Schema.const('prepend' as const).description('数组开头插入'),
+    Schema.const('append' as const).description('数组末尾追加'),
+  ]).required().description('操作'),
+  path: Schema.string().required().description('字段路径，如 temperature、messages.0.content'),
+  value: Schema.string().description('值（JSON），无法解析为 JSON 时按字符串处理'),
+  min: Schema.number().description('clamp 下限'),
+  max: Schema.number().description('clamp 上限'),
+  to: Schema.string().description('rename 目标路径'),
+})
+
+// 模型级设置 Schema
+const modelSettingsSchema = Schema.object({
+  contextWindow: Schema.number().min(0).description('上下文窗口（token），不填时使用模型信息中的最大上下文'),
+  completions: Schema.boolean().default(false).description('支持旧版 /completions 接口'),
+  inputPrice: Schema.number().min(0).step(0.01).description('输入价格（美元/百万 token），不填时使用内置价格表'),
+  outputPrice: Schema.number().min(0).step(0.01).description('输出价格（美元/百万 token）'),
+  cachedInputPrice: Schema.number().min(0).step(0.01).description('缓存输入价格（美元/百万 token）'),
+  timeouts: timeoutSchema.description('超时（秒），覆盖模型组配置'),
+  overrides: Schema.array(ruleSchema).role('table').description('统一格式请求的改写规则，在模型组规则之后应用'),
+  transforms: Schema.array(ruleSchema).role('table').description('发往上游的请求体的改写规则，在模型组规则之后应用'),
+})
+
+// 模型设置和全局上游配置（包含嵌套和数组字段，不使用 table 外观）
+const advancedSchema = Schema.intersect([
+  Schema.object({
+    modelSettings: Schema.dict(modelSettingsSchema).description('模型设置，键为模型 ID'),
+  }).description('模型设置'),
+
+  Schema.object({
+    timeouts: timeoutSchema.description('上游分阶段超时（秒），0 或不填使用默认值，负数不限制'),
+    cache: Schema.object({
+      maxEntries: Schema.number().min(0).description('内存缓存最大条目数，默认 1000'),
+      dir: Schema.string().description('磁盘缓存目录，不填时只使用内存'),
+      maxDiskSize: Schema.number().min(0).description('磁盘缓存最大占用（MB），默认 512'),
+    }).description('响应缓存存储'),
+  }).description('上游与缓存'),
+])
+
 // 模型组配置 Schema
 const modelGroupSchema = Schema.intersect([
   // 基础字段
@@ -116,13 +254,78 @@ const modelGroupSchema = Schema.intersect([
     // true 分支
     Schema.object({
       enableRateLimit: Schema.const(true).required(),
-      maxConcurrency: Schema.number().default(10).description('最大并发数'),
       dailyLimitMaxRequests: Schema.number().description('单日最大请求数'),
       dailyLimitMaxTokens: Schema.number().description('单日最大 token 消耗'),
     }),
     // false 分支
     Schema.object({}),
   ]),
+
+  // 并发与超时
+  Schema.object({
+    maxConcurrency: Schema.number().min(0).description('最大并发数（对冲请求同样占用名额），不填为不限制'),
+    timeouts: timeoutSchema.description('超时（秒），覆盖全局配置'),
+  }),
+
+  // 超出上下文窗口时的处理
+  Schema.object({
+    contextPolicyMode: Schema.union([
+      Schema.const('reject' as const).description('直接拒绝'),
+      Schema.const('drop-oldest' as const).description('丢弃最早的对话'),
+      Schema.const('middle-out' as const).description('保留开头和结尾，丢弃中间的对话'),
+    ]).default('reject' as const).description('超出上下文窗口时的处理'),
+    contextKeepLastTurns: Schema.number().min(1).description('裁剪时始终保留的最近对话轮数，默认 1'),
+    contextReserveTokens: Schema.number().min(0).description('客户端未指定输出上限时预留的 token 数，默认 1024'),
+  }),
+
+  // 响应缓存（条件分支）
+  Schema.object({
+    enableCache: Schema.boolean().default(false).description('启用响应缓存'),
+  }),
+
+  Schema.union([
+    Schema.object({
+      enableCache: Schema.const(true).required(),
+      cacheTtl: Schema.number().min(0).description('缓存有效期（秒），默认 3600'),
+      cacheAnyTemperature: Schema.boolean().default(false).description('缓存所有请求（默认只缓存 temperature 为 0 的请求）'),
+    }),
+    Schema.object({}),
+  ]),
+
+  // 请求合并与对冲（条件分支）
+  Schema.object({
+    coalesce: Schema.boolean().default(false).description('合并并发的相同请求，只向上游发送一次'),
+    enableHedge: Schema.boolean().default(false).description('启用对冲请求'),
+  }),
+
+  Schema.union([
+    Schema.object({
+      enableHedge: Schema.const(true).required(),
+      hedgeDelay: Schema.number().min(0).description('发起对冲前的等待时间（毫秒），默认 1000'),
+    }),
+    Schema.object({}),
+  ]),
+
+  // 结构化输出校验（条件分支）
+  Schema.object({
+    validateStructuredOutput: Schema.boolean().default(false).description('校验结构化输出，不符合 JSON Schema 时重新请求'),
+  }),
+
+  Schema.union([
+    Schema.object({
+      validateStructuredOutput: Schema.const(true).required(),
+      structuredOutputMaxRetries: Schema.number().min(0).description('校验失败后的重试次数，默认 1，0 表示不重试直接返回错误'),
+    }),
+    Schema.object({}),
+  ]),
+
+  // 透传字段与请求改写
+  Schema.object({
+    passthroughAllow: Schema.array(Schema.string()).description('允许透传给上游的未知字段，支持通配符，为空时全部允许'),
+    passthroughDeny: Schema.array(Schema.string()).description('禁止透传给上游的未知字段，优先于允许列表'),
+    overrides: Schema.array(ruleSchema).role('table').description('统一格式请求的改写规则，对所有上游生效'),
+    transforms: Schema.array(ruleSchema).role('table').description('发往上游的请求体的改写规则'),
+  }),
 ])
 
 // 创建插件配置 Schema
@@ -144,14 +347,9 @@ export const createConfig = (ctx: Context): Schema<Config> => {
       httpTimeout: Schema.number().default(120).description('HTTP 请求超时时间（秒），0 为不限制'),
     }).description('基础配置'),
 
-    // 访问令牌配置（dict 类型，使用 table 外观）
+    // 访问令牌配置（dict 类型，包含数组字段，不使用 table 外观）
     Schema.object({
-      tokens: Schema.dict(
-        Schema.object({
-          token: Schema.string().role('secret').description('访问令牌'),
-          enabled: Schema.boolean().default(true).description('启用'),
-        })
-      ).role('table').description('访问令牌列表'),
+      tokens: Schema.dict(tokenSchema).description('访问令牌列表'),
     }).description('访问令牌'),
 
     // 模型组配置
@@ -161,6 +359,8 @@ export const createConfig = (ctx: Context): Schema<Config> => {
         .description('配置模型组'),
     }).description('模型组配置'),
 
+    advancedSchema,
+
     // Debug options
     Schema.object({
       debugMode: Schema.boolean().default(false).description('启用调试日志'),
@@ -183,14 +383,9 @@ export const ConfigSchema: Schema<Config> = Schema.intersect([
     httpTimeout: Schema.number().default(120).description('HTTP 请求超时时间（秒），0 为不限制'),
   }).description('基础配置'),
 
-  // 访问令牌配置（dict 类型，使用 table 外观）
+  // 访问令牌配置（dict 类型，包含数组字段，不使用 table 外观）
   Schema.object({
-    tokens: Schema.dict(
-      Schema.object({
-        token: Schema.string().role('secret').description('访问令牌'),
-        enabled: Schema.boolean().default(true).description('启用'),
-      })
-    ).role('table').description('访问令牌列表'),
+    tokens: Schema.dict(tokenSchema).description('访问令牌列表'),
   }).description('访问令牌'),
 
   // 模型组配置
@@ -200,6 +395,8 @@ export const ConfigSchema: Schema<Config> = Schema.intersect([
       .description('配置模型组'),
   }).description('模型组配置'),
 
+  advancedSchema,
+
   // Debug options
   Schema.object({
     debugMode: Schema.boolean().default(false).description('启用调试日志'),
@@ -80,7 +80,10 @@ export function apply(ctx: Context, config: Config) {
       config.heartbeatTimeout,         // 后端心跳超时时间
       config.httpTimeout ?? 120,       // HTTP 请求超时时间（秒）
       config.debugMode ?? false,       // 调试模式
-      config.verboseLog ?? false       // 详细日志模式
+      config.verboseLog ?? false,      // 详细日志模式
+      config.modelSettings ?? {},      // 模型设置
+      config.timeouts,                 // 上游分阶段超时
+      config.cache                     // 响应缓存存储
     )
 
     // 启动后端（如果未运行）
@@ -5,7 +5,14 @@ export type ModelType = 'llm' | 'embedding' | 'reranker'
 export type ThinkingMode = 'both' | 'non-thinking-only' | 'thinking-only'
 export type ModelSource = 'auto' | 'manual'
 
-export interface Model {
+// 上游请求的附加选项，与后端 ModelRef 的同名字段一致
+export interface UpstreamOptions {
+  headers?: Record<string, string>  // 附加请求头，可覆盖默认请求头和认证头
+  query?: Record<string, string>    // 附加查询参数
+  authScheme?: string               // API Key 的传递方式：bearer（默认）| header:<请求头> | query:<参数名> | none
+}
+
+export interface Model extends UpstreamOptions {
   // Identification
   id: string
   name: string
@@ -34,7 +41,7 @@ export interface Model {
   lastChecked: Date
 }
 
-export interface AutoFetchSource {
+export interface AutoFetchSource extends UpstreamOptions {
   name: string
   baseUrl: string
   apiKey: string
@@ -42,7 +49,7 @@ export interface AutoFetchSource {
   enabled: boolean
 }
 
-export interface ManualModel {
+export interface ManualModel extends UpstreamOptions {
   id: string
   name: string
   baseUrl: string